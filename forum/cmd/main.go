@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 
+	"forum/internal/config"
 	"forum/internal/delivery"
+	"forum/internal/mail"
 	"forum/internal/repository"
 	"forum/internal/server"
 	"forum/internal/service"
@@ -12,17 +16,41 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const port = "8080"
+const (
+	port   = "8080"
+	dbName = "store.db"
+)
 
 func main() {
-	db, err := repository.OpenSqliteDB("store.db")
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "migrate":
+			err = migrate(dbName, os.Args[2:])
+		case "role":
+			err = setRole(dbName, os.Args[2:])
+		default:
+			log.Fatalf("unknown command %q\n%s\n%s", os.Args[1], migrateUsage, roleUsage)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	db, err := repository.OpenSqliteDB(dbName)
 	if err != nil {
 		log.Fatalf("error while opening db: %s", err)
 	}
 
+	cfg := config.Load()
 	repo := repository.NewRepository(db)
-	service := service.NewService(repo)
-	handler := delivery.NewHandler(service)
+	services, err := service.NewService(repo, cfg, mail.NewMailer(cfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go service.SweepSessions(context.Background(), services.Authorization, cfg.SessionSweepInterval)
+	handler := delivery.NewHandler(services, cfg)
 	server := new(server.Server)
 
 	fmt.Printf("Starting server at port %s\nhttp://localhost:%s/\n", port, port)
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"forum/internal/repository"
+)
+
+const migrateUsage = "usage: forum migrate up|down|status"
+
+func migrate(dbName string, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := repository.ConnectSqliteDB(dbName)
+	if err != nil {
+		return fmt.Errorf("error while opening db: %s", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		count, err := repository.MigrateUp(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", count)
+	case "down":
+		m, err := repository.MigrateDown(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d %s\n", m.Version, m.Name)
+	case "status":
+		status, err := repository.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-30s %s\n", m.Version, m.Name, state)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+const roleUsage = "usage: forum role USERNAME user|moderator|admin"
+
+// setRole gives a user a role from the command line, which is how the
+// first admin of a forum is made.
+func setRole(dbName string, args []string) error {
+	if len(args) != 2 {
+		return errors.New(roleUsage)
+	}
+
+	role := models.Role(args[1])
+	if !role.Valid() {
+		return errors.New(roleUsage)
+	}
+
+	db, err := repository.OpenSqliteDB(dbName)
+	if err != nil {
+		return fmt.Errorf("error while opening db: %s", err)
+	}
+	defer db.Close()
+
+	users := repository.NewAuthSqlite(db)
+	user, err := users.GetUser(args[0], "")
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user is named %q", args[0])
+	} else if err != nil {
+		return err
+	}
+
+	ok, err := users.SetRole(user.ID, role)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s is the last admin and the forum needs at least one", user.Username)
+	}
+	fmt.Printf("%s is now %s\n", user.Username, role)
+	return nil
+}
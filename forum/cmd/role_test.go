@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+func TestSetRole(t *testing.T) {
+	// The database is named relative to the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	const dbName = "store.db"
+	db, err := repository.OpenSqliteDB(dbName)
+	if errors.Is(err, repository.ErrNoFTS5) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	users := repository.NewAuthSqlite(db)
+	now := time.Now().UTC()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := users.CreateUser(models.User{Username: name, Email: name + "@example.com", Password: "x", CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	for _, step := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"alice"}, false},
+		{[]string{"alice", "owner"}, false},
+		{[]string{"carol", "admin"}, false},
+		// Making the first admin of a forum.
+		{[]string{"alice", "admin"}, true},
+		{[]string{"alice", "user"}, false},
+		{[]string{"bob", "admin"}, true},
+		{[]string{"alice", "moderator"}, true},
+	} {
+		if err := setRole(dbName, step.args); (err == nil) != step.ok {
+			t.Fatalf("setRole(%q) = %v, want success %t", step.args, err, step.ok)
+		}
+	}
+
+	db, err = repository.ConnectSqliteDB(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users = repository.NewAuthSqlite(db)
+	for name, role := range map[string]models.Role{"alice": models.RoleModerator, "bob": models.RoleAdmin} {
+		user, err := users.GetUser(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != role {
+			t.Errorf("%s is %s, want %s", name, user.Role, role)
+		}
+	}
+}
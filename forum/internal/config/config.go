@@ -0,0 +1,155 @@
+package config
+
+import (
+	"crypto/rand"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings that can be tuned through environment variables.
+type Config struct {
+	// CommentMaxDepth is how deep comment threads are rendered before
+	// the rest is hidden behind a "continue this thread" link.
+	CommentMaxDepth int
+	// SessionSweepInterval is how often expired sessions are purged.
+	SessionSweepInterval time.Duration
+	// Secret keys the HMACs of the forum, such as CSRF tokens and the
+	// links sent by email. Without FORUM_SECRET a random one is used,
+	// which a restart invalidates, so it must be set to send mail.
+	Secret []byte
+	// CookieSecure marks the cookies Secure, for forums served over HTTPS;
+	// it also turns on Strict-Transport-Security.
+	CookieSecure bool
+	// CookieSameSite is the SameSite attribute of the cookies: lax, strict
+	// or none.
+	CookieSameSite string
+	// BaseURL is the address the forum is reached at, for the links sent
+	// by email.
+	BaseURL string
+	// Mail picks how mail is sent: log writes it to the log, file to
+	// MailDir and smtp through SMTPAddr.
+	Mail         string
+	MailFrom     string
+	MailDir      string
+	SMTPAddr     string
+	SMTPUser     string
+	SMTPPassword string
+	// OIDCIssuer turns on single sign-on through the OpenID provider at
+	// that address, which the forum is registered with as the client
+	// OIDCClientID. Its redirect URL is BaseURL/sign-in/oidc/callback.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCName is the provider's name on the sign in button.
+	OIDCName string
+}
+
+func Load() Config {
+	mail := choiceEnv("FORUM_MAIL", "log", "file", "smtp")
+
+	return Config{
+		CommentMaxDepth:      intEnv("FORUM_COMMENT_MAX_DEPTH", 5),
+		SessionSweepInterval: durationEnv("FORUM_SESSION_SWEEP_INTERVAL", time.Hour),
+		Secret:               secretEnv("FORUM_SECRET", mail != "log"),
+		CookieSecure:         boolEnv("FORUM_COOKIE_SECURE", false),
+		CookieSameSite:       choiceEnv("FORUM_COOKIE_SAMESITE", "lax", "strict", "none"),
+		BaseURL:              strings.TrimSuffix(stringEnv("FORUM_BASE_URL", "http://localhost:8080"), "/"),
+		Mail:                 mail,
+		MailFrom:             stringEnv("FORUM_MAIL_FROM", "forum@localhost"),
+		MailDir:              stringEnv("FORUM_MAIL_DIR", "mail"),
+		SMTPAddr:             stringEnv("FORUM_SMTP_ADDR", "localhost:25"),
+		SMTPUser:             os.Getenv("FORUM_SMTP_USER"),
+		SMTPPassword:         os.Getenv("FORUM_SMTP_PASSWORD"),
+		OIDCIssuer:           strings.TrimSuffix(os.Getenv("FORUM_OIDC_ISSUER"), "/"),
+		OIDCClientID:         os.Getenv("FORUM_OIDC_CLIENT_ID"),
+		OIDCClientSecret:     os.Getenv("FORUM_OIDC_CLIENT_SECRET"),
+		OIDCName:             stringEnv("FORUM_OIDC_NAME", "single sign-on"),
+	}
+}
+
+func stringEnv(key, fallback string) string {
+	if val := strings.TrimSpace(os.Getenv(key)); val != "" {
+		return val
+	}
+	return fallback
+}
+
+func intEnv(key string, fallback int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("config: invalid %s=%q, using %d", key, val, fallback)
+		return fallback
+	}
+	return n
+}
+
+func boolEnv(key string, fallback bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("config: invalid %s=%q, using %t", key, val, fallback)
+		return fallback
+	}
+	return b
+}
+
+// choiceEnv reads one of the given values, the first being the default.
+func choiceEnv(key string, choices ...string) string {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return choices[0]
+	}
+
+	val = strings.ToLower(strings.TrimSpace(val))
+	for _, choice := range choices {
+		if val == choice {
+			return val
+		}
+	}
+	log.Printf("config: invalid %s=%q, using %s", key, val, choices[0])
+	return choices[0]
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		log.Printf("config: invalid %s=%q, using %s", key, val, fallback)
+		return fallback
+	}
+	return d
+}
+
+// secretEnv reads a secret, or makes a random one unless it is required:
+// what the secret signed stops being valid when it changes.
+func secretEnv(key string, required bool) []byte {
+	if val := os.Getenv(key); val != "" {
+		return []byte(val)
+	}
+	if required {
+		log.Fatalf("config: %s must be set to send mail, or the links mailed out stop working at the next restart", key)
+	}
+
+	log.Printf("config: %s is not set, using a random secret", key)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("config: generating a secret: %s", err)
+	}
+	return secret
+}
@@ -0,0 +1,321 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+const apiPrefix = "/api/v1"
+
+// maxAPIBody caps the size of a JSON request body.
+const maxAPIBody = 1 << 20
+
+// apiHandler serves one API endpoint. It returns the status and the value
+// to encode as the response body; a nil body sends no content. Errors are
+// turned into the JSON error envelope by apiStatus.
+type apiHandler func(r *http.Request, user models.User, params map[string]string) (int, interface{}, error)
+
+type apiRoute struct {
+	method string
+	// pattern is the path below apiPrefix; segments in braces capture
+	// the matching segment of the request path.
+	pattern string
+	// scope is what an API token needs to call the route. Routes without
+	// one can only be called with a session.
+	scope   models.Scope
+	handler apiHandler
+}
+
+func (h *Handler) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{http.MethodPost, "/sessions", "", h.apiSignIn},
+		{http.MethodGet, "/sessions", "", h.apiSessions},
+		{http.MethodDelete, "/sessions/current", "", h.apiSignOut},
+		{http.MethodDelete, "/sessions/others", "", h.apiSignOutOthers},
+		{http.MethodDelete, "/sessions/{id}", "", h.apiRevokeSession},
+
+		{http.MethodPost, "/users", "", h.apiSignUp},
+		{http.MethodGet, "/users/me", models.ScopeRead, h.apiMe},
+		{http.MethodPost, "/users/me/verification", "", h.apiResendVerification},
+		{http.MethodGet, "/users/{username}", models.ScopeRead, h.apiUserProfile},
+
+		{http.MethodGet, "/posts", models.ScopeRead, h.apiPosts},
+		{http.MethodPost, "/posts", models.ScopePosts, h.apiCreatePost},
+		{http.MethodGet, "/posts/{id}", models.ScopeRead, h.apiPost},
+		{http.MethodPut, "/posts/{id}", models.ScopePosts, h.apiUpdatePost},
+		{http.MethodDelete, "/posts/{id}", models.ScopePosts, h.apiDeletePost},
+		{http.MethodGet, "/posts/{id}/revisions", models.ScopeRead, h.apiPostRevisions},
+		{http.MethodPost, "/posts/{id}/reactions", models.ScopeReactions, h.apiReactToPost},
+		{http.MethodGet, "/posts/{id}/comments", models.ScopeRead, h.apiComments},
+		{http.MethodPost, "/posts/{id}/comments", models.ScopeComments, h.apiCreateComment},
+		{http.MethodGet, "/posts/{id}/comments/{commentID}", models.ScopeRead, h.apiCommentThread},
+
+		{http.MethodPut, "/comments/{id}", models.ScopeComments, h.apiUpdateComment},
+		{http.MethodDelete, "/comments/{id}", models.ScopeComments, h.apiDeleteComment},
+		{http.MethodPost, "/comments/{id}/reactions", models.ScopeReactions, h.apiReactToComment},
+
+		{http.MethodGet, "/categories", models.ScopeRead, h.apiCategories},
+		{http.MethodPost, "/categories", models.ScopeCategories, h.apiCreateCategory},
+		{http.MethodGet, "/categories/{slug}", models.ScopeRead, h.apiCategory},
+		{http.MethodPut, "/categories/{slug}", models.ScopeCategories, h.apiUpdateCategory},
+
+		{http.MethodGet, "/search", models.ScopeRead, h.apiSearch},
+
+		{http.MethodGet, "/tokens", "", h.apiTokens},
+		{http.MethodPost, "/tokens", "", h.apiCreateToken},
+		{http.MethodDelete, "/tokens/{id}", "", h.apiRevokeToken},
+
+		{http.MethodGet, "/two-factor", "", h.apiTwoFactor},
+		{http.MethodPost, "/two-factor/setup", "", h.apiSetupTwoFactor},
+		{http.MethodPost, "/two-factor/enable", "", h.apiEnableTwoFactor},
+		{http.MethodPost, "/two-factor/disable", "", h.apiDisableTwoFactor},
+
+		{http.MethodGet, "/admin/lockouts", "", h.apiLockouts},
+		{http.MethodDelete, "/admin/lockouts/{kind}/{value}", "", h.apiUnlock},
+		{http.MethodGet, "/admin/roles", "", h.apiStaff},
+		{http.MethodPut, "/admin/roles/{username}", "", h.apiSetRole},
+	}
+}
+
+// api dispatches the requests below apiPrefix to the matching route.
+func (h *Handler) api(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+
+	methodMismatch := false
+	for _, route := range h.apiRoutes() {
+		params, ok := matchPattern(route.pattern, path)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			methodMismatch = true
+			continue
+		}
+
+		user := r.Context().Value(contextKeyUser).(models.User)
+		if token := r.Context().Value(contextKeyToken).(models.APIToken); token.ID != 0 {
+			if route.scope == "" {
+				writeAPIError(w, http.StatusForbidden, errSessionOnly)
+				return
+			}
+			if !token.HasScope(route.scope) {
+				writeAPIError(w, http.StatusForbidden, fmt.Errorf("%w: %s", errMissingScope, route.scope))
+				return
+			}
+		}
+
+		status, body, err := route.handler(r, user, params)
+		if err != nil {
+			setRetryAfter(w, err)
+			writeAPIError(w, apiStatus(err), err)
+			return
+		}
+		writeJSON(w, status, body)
+		return
+	}
+
+	if methodMismatch {
+		writeAPIError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	writeAPIError(w, http.StatusNotFound, nil)
+}
+
+// matchPattern matches a request path against a route pattern and returns
+// the captured segments.
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if got[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(segment, "{}")] = got[i]
+			continue
+		}
+		if segment != got[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// sessionToken reads an "Authorization: Bearer" session token, falling back
+// to the session cookie of the browser. A request with a bearer token is
+// never authenticated by the cookie, as it skips the CSRF check.
+func sessionToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie("session_token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+var (
+	errBadJSON       = errors.New("request body must be a valid JSON object")
+	errUnauthorized  = errors.New("authentication required")
+	errBadIdentifier = errors.New("invalid identifier")
+	errSessionOnly   = errors.New("api tokens can't be used for this request")
+	errMissingScope  = errors.New("api token is missing the scope")
+)
+
+// apiErrors maps the errors of the service layer and of request parsing to
+// HTTP statuses and error codes. Anything not listed is an internal error.
+var apiErrors = []struct {
+	err    error
+	status int
+	// code tells API clients the errors apart, it mustn't change.
+	code string
+}{
+	{service.ErrNoPost, http.StatusNotFound, "post_not_found"},
+	{service.ErrNoComment, http.StatusNotFound, "comment_not_found"},
+	{service.ErrNoCategory, http.StatusNotFound, "category_not_found"},
+	{errBadIdentifier, http.StatusNotFound, "bad_identifier"},
+	{errNoProfile, http.StatusNotFound, "profile_not_found"},
+
+	{service.ErrNoToken, http.StatusNotFound, "token_not_found"},
+	{service.ErrNoSession, http.StatusNotFound, "session_not_found"},
+	{service.ErrNoLockout, http.StatusNotFound, "lockout_not_found"},
+	{service.ErrNoPasskey, http.StatusNotFound, "passkey_not_found"},
+	{service.ErrNoUsername, http.StatusNotFound, "user_not_found"},
+
+	{service.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{errSessionOnly, http.StatusForbidden, "session_only"},
+	{errMissingScope, http.StatusForbidden, "missing_scope"},
+	{service.ErrEmailNotVerified, http.StatusForbidden, "email_not_verified"},
+
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{errNotSignedIn, http.StatusUnauthorized, "not_signed_in"},
+	{service.ErrNoUser, http.StatusUnauthorized, "wrong_credentials"},
+	{service.ErrWrongPassword, http.StatusUnauthorized, "wrong_credentials"},
+	{service.ErrSecondFactorRequired, http.StatusUnauthorized, "second_factor_required"},
+	{service.ErrWrongCode, http.StatusUnauthorized, "wrong_code"},
+
+	{service.ErrUsernameTaken, http.StatusConflict, "username_taken"},
+	{service.ErrEmailTaken, http.StatusConflict, "email_taken"},
+	{service.ErrCategoryExists, http.StatusConflict, "category_exists"},
+	{service.ErrTwoFactorEnabled, http.StatusConflict, "two_factor_enabled"},
+	{service.ErrTwoFactorDisabled, http.StatusConflict, "two_factor_disabled"},
+	{service.ErrLastAdmin, http.StatusConflict, "last_admin"},
+
+	{service.ErrTooManyAttempts, http.StatusTooManyRequests, "too_many_attempts"},
+
+	{errBadJSON, http.StatusBadRequest, "bad_json"},
+	{errBadCursor, http.StatusBadRequest, "bad_cursor"},
+	{errBadSort, http.StatusBadRequest, "bad_sort"},
+	{errBadWindow, http.StatusBadRequest, "bad_window"},
+	{errBadDate, http.StatusBadRequest, "bad_date"},
+	{errBadMatchMode, http.StatusBadRequest, "bad_match_mode"},
+	{service.ErrEmptyPost, http.StatusBadRequest, "empty_post"},
+	{service.ErrEmptyComment, http.StatusBadRequest, "empty_comment"},
+	{service.ErrBadFilter, http.StatusBadRequest, "bad_filter"},
+	{service.ErrUnknownCategory, http.StatusBadRequest, "unknown_category"},
+	{service.ErrNoPostCategories, http.StatusBadRequest, "no_post_categories"},
+	{service.ErrInvalidCategory, http.StatusBadRequest, "invalid_category"},
+	{service.ErrCategoryParent, http.StatusBadRequest, "invalid_category_parent"},
+	{service.ErrEmptySearch, http.StatusBadRequest, "empty_search"},
+	{service.ErrInvalidEmail, http.StatusBadRequest, "invalid_email"},
+	{service.ErrInvalidPassword, http.StatusBadRequest, "invalid_password"},
+	{service.ErrInvalidUsername, http.StatusBadRequest, "invalid_username"},
+	{service.ErrInvalidVote, http.StatusBadRequest, "invalid_vote"},
+	{service.ErrInvalidTokenName, http.StatusBadRequest, "invalid_token_name"},
+	{service.ErrInvalidScope, http.StatusBadRequest, "invalid_scope"},
+	{service.ErrInvalidPasskey, http.StatusBadRequest, "invalid_passkey"},
+	{service.ErrInvalidPasskeyName, http.StatusBadRequest, "invalid_passkey_name"},
+	{service.ErrInvalidRole, http.StatusBadRequest, "invalid_role"},
+}
+
+func apiStatus(err error) int {
+	for _, e := range apiErrors {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// apiErrorCode is the code of err in apiErrors, or one made of the status
+// for errors not listed there.
+func apiErrorCode(status int, err error) string {
+	if err != nil && status != http.StatusInternalServerError {
+		for _, e := range apiErrors {
+			if errors.Is(err, e.err) {
+				return e.code
+			}
+		}
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// apiError is the envelope every failed API request answers with.
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	code := apiErrorCode(status, err)
+	msg := http.StatusText(status)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			log.Println(err)
+		} else {
+			msg = err.Error()
+		}
+	}
+
+	writeJSON(w, status, apiError{Error: apiErrorBody{Status: status, Code: code, Message: msg}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("api: encoding response: %s", err)
+	}
+}
+
+// decodeJSON reads a JSON request body into dst, rejecting unknown fields.
+func decodeJSON(r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return errBadJSON
+	}
+	return nil
+}
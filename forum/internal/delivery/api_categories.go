@@ -0,0 +1,97 @@
+package delivery
+
+import (
+	"net/http"
+
+	"forum/internal/models"
+)
+
+type categoryRequest struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Position    int    `json:"position"`
+	ParentID    int    `json:"parent_id"`
+	Archived    bool   `json:"archived"`
+}
+
+func (r categoryRequest) category() models.Category {
+	return models.Category{
+		Slug:        r.Slug,
+		Name:        r.Name,
+		Description: r.Description,
+		Position:    r.Position,
+		ParentID:    r.ParentID,
+		Archived:    r.Archived,
+	}
+}
+
+func (h *Handler) apiCategories(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	categories, err := h.services.Category.Categories()
+	if err != nil {
+		return 0, nil, err
+	}
+	if categories == nil {
+		categories = []models.Category{}
+	}
+	return http.StatusOK, categories, nil
+}
+
+func (h *Handler) apiCategory(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	category, err := h.services.Category.CategoryBySlug(params["slug"])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, category, nil
+}
+
+func (h *Handler) apiCreateCategory(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	var req categoryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.Category.CreateCategory(req.category(), user); err != nil {
+		return 0, nil, err
+	}
+
+	category, err := h.services.Category.CategoryBySlug(req.Slug)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, category, nil
+}
+
+// apiUpdateCategory replaces the name, description, position, parent and
+// archived flag of a category; its slug cannot change.
+func (h *Handler) apiUpdateCategory(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	existing, err := h.services.Category.CategoryBySlug(params["slug"])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req categoryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	category := req.category()
+	category.ID = existing.ID
+	if err := h.services.Category.UpdateCategory(category, user); err != nil {
+		return 0, nil, err
+	}
+
+	updated, err := h.services.Category.CategoryBySlug(existing.Slug)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, updated, nil
+}
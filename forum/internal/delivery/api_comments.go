@@ -0,0 +1,157 @@
+package delivery
+
+import (
+	"net/http"
+	"strconv"
+
+	"forum/internal/models"
+)
+
+type commentRequest struct {
+	Content  string `json:"content"`
+	ParentID int    `json:"parent_id"`
+}
+
+// apiComments returns the comment tree of a post, nested as deep as the
+// site renders it; deeper replies are read with apiCommentThread.
+func (h *Handler) apiComments(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	postID, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := h.services.Post.PostById(postID, user.ID); err != nil {
+		return 0, nil, err
+	}
+
+	comments, err := h.services.Commentary.CommentsByPostID(postID, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+	return http.StatusOK, comments, nil
+}
+
+func (h *Handler) apiCommentThread(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	postID, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+	commentID, err := paramID(params, "commentID")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	comment, err := h.services.Commentary.CommentThread(postID, commentID, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, comment, nil
+}
+
+func (h *Handler) apiCreateComment(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+	postID, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req commentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := h.services.Post.PostById(postID, user.ID); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := h.services.Commentary.CreateComment(models.Comment{
+		PostID:   postID,
+		ParentID: req.ParentID,
+		Content:  req.Content,
+	}, user)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	comment, err := h.services.Commentary.CommentThread(postID, id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, comment, nil
+}
+
+func (h *Handler) apiUpdateComment(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req commentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	postID, err := h.services.Commentary.UpdateComment(models.Comment{ID: id, Content: req.Content}, user)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	comment, err := h.services.Commentary.CommentThread(postID, id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, comment, nil
+}
+
+func (h *Handler) apiDeleteComment(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := h.services.Commentary.DeleteComment(id, user); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// apiReactToComment votes on a comment; repeating the current vote takes it back.
+func (h *Handler) apiReactToComment(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req reactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	postID, err := h.services.Reaction.ReactToComment(id, user.ID, strconv.Itoa(req.Vote))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	comment, err := h.services.Commentary.CommentThread(postID, id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, comment, nil
+}
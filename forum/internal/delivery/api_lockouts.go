@@ -0,0 +1,33 @@
+package delivery
+
+import (
+	"net/http"
+
+	"forum/internal/models"
+)
+
+func (h *Handler) apiLockouts(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	lockouts, err := h.services.LoginGuard.Lockouts(user)
+	if err != nil {
+		return 0, nil, err
+	}
+	if lockouts == nil {
+		lockouts = []models.LoginThrottle{}
+	}
+	return http.StatusOK, lockouts, nil
+}
+
+func (h *Handler) apiUnlock(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.LoginGuard.Unlock(user, params["kind"], params["value"]); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
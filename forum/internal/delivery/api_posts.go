@@ -0,0 +1,236 @@
+package delivery
+
+import (
+	"net/http"
+	"strconv"
+
+	"forum/internal/models"
+)
+
+type postRequest struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Categories []string `json:"categories"`
+}
+
+type reactionRequest struct {
+	Vote int `json:"vote"`
+}
+
+type postList struct {
+	Posts      []models.Post     `json:"posts"`
+	Pagination models.Pagination `json:"pagination"`
+}
+
+type searchList struct {
+	Results []models.SearchResult `json:"results"`
+	// NextPage is the page to ask for to get more results, 0 if there are none.
+	NextPage int `json:"next_page,omitempty"`
+}
+
+// requireUser fails the request when nobody is signed in.
+func requireUser(user models.User) error {
+	if user == (models.User{}) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+func paramID(params map[string]string, key string) (int, error) {
+	id, err := strconv.Atoi(params[key])
+	if err != nil || id <= 0 {
+		return 0, errBadIdentifier
+	}
+	return id, nil
+}
+
+// apiPosts lists posts; it takes the same query parameters as the home page.
+func (h *Handler) apiPosts(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	query := r.URL.Query()
+	page, err := pageFromQuery(query)
+	if err != nil {
+		return 0, nil, err
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if page.Limit, err = strconv.Atoi(limit); err != nil {
+			return 0, nil, errBadCursor
+		}
+	}
+
+	filter, err := filterFromQuery(query, user)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	posts, pagination, err := h.services.Post.Posts(user.ID, filter, page)
+	if err != nil {
+		return 0, nil, err
+	}
+	if posts == nil {
+		posts = []models.Post{}
+	}
+
+	return http.StatusOK, postList{Posts: posts, Pagination: withPageLinks(r, pagination)}, nil
+}
+
+func (h *Handler) apiPost(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	post, err := h.services.Post.PostById(id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, post, nil
+}
+
+func (h *Handler) apiCreatePost(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+	var req postRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := h.services.Post.CreatePost(models.Post{
+		Title:      req.Title,
+		Content:    req.Content,
+		Categories: req.Categories,
+	}, user)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	post, err := h.services.Post.PostById(id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, post, nil
+}
+
+func (h *Handler) apiUpdatePost(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req postRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	err = h.services.Post.UpdatePost(models.Post{
+		ID:         id,
+		Title:      req.Title,
+		Content:    req.Content,
+		Categories: req.Categories,
+	}, user)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	post, err := h.services.Post.PostById(id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, post, nil
+}
+
+func (h *Handler) apiDeletePost(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.Post.DeletePost(id, user); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (h *Handler) apiPostRevisions(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	revisions, err := h.services.Post.PostHistory(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, revisions, nil
+}
+
+// apiReactToPost votes on a post like the buttons of the site do: repeating
+// the current vote takes it back. It answers with the updated post.
+func (h *Handler) apiReactToPost(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var req reactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := h.services.Post.PostById(id, user.ID); err != nil {
+		return 0, nil, err
+	}
+	if err := h.services.Reaction.ReactToPost(id, user.ID, strconv.Itoa(req.Vote)); err != nil {
+		return 0, nil, err
+	}
+
+	post, err := h.services.Post.PostById(id, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, post, nil
+}
+
+// apiSearch takes the q, category, author and page parameters of the search page.
+func (h *Handler) apiSearch(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	query := r.URL.Query()
+	search := models.SearchQuery{
+		Text:     query.Get("q"),
+		Category: query.Get("category"),
+		Author:   query.Get("author"),
+	}
+
+	page := 1
+	if val := query.Get("page"); val != "" {
+		var err error
+		if page, err = strconv.Atoi(val); err != nil || page < 1 {
+			return 0, nil, errBadCursor
+		}
+	}
+
+	results, more, err := h.services.Search.Search(search, page, user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	list := searchList{Results: results}
+	if list.Results == nil {
+		list.Results = []models.SearchResult{}
+	}
+	if more {
+		list.NextPage = page + 1
+	}
+	return http.StatusOK, list, nil
+}
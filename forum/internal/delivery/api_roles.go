@@ -0,0 +1,43 @@
+package delivery
+
+import (
+	"net/http"
+
+	"forum/internal/models"
+)
+
+type roleRequest struct {
+	Role models.Role `json:"role"`
+}
+
+func (h *Handler) apiStaff(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	staff, err := h.services.Roles.Staff(user)
+	if err != nil {
+		return 0, nil, err
+	}
+	if staff == nil {
+		staff = []models.User{}
+	}
+	return http.StatusOK, staff, nil
+}
+
+func (h *Handler) apiSetRole(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	var req roleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	target, err := h.services.Roles.SetRole(user, params["username"], req.Role)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, target, nil
+}
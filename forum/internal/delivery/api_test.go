@@ -0,0 +1,252 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+var errorCode = regexp.MustCompile(`^[a-z]+(_[a-z]+)*$`)
+
+// writtenError returns the error body writeAPIError answers with.
+func writtenError(t *testing.T, status int, err error) apiErrorBody {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	writeAPIError(rec, status, err)
+
+	var body apiError
+	if jsonErr := json.Unmarshal(rec.Body.Bytes(), &body); jsonErr != nil {
+		t.Fatalf("writeAPIError(%d, %v) wrote %q: %v", status, err, rec.Body, jsonErr)
+	}
+	if rec.Code != status || body.Error.Status != status {
+		t.Errorf("writeAPIError(%d, %v) answered %d with status %d", status, err, rec.Code, body.Error.Status)
+	}
+	return body.Error
+}
+
+func TestAPIErrorCodes(t *testing.T) {
+	listed := make(map[error]bool, len(apiErrors))
+	for _, e := range apiErrors {
+		if listed[e.err] {
+			t.Errorf("%q is listed twice", e.err)
+		}
+		listed[e.err] = true
+		if !errorCode.MatchString(e.code) {
+			t.Errorf("%q has the code %q, want snake_case", e.err, e.code)
+		}
+
+		for _, err := range []error{e.err, fmt.Errorf("%w: details", e.err)} {
+			if status := apiStatus(err); status != e.status {
+				t.Errorf("apiStatus(%q) = %d, want %d", err, status, e.status)
+			}
+			if body := writtenError(t, e.status, err); body.Code != e.code || body.Message != err.Error() {
+				t.Errorf("writeAPIError(%q) = %+v, want code %q", err, body, e.code)
+			}
+		}
+	}
+
+	tests := []struct {
+		status int
+		err    error
+		code   string
+	}{
+		{http.StatusNotFound, nil, "not_found"},
+		{http.StatusMethodNotAllowed, nil, "method_not_allowed"},
+		{http.StatusForbidden, errors.New("invalid csrf token"), "forbidden"},
+		{http.StatusInternalServerError, errors.New("database is locked"), "internal_server_error"},
+	}
+	for _, tt := range tests {
+		if body := writtenError(t, tt.status, tt.err); body.Code != tt.code {
+			t.Errorf("writeAPIError(%d, %v) has the code %q, want %q", tt.status, tt.err, body.Code, tt.code)
+		}
+	}
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	alice := models.User{ID: 1, Username: "alice"}
+	h := newTestHandler(t, &service.Service{
+		Authorization: &fakeAuth{sessions: map[string]models.User{"alice-session": alice}},
+		APIToken: &fakeTokens{
+			tokens: map[string]models.APIToken{
+				"fat_read":  {ID: 1, UserID: alice.ID, Scopes: []models.Scope{models.ScopeRead}},
+				"fat_posts": {ID: 2, UserID: alice.ID, Scopes: []models.Scope{models.ScopePosts}},
+			},
+			users: map[int]models.User{alice.ID: alice},
+		},
+	})
+	api := h.middleware(h.api)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		bearer string
+		status int
+		code   string
+	}{
+		{name: "scope granted", method: http.MethodGet, path: "/users/me", bearer: "fat_read", status: http.StatusOK},
+		{name: "scope missing", method: http.MethodGet, path: "/users/me", bearer: "fat_posts", status: http.StatusForbidden, code: "missing_scope"},
+		{name: "write scope missing", method: http.MethodPost, path: "/posts", bearer: "fat_read", status: http.StatusForbidden, code: "missing_scope"},
+		// Tokens can't mint tokens nor reach the admin pages, whatever
+		// their scopes.
+		{name: "tokens", method: http.MethodGet, path: "/tokens", bearer: "fat_read", status: http.StatusForbidden, code: "session_only"},
+		{name: "new token", method: http.MethodPost, path: "/tokens", bearer: "fat_posts", status: http.StatusForbidden, code: "session_only"},
+		{name: "admin roles", method: http.MethodGet, path: "/admin/roles", bearer: "fat_read", status: http.StatusForbidden, code: "session_only"},
+		{name: "admin lockouts", method: http.MethodGet, path: "/admin/lockouts", bearer: "fat_read", status: http.StatusForbidden, code: "session_only"},
+		{name: "revoked token", method: http.MethodGet, path: "/users/me", bearer: "fat_revoked", status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "session token", method: http.MethodGet, path: "/tokens", bearer: "alice-session", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, apiPrefix+tt.path, nil)
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			rec := httptest.NewRecorder()
+			api(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.code == "" {
+				return
+			}
+			var body apiError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body, err)
+			}
+			if body.Error.Code != tt.code {
+				t.Errorf("got code %q, want %q", body.Error.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		params  map[string]string
+		ok      bool
+	}{
+		{"/posts", "/posts", map[string]string{}, true},
+		{"/posts", "posts/", map[string]string{}, true},
+		{"/posts", "/comments", nil, false},
+		{"/posts", "/posts/1", nil, false},
+		{"/posts/{id}", "/posts/1", map[string]string{"id": "1"}, true},
+		{"/posts/{id}", "/posts", nil, false},
+		{"/posts/{id}", "/posts//", nil, false},
+		{"/posts/{id}/comments/{commentID}", "/posts/1/comments/2", map[string]string{"id": "1", "commentID": "2"}, true},
+		{"/posts/{id}/comments/{commentID}", "/posts/1/reactions/2", nil, false},
+		{"/admin/lockouts/{kind}/{value}", "/admin/lockouts/ip/192.0.2.1", map[string]string{"kind": "ip", "value": "192.0.2.1"}, true},
+	}
+	for _, tt := range tests {
+		params, ok := matchPattern(tt.pattern, tt.path)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(params, tt.params)) {
+			t.Errorf("matchPattern(%q, %q) = %v, %t; want %v, %t", tt.pattern, tt.path, params, ok, tt.params, tt.ok)
+		}
+	}
+}
+
+func TestAPIDispatch(t *testing.T) {
+	alice := models.User{ID: 1, Username: "alice", EmailVerified: true}
+	posts := &fakePosts{posts: map[int]models.Post{
+		1: {ID: 1, AuthorID: alice.ID, Author: alice.Username, Title: "Hello", Content: "First post"},
+	}}
+	h := newTestHandler(t, &service.Service{
+		Authorization: &fakeAuth{sessions: map[string]models.User{"alice-session": alice}},
+		Post:          posts,
+	})
+	api := h.middleware(h.api)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		session bool
+		body    string
+		status  int
+		// code is the code of the error envelope; without one the
+		// response is the post with title.
+		code  string
+		title string
+	}{
+		{name: "post", method: http.MethodGet, path: "/posts/1", status: http.StatusOK, title: "Hello"},
+		{name: "trailing slash", method: http.MethodGet, path: "/posts/1/", status: http.StatusOK, title: "Hello"},
+		{name: "unknown post", method: http.MethodGet, path: "/posts/2", status: http.StatusNotFound, code: "post_not_found"},
+		{name: "bad identifier", method: http.MethodGet, path: "/posts/first", status: http.StatusNotFound, code: "bad_identifier"},
+		{name: "unknown route", method: http.MethodGet, path: "/threads/1", status: http.StatusNotFound, code: "not_found"},
+		// The path exists, only not for this method.
+		{name: "wrong method", method: http.MethodPatch, path: "/posts/1", status: http.StatusMethodNotAllowed, code: "method_not_allowed"},
+		{name: "create post", method: http.MethodPost, path: "/posts", session: true, body: `{"title":"Again","content":"Second post","categories":["airplane"]}`, status: http.StatusCreated, title: "Again"},
+		{name: "create anonymously", method: http.MethodPost, path: "/posts", body: `{"title":"Again","content":"Second post"}`, status: http.StatusUnauthorized, code: "unauthorized"},
+		{name: "create empty post", method: http.MethodPost, path: "/posts", session: true, body: `{"title":"","content":""}`, status: http.StatusBadRequest, code: "empty_post"},
+		{name: "unknown field", method: http.MethodPost, path: "/posts", session: true, body: `{"title":"Again","content":"Second post","pinned":true}`, status: http.StatusBadRequest, code: "bad_json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, apiPrefix+tt.path, strings.NewReader(tt.body))
+			if tt.session {
+				r.Header.Set("Authorization", "Bearer alice-session")
+			}
+			rec := httptest.NewRecorder()
+			api(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("got content type %q", ct)
+			}
+
+			if tt.code != "" {
+				var body apiError
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("decoding %q: %v", rec.Body, err)
+				}
+				if body.Error.Status != tt.status || body.Error.Code != tt.code || body.Error.Message == "" {
+					t.Errorf("got error %+v, want status %d and code %q", body.Error, tt.status, tt.code)
+				}
+				return
+			}
+			var post models.Post
+			if err := json.Unmarshal(rec.Body.Bytes(), &post); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body, err)
+			}
+			if post.ID == 0 || post.Title != tt.title || post.Author != alice.Username {
+				t.Errorf("got post %+v, want %q by %s", post, tt.title, alice.Username)
+			}
+		})
+	}
+
+	if len(posts.posts) != 2 {
+		t.Errorf("%d posts, want the one created only", len(posts.posts))
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		body string
+		err  error
+	}{
+		{`{"title":"Hello","content":"First post"}`, nil},
+		{`{"title":"Hello","content":"First post","author_id":2}`, errBadJSON},
+		{`{"title":"Hello",`, errBadJSON},
+		{`["Hello"]`, errBadJSON},
+		{``, errBadJSON},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, apiPrefix+"/posts", strings.NewReader(tt.body))
+		var req postRequest
+		if err := decodeJSON(r, &req); !errors.Is(err, tt.err) {
+			t.Errorf("decodeJSON(%s) = %v, want %v", tt.body, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package delivery
+
+import (
+	"net/http"
+
+	"forum/internal/models"
+)
+
+type tokenRequest struct {
+	Name   string         `json:"name"`
+	Scopes []models.Scope `json:"scopes"`
+}
+
+// createdToken is the only response that carries the token itself.
+type createdToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+func (h *Handler) apiTokens(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	tokens, err := h.services.APIToken.Tokens(user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tokens == nil {
+		tokens = []models.APIToken{}
+	}
+	return http.StatusOK, tokens, nil
+}
+
+func (h *Handler) apiCreateToken(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	var req tokenRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	token, plaintext, err := h.services.APIToken.CreateToken(user.ID, req.Name, req.Scopes)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, createdToken{APIToken: token, Token: plaintext}, nil
+}
+
+func (h *Handler) apiRevokeToken(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.APIToken.RevokeToken(id, user.ID); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"net/http"
+
+	"forum/internal/models"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// recoveryCodes is the only response that carries the recovery codes.
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *Handler) apiTwoFactor(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	status, err := h.services.TwoFactor.TwoFactorStatus(user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, status, nil
+}
+
+func (h *Handler) apiSetupTwoFactor(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	setup, err := h.services.TwoFactor.SetupTwoFactor(user)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, setup, nil
+}
+
+func (h *Handler) apiEnableTwoFactor(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	var req twoFactorCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	codes, err := h.services.TwoFactor.EnableTwoFactor(user, req.Code)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, recoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func (h *Handler) apiDisableTwoFactor(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	var req passwordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.TwoFactor.DisableTwoFactor(user, req.Password, clientIP(r)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
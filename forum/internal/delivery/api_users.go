@@ -0,0 +1,158 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+var errNoProfile = errors.New("user is not found")
+
+type signUpRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type signInRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Remember asks for a long-lived session.
+	Remember bool `json:"remember"`
+	// Code is the second factor of users with two-factor authentication.
+	Code string `json:"code,omitempty"`
+}
+
+func (h *Handler) apiSignUp(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	var req signUpRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	_, err := h.services.Authorization.CreateUser(models.User{
+		Username:        req.Username,
+		Email:           req.Email,
+		Password:        req.Password,
+		ConfirmPassword: req.Password,
+	}, clientIP(r))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	created, err := h.services.Authorization.UserByUsername(req.Username)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, created, nil
+}
+
+func (h *Handler) apiMe(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, user, nil
+}
+
+func (h *Handler) apiResendVerification(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.EmailVerification.ResendVerification(user.Email, clientIP(r)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusAccepted, nil, nil
+}
+
+// apiUserProfile returns the public profile of a user; the email address is only
+// shown to the user themselves.
+func (h *Handler) apiUserProfile(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	profile, err := h.services.Authorization.UserByUsername(params["username"])
+	if errors.Is(err, service.ErrNoUser) {
+		return 0, nil, errNoProfile
+	} else if err != nil {
+		return 0, nil, err
+	}
+	if profile.ID != user.ID {
+		profile.Email = ""
+	}
+	return http.StatusOK, profile, nil
+}
+
+// apiSignIn opens a session; the returned token is sent back as
+// "Authorization: Bearer <token>".
+func (h *Handler) apiSignIn(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	var req signInRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	session, err := h.services.Authorization.SetSession(models.SignInRequest{
+		Username:  req.Username,
+		Password:  req.Password,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Remember:  req.Remember,
+		Code:      req.Code,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, session, nil
+}
+
+// apiSignOut closes the session the request was made with.
+func (h *Handler) apiSignOut(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.Authorization.DeleteSession(sessionToken(r)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (h *Handler) apiSessions(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	sessions, err := h.services.Authorization.Sessions(user.ID, sessionToken(r))
+	if err != nil {
+		return 0, nil, err
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	return http.StatusOK, sessions, nil
+}
+
+func (h *Handler) apiSignOutOthers(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.Authorization.DeleteOtherSessions(user.ID, sessionToken(r)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (h *Handler) apiRevokeSession(r *http.Request, user models.User, params map[string]string) (int, interface{}, error) {
+	if err := requireUser(user); err != nil {
+		return 0, nil, err
+	}
+
+	id, err := paramID(params, "id")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.services.Authorization.DeleteSessionByID(id, user.ID); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
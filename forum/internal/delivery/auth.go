@@ -2,8 +2,10 @@ package delivery
 
 import (
 	"errors"
+	"math"
+	"net"
 	"net/http"
-	"time"
+	"strconv"
 
 	"forum/internal/models"
 	"forum/internal/service"
@@ -15,10 +17,7 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 		data := models.TemplateData{
 			Template: "sign-up",
 		}
-		if err := h.tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			h.errorPage(w, http.StatusInternalServerError, err)
-			return
-		}
+		h.render(w, r, data)
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
 			h.errorPage(w, http.StatusInternalServerError, err)
@@ -42,12 +41,16 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 			ConfirmPassword: confirm[0],
 		}
 
-		if err := h.services.Authorization.CreateUser(user); err != nil {
+		if _, err := h.services.Authorization.CreateUser(user, clientIP(r)); err != nil {
 			if errors.Is(err, service.ErrInvalidEmail) || errors.Is(err, service.ErrInvalidPassword) ||
 				errors.Is(err, service.ErrInvalidUsername) || errors.Is(err, service.ErrUsernameTaken) ||
 				errors.Is(err, service.ErrEmailTaken) {
 				h.errorPage(w, http.StatusBadRequest, err)
 				return
+			} else if errors.Is(err, service.ErrTooManyAttempts) {
+				setRetryAfter(w, err)
+				h.errorPage(w, http.StatusTooManyRequests, err)
+				return
 			} else {
 				h.errorPage(w, http.StatusInternalServerError, err)
 				return
@@ -63,12 +66,10 @@ func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		data := models.TemplateData{
-			Template: "sign-in",
-		}
-		if err := h.tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			h.errorPage(w, http.StatusInternalServerError, err)
-			return
+			Template:     "sign-in",
+			OIDCProvider: h.services.OIDC.OIDCProvider(),
 		}
+		h.render(w, r, data)
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
 			h.errorPage(w, http.StatusInternalServerError, err)
@@ -83,23 +84,39 @@ func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		session, err := h.services.Authorization.SetSession(username[0], password[0])
+		session, err := h.services.Authorization.SetSession(models.SignInRequest{
+			Username:  username[0],
+			Password:  password[0],
+			UserAgent: r.UserAgent(),
+			IP:        clientIP(r),
+			Remember:  r.Form.Get("remember") != "",
+		})
 		if err != nil {
 			if errors.Is(err, service.ErrNoUser) || errors.Is(err, service.ErrWrongPassword) {
 				h.errorPage(w, http.StatusUnauthorized, err)
 				return
+			} else if errors.Is(err, service.ErrTooManyAttempts) {
+				setRetryAfter(w, err)
+				h.errorPage(w, http.StatusTooManyRequests, err)
+				return
+			}
+
+			var secondFactor *service.SecondFactorError
+			if errors.As(err, &secondFactor) {
+				h.setCookie(w, &http.Cookie{
+					Name:   challengeCookie,
+					Value:  secondFactor.Challenge,
+					MaxAge: challengeCookieAge,
+				})
+				http.Redirect(w, r, "/sign-in/two-factor", http.StatusSeeOther)
+				return
 			}
+
 			h.errorPage(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		cookie := &http.Cookie{
-			Name:    "session_token",
-			Value:   session.Token,
-			Path:    "/",
-			Expires: session.ExpirationDate,
-		}
-		http.SetCookie(w, cookie)
+		h.setSessionCookie(w, session)
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	default:
@@ -133,10 +150,41 @@ func (h *Handler) logOut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Expires: time.Now(),
+	h.setCookie(w, &http.Cookie{
+		Name:   "session_token",
+		MaxAge: -1,
 	})
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// setSessionCookie hands the session to the browser. Only persistent
+// sessions get a cookie that outlives the browser; the others end with it
+// or when they expire on the server, whichever comes first.
+func (h *Handler) setSessionCookie(w http.ResponseWriter, session models.Session) {
+	cookie := &http.Cookie{
+		Name:  "session_token",
+		Value: session.Token,
+	}
+	if session.Persistent {
+		cookie.Expires = session.ExpirationDate
+	}
+	h.setCookie(w, cookie)
+}
+
+// clientIP is the address of the peer of the request, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setRetryAfter tells the client how long to wait when err is a throttled
+// sign in or reset request.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var throttled *service.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	}
+}
@@ -0,0 +1,163 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// categoryPage is the landing page of a category: its details followed by
+// the posts filed under it or under one of its subcategories.
+func (h *Handler) categoryPage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+
+	category, err := h.services.Category.CategoryBySlug(strings.TrimPrefix(r.URL.Path, "/c/"))
+	if errors.Is(err, service.ErrNoCategory) {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data := models.TemplateData{
+			Template: "category",
+			Category: category,
+		}
+		h.listing(w, r, user, data, func(filter *models.PostFilter) {
+			filter.Categories = []string{category.Slug}
+			for _, child := range category.Children {
+				filter.Categories = append(filter.Categories, child.Slug)
+			}
+			filter.MatchAll = false
+		})
+	case http.MethodPost:
+		h.reactFromListing(w, r, user)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler) categoriesPage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	categories, err := h.services.Category.Categories()
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template:   "categories",
+		User:       user,
+		Categories: categories,
+	}
+
+	h.render(w, r, data)
+}
+
+// adminCategories lists the categories for administrators, creates them on
+// POST /admin/categories and updates them on POST /admin/categories/{id}.
+func (h *Handler) adminCategories(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+	if !service.CanManageCategories(user) {
+		h.errorPage(w, http.StatusForbidden, service.ErrForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		categories, err := h.services.Category.Categories()
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template:   "admin-categories",
+			User:       user,
+			Categories: categories,
+		}
+
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		category, err := categoryFromForm(r)
+		if err != nil {
+			h.errorPage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if r.URL.Path == "/admin/categories" {
+			err = h.services.Category.CreateCategory(category, user)
+		} else {
+			category.ID, err = IDFromURL(r.URL.Path, "/admin/categories/")
+			if err != nil {
+				h.errorPage(w, http.StatusNotFound, nil)
+				return
+			}
+			err = h.services.Category.UpdateCategory(category, user)
+		}
+
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrNoCategory):
+				h.errorPage(w, http.StatusNotFound, nil)
+			case errors.Is(err, service.ErrForbidden):
+				h.errorPage(w, http.StatusForbidden, err)
+			case errors.Is(err, service.ErrInvalidCategory), errors.Is(err, service.ErrCategoryParent), errors.Is(err, service.ErrCategoryExists):
+				h.errorPage(w, http.StatusBadRequest, err)
+			default:
+				h.errorPage(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func categoryFromForm(r *http.Request) (models.Category, error) {
+	category := models.Category{
+		Slug:        r.Form.Get("slug"),
+		Name:        strings.TrimSpace(r.Form.Get("name")),
+		Description: strings.TrimSpace(r.Form.Get("description")),
+		Archived:    r.Form.Get("archived") != "",
+	}
+
+	for key, dst := range map[string]*int{"position": &category.Position, "parent": &category.ParentID} {
+		val := r.Form.Get(key)
+		if val == "" {
+			continue
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return category, fmt.Errorf("invalid %s", key)
+		}
+		*dst = n
+	}
+
+	return category, nil
+}
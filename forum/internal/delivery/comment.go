@@ -1,11 +1,13 @@
 package delivery
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"forum/internal/models"
+	"forum/internal/service"
 )
 
 func (h *Handler) reactComment(w http.ResponseWriter, r *http.Request) {
@@ -42,9 +44,111 @@ func (h *Handler) reactComment(w http.ResponseWriter, r *http.Request) {
 
 	postID, err := h.services.Reaction.ReactToComment(commentID, user.ID, react[0])
 	if err != nil {
-		h.errorPage(w, http.StatusInternalServerError, err)
+		h.commentError(w, err)
 		return
 	}
 
 	http.Redirect(w, r, fmt.Sprintf("/posts/%v", postID), http.StatusSeeOther)
 }
+
+func (h *Handler) editComment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	commentID, err := IDFromURL(r.URL.Path, "/comment/edit/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, fmt.Errorf("error getting comment ID: %s", err))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		comment, err := h.services.Commentary.CommentByID(commentID, user)
+		if err != nil {
+			h.commentError(w, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template: "edit-comment",
+			User:     user,
+			Comment:  comment,
+		}
+
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		content, ok := r.Form["comment"]
+		if !ok {
+			h.errorPage(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		comment := models.Comment{
+			ID:      commentID,
+			Content: content[0],
+		}
+
+		postID, err := h.services.Commentary.UpdateComment(comment, user)
+		if err != nil {
+			h.commentError(w, err)
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/posts/%v", postID), http.StatusSeeOther)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler) deleteComment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	commentID, err := IDFromURL(r.URL.Path, "/comment/delete/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, fmt.Errorf("error getting comment ID: %s", err))
+		return
+	}
+
+	postID, err := h.services.Commentary.DeleteComment(commentID, user)
+	if err != nil {
+		h.commentError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/posts/%v", postID), http.StatusSeeOther)
+}
+
+func (h *Handler) commentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrNoComment):
+		h.errorPage(w, http.StatusNotFound, nil)
+	case errors.Is(err, service.ErrForbidden):
+		h.errorPage(w, http.StatusForbidden, err)
+	case errors.Is(err, service.ErrEmptyComment), errors.Is(err, service.ErrInvalidVote):
+		h.errorPage(w, http.StatusBadRequest, err)
+	default:
+		h.errorPage(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,97 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	alice := models.User{ID: 1, Username: "alice"}
+	bob := models.User{ID: 2, Username: "bob"}
+	h := newTestHandler(t, &service.Service{
+		Authorization: &fakeAuth{sessions: map[string]models.User{"alice-session": alice, "bob-session": bob}},
+	})
+	page := h.middleware(echoUser)
+	aliceToken := h.signCSRF("session:alice-session")
+	bobToken := h.signCSRF("session:bob-session")
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		status        int
+		user          string
+	}{
+		{name: "missing token", status: http.StatusForbidden},
+		{name: "wrong token", token: "0123456789abcdef", status: http.StatusForbidden},
+		{name: "token of another session", token: bobToken, status: http.StatusForbidden},
+		{name: "basic credentials", authorization: "Basic YWxpY2U6c2VjcmV0", status: http.StatusForbidden},
+		{name: "session token", token: aliceToken, status: http.StatusOK, user: "alice"},
+		// A bearer token stands for the caller alone: the cookie that
+		// comes along with it must not sign them in.
+		{name: "bearer session token", authorization: "Bearer bob-session", status: http.StatusOK, user: "bob"},
+		{name: "unknown bearer token", authorization: "Bearer stale", status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.token != "" {
+				form.Set(csrfField, tt.token)
+			}
+			r := newRequest(http.MethodPost, "/posts/create", form.Encode())
+			r.AddCookie(&http.Cookie{Name: "session_token", Value: "alice-session"})
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			page(rec, r)
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.status)
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != tt.user {
+				t.Errorf("signed in as %q, want %q", rec.Body, tt.user)
+			}
+		})
+	}
+}
+
+func TestCheckCSRFAnonymous(t *testing.T) {
+	h := newTestHandler(t, &service.Service{Authorization: &fakeAuth{}})
+	page := h.middleware(echoUser)
+
+	// The sign in form of an anonymous visitor gets a token bound to a
+	// cookie of their own.
+	rec := httptest.NewRecorder()
+	page(rec, newRequest(http.MethodGet, "/sign-in", ""))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie {
+		t.Fatalf("got cookies %v, want the %s cookie", cookies, csrfCookie)
+	}
+	token := h.signCSRF("anonymous:" + cookies[0].Value)
+
+	for _, tt := range []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"missing token", "", http.StatusForbidden},
+		{"token of another visitor", h.signCSRF("anonymous:other"), http.StatusForbidden},
+		{"visitor token", token, http.StatusNoContent},
+	} {
+		form := url.Values{csrfField: {tt.token}}
+		r := newRequest(http.MethodPost, "/sign-in", form.Encode())
+		r.AddCookie(cookies[0])
+
+		rec := httptest.NewRecorder()
+		page(rec, r)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// devices lists the sessions of the user, one per signed in device.
+func (h *Handler) devices(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	sessions, err := h.services.Authorization.Sessions(user.ID, sessionToken(r))
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template: "devices",
+		User:     user,
+		Sessions: sessions,
+	}
+
+	h.render(w, r, data)
+}
+
+// revokeDevice signs a device out on POST /settings/devices/revoke/{id},
+// or every device but the current one on POST /settings/devices/revoke-others.
+func (h *Handler) revokeDevice(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if r.URL.Path == "/settings/devices/revoke-others" {
+		if err := h.services.Authorization.DeleteOtherSessions(user.ID, sessionToken(r)); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+		http.Redirect(w, r, "/settings/devices", http.StatusSeeOther)
+		return
+	}
+
+	sessionID, err := IDFromURL(r.URL.Path, "/settings/devices/revoke/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	}
+
+	if err := h.services.Authorization.DeleteSessionByID(sessionID, user.ID); errors.Is(err, service.ErrNoSession) {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/devices", http.StatusSeeOther)
+}
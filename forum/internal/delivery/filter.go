@@ -0,0 +1,62 @@
+package delivery
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"forum/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	errBadDate      = errors.New("dates must look like 2006-01-02")
+	errNotSignedIn  = errors.New("sign in to filter by your likes and comments")
+	errBadMatchMode = errors.New("match must be any or all")
+)
+
+// filterFromQuery reads the filter panel of a listing: repeated ?category=
+// with ?match=any|all, ?author=, ?liked=1, ?commented=1, ?images=1 and the
+// ?from= and ?to= dates.
+func filterFromQuery(query url.Values, user models.User) (models.PostFilter, error) {
+	filter := models.PostFilter{
+		Categories: query["category"],
+		Author:     query.Get("author"),
+		HasImages:  query.Get("images") != "",
+	}
+
+	switch query.Get("match") {
+	case "", "any":
+	case "all":
+		filter.MatchAll = true
+	default:
+		return filter, errBadMatchMode
+	}
+
+	if query.Get("liked") != "" || query.Get("commented") != "" {
+		if user == (models.User{}) {
+			return filter, errNotSignedIn
+		}
+		if query.Get("liked") != "" {
+			filter.LikedBy = user.ID
+		}
+		if query.Get("commented") != "" {
+			filter.CommentedBy = user.ID
+		}
+	}
+
+	for key, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		val := query.Get(key)
+		if val == "" {
+			continue
+		}
+		date, err := time.Parse(dateLayout, val)
+		if err != nil {
+			return filter, errBadDate
+		}
+		*dst = date
+	}
+
+	return filter, nil
+}
@@ -4,38 +4,97 @@ import (
 	"html/template"
 	"net/http"
 
+	"forum/internal/config"
+	"forum/internal/models"
 	"forum/internal/service"
 )
 
 type Handler struct {
 	tmpl     *template.Template
 	services *service.Service
+	// openAPI is the OpenAPI document of the JSON API.
+	openAPI []byte
+	// secret keys the CSRF tokens.
+	secret  []byte
+	cookies cookiePolicy
 }
 
-func NewHandler(service *service.Service) *Handler {
-	return &Handler{
-		tmpl:     template.Must(template.ParseGlob("templates/*.html")),
+func NewHandler(service *service.Service, cfg config.Config) *Handler {
+	h := &Handler{
+		tmpl:     template.Must(template.New("").Funcs(templateFuncs).ParseGlob("templates/*.html")),
 		services: service,
+		secret:   cfg.Secret,
+		cookies:  newCookiePolicy(cfg),
 	}
+	h.openAPI = mustOpenAPI(h.apiRoutes())
+	return h
 }
 
-func (h *Handler) InitRoutes() *http.ServeMux {
+func (h *Handler) InitRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", h.middleware(h.homePage))
-	mux.HandleFunc("/sign-up", h.signUp)
-	mux.HandleFunc("/sign-in", h.signIn)
-	mux.HandleFunc("/sign-out", h.logOut)
+	mux.HandleFunc("/sign-up", h.middleware(h.signUp))
+	mux.HandleFunc("/sign-in", h.middleware(h.signIn))
+	mux.HandleFunc("/sign-in/two-factor", h.middleware(h.signInTwoFactor))
+	mux.HandleFunc("/sign-in/oidc", h.middleware(h.oidcSignIn))
+	mux.HandleFunc("/sign-in/oidc/callback", h.middleware(h.oidcCallback))
+	mux.HandleFunc("/passkeys/sign-in/begin", h.middleware(h.beginPasskeySignIn))
+	mux.HandleFunc("/passkeys/sign-in/finish", h.middleware(h.finishPasskeySignIn))
+	mux.HandleFunc("/passkeys/register/begin", h.middleware(h.beginPasskeyRegistration))
+	mux.HandleFunc("/passkeys/register/finish", h.middleware(h.finishPasskeyRegistration))
+	mux.HandleFunc("/sign-out", h.middleware(h.logOut))
+	mux.HandleFunc("/forgot-password", h.middleware(h.forgotPassword))
+	mux.HandleFunc("/reset-password", h.middleware(h.resetPassword))
+	mux.HandleFunc("/verify-email", h.middleware(h.verifyEmail))
+	mux.HandleFunc("/verify-email/resend", h.middleware(h.resendVerification))
 
 	mux.HandleFunc("/posts/", h.middleware(h.postPage))
 	mux.HandleFunc("/posts/create", h.middleware(h.createPost))
 	mux.HandleFunc("/posts/react/", h.middleware(h.reactToPost))
+	mux.HandleFunc("/posts/edit/", h.middleware(h.editPost))
+	mux.HandleFunc("/posts/delete/", h.middleware(h.deletePost))
 	mux.HandleFunc("/my-posts", h.middleware(h.myPosts))
 	mux.HandleFunc("/liked-posts", h.middleware(h.likedPosts))
+	mux.HandleFunc("/search", h.middleware(h.search))
+	mux.HandleFunc("/categories", h.middleware(h.categoriesPage))
+	mux.HandleFunc("/c/", h.middleware(h.categoryPage))
+	mux.HandleFunc("/admin/categories", h.middleware(h.adminCategories))
+	mux.HandleFunc("/admin/categories/", h.middleware(h.adminCategories))
+	mux.HandleFunc("/admin/lockouts", h.middleware(h.adminLockouts))
+	mux.HandleFunc("/admin/lockouts/unlock", h.middleware(h.unlock))
+	mux.HandleFunc("/admin/roles", h.middleware(h.adminRoles))
+	mux.HandleFunc("/admin/roles/set", h.middleware(h.setRole))
+	mux.HandleFunc("/settings", h.middleware(h.settings))
+	mux.HandleFunc("/settings/tokens", h.middleware(h.createToken))
+	mux.HandleFunc("/settings/tokens/revoke/", h.middleware(h.revokeToken))
+	mux.HandleFunc("/settings/devices", h.middleware(h.devices))
+	mux.HandleFunc("/settings/devices/revoke/", h.middleware(h.revokeDevice))
+	mux.HandleFunc("/settings/devices/revoke-others", h.middleware(h.revokeDevice))
+	mux.HandleFunc("/settings/two-factor", h.middleware(h.twoFactor))
+	mux.HandleFunc("/settings/two-factor/setup", h.middleware(h.setupTwoFactor))
+	mux.HandleFunc("/settings/two-factor/enable", h.middleware(h.enableTwoFactor))
+	mux.HandleFunc("/settings/two-factor/disable", h.middleware(h.disableTwoFactor))
+	mux.HandleFunc("/settings/passkeys", h.middleware(h.passkeys))
+	mux.HandleFunc("/settings/passkeys/delete/", h.middleware(h.deletePasskey))
+
+	mux.HandleFunc(apiPrefix+"/", h.middleware(h.api))
+	mux.HandleFunc("/api/openapi.json", h.openAPISpec)
 
 	mux.HandleFunc("/comment/react/", h.middleware(h.reactComment))
+	mux.HandleFunc("/comment/edit/", h.middleware(h.editComment))
+	mux.HandleFunc("/comment/delete/", h.middleware(h.deleteComment))
 
 	mux.Handle("/templates/", http.StripPrefix("/templates", http.FileServer(http.Dir("templates/"))))
 
-	return mux
+	return h.secure(mux)
+}
+
+// render executes the base layout with the CSRF token of the request, which
+// every form of the page sends back.
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, data models.TemplateData) {
+	data.CSRFToken, _ = r.Context().Value(contextKeyCSRF).(string)
+	if err := h.tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+	}
 }
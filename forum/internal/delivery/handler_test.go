@@ -0,0 +1,125 @@
+package delivery
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"forum/internal/config"
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// fakeAuth signs in the users of its sessions map, keyed by session token.
+// TouchSession renews the sessions of its renewed map.
+type fakeAuth struct {
+	service.Authorization
+	sessions map[string]models.User
+	renewed  map[string]models.Session
+}
+
+func (a *fakeAuth) UserByToken(token string) (models.User, error) {
+	return a.sessions[token], nil
+}
+
+func (a *fakeAuth) TouchSession(token, ip string) (models.Session, bool, error) {
+	session, ok := a.renewed[token]
+	return session, ok, nil
+}
+
+// fakeTokens resolves the API tokens of its tokens map; the others are
+// unknown or revoked. Users list no tokens of their own.
+type fakeTokens struct {
+	service.APIToken
+	tokens map[string]models.APIToken
+	users  map[int]models.User
+}
+
+func (s *fakeTokens) UserByAPIToken(token string) (models.User, models.APIToken, error) {
+	t, ok := s.tokens[token]
+	if !ok {
+		return models.User{}, models.APIToken{}, service.ErrInvalidToken
+	}
+	return s.users[t.UserID], t, nil
+}
+
+func (s *fakeTokens) Tokens(userID int) ([]models.APIToken, error) {
+	return nil, nil
+}
+
+// fakePosts serves the posts of its posts map, adding the ones created to
+// it.
+type fakePosts struct {
+	service.Post
+	posts map[int]models.Post
+}
+
+func (s *fakePosts) PostById(postID, userID int) (models.Post, error) {
+	post, ok := s.posts[postID]
+	if !ok {
+		return models.Post{}, service.ErrNoPost
+	}
+	return post, nil
+}
+
+func (s *fakePosts) CheckPost(post models.Post, user models.User) error {
+	if err := service.CanPost(user); err != nil {
+		return err
+	}
+	if post.Title == "" || post.Content == "" {
+		return service.ErrEmptyPost
+	}
+	return nil
+}
+
+func (s *fakePosts) CreatePost(post models.Post, user models.User) (int, error) {
+	if err := s.CheckPost(post, user); err != nil {
+		return 0, err
+	}
+	post.ID = len(s.posts) + 1
+	post.AuthorID = user.ID
+	post.Author = user.Username
+	s.posts[post.ID] = post
+	return post.ID, nil
+}
+
+// newTestHandler returns a handler over services, with the templates of
+// the forum and a fixed secret.
+func newTestHandler(t *testing.T, services *service.Service) *Handler {
+	t.Helper()
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseGlob("../../templates/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{
+		tmpl:     tmpl,
+		services: services,
+		secret:   []byte("secret"),
+		cookies:  newCookiePolicy(config.Config{}),
+	}
+	h.openAPI = mustOpenAPI(h.apiRoutes())
+	return h
+}
+
+// newRequest returns a request with a form body for anything but a GET.
+func newRequest(method, target string, form string) *http.Request {
+	if method == http.MethodGet {
+		return httptest.NewRequest(method, target, nil)
+	}
+	r := httptest.NewRequest(method, target, strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// echoUser is a page answering with the name of the caller, or 204 for
+// anonymous ones.
+func echoUser(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Write([]byte(user.Username))
+}
@@ -1,10 +1,12 @@
 package delivery
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"forum/internal/models"
+	"forum/internal/service"
 )
 
 func (h *Handler) homePage(w http.ResponseWriter, r *http.Request) {
@@ -17,70 +19,98 @@ func (h *Handler) homePage(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		var posts []models.Post
-		if len(r.URL.Query()) == 0 {
-			var err error
-			posts, err = h.services.Post.AllPosts(user.ID)
-			if err != nil {
-				h.errorPage(w, http.StatusInternalServerError, err)
-				return
-			}
-		} else {
-			category := r.URL.Query().Get("category")
-			if category == "" {
-				h.errorPage(w, http.StatusNotFound, nil)
-				return
-			}
-			var err error
-			posts, err = h.services.Post.PostsByCategory(user.ID, category)
-			if err != nil {
-				h.errorPage(w, http.StatusInternalServerError, err)
-				return
-			}
-		}
+		h.listing(w, r, user, models.TemplateData{Template: "index"}, nil)
+	case http.MethodPost:
+		h.reactFromListing(w, r, user)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
 
-		data := models.TemplateData{
-			User:     user,
-			Posts:    posts,
-			Template: "index",
-		}
+// listing renders a page of posts picked by the sort and filter of the
+// query. scope, if given, narrows the filter to the posts the listing is
+// about; data carries whatever else the page shows.
+func (h *Handler) listing(w http.ResponseWriter, r *http.Request, user models.User, data models.TemplateData, scope func(filter *models.PostFilter)) {
+	query := r.URL.Query()
+	page, err := pageFromQuery(query)
+	if err != nil {
+		h.errorPage(w, http.StatusBadRequest, err)
+		return
+	}
 
-		if err := h.tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			h.errorPage(w, http.StatusInternalServerError, err)
-			return
-		}
-	case http.MethodPost:
-		if user == (models.User{}) {
-			h.errorPage(w, http.StatusUnauthorized, nil)
-			return
-		}
+	filter, err := filterFromQuery(query, user)
+	if errors.Is(err, errNotSignedIn) {
+		h.errorPage(w, http.StatusUnauthorized, err)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusBadRequest, err)
+		return
+	}
+	if scope != nil {
+		scope(&filter)
+	}
 
-		if err := r.ParseForm(); err != nil {
-			h.errorPage(w, http.StatusInternalServerError, err)
-			return
-		}
+	posts, pagination, err := h.services.Post.Posts(user.ID, filter, page)
+	if errors.Is(err, service.ErrBadFilter) {
+		h.errorPage(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	categories, err := h.services.Category.Categories()
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
 
-		postID, ok1 := r.Form["postID"]
-		react, ok2 := r.Form["react"]
+	data.User = user
+	data.Posts = posts
+	data.Pagination = withPageLinks(r, pagination)
+	data.Sorts = sortLinks(r, page)
+	data.Windows = windowLinks(r, page)
+	data.Filter = filter
+	data.Categories = categories
 
-		if !ok1 || !ok2 {
-			h.errorPage(w, http.StatusBadRequest, nil)
-			return
-		}
+	h.render(w, r, data)
+}
 
-		id, err := strconv.Atoi(postID[0])
-		if err != nil {
-			h.errorPage(w, http.StatusInternalServerError, nil)
-			return
-		}
+// reactFromListing handles the like and dislike buttons of a post card and
+// sends the user back to the listing they were browsing.
+func (h *Handler) reactFromListing(w http.ResponseWriter, r *http.Request, user models.User) {
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
 
-		if err := h.services.Reaction.ReactToPost(id, user.ID, react[0]); err != nil {
-			h.errorPage(w, http.StatusInternalServerError, nil)
+	postID, ok1 := r.Form["postID"]
+	react, ok2 := r.Form["react"]
+
+	if !ok1 || !ok2 {
+		h.errorPage(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	id, err := strconv.Atoi(postID[0])
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	if err := h.services.Reaction.ReactToPost(id, user.ID, react[0]); err != nil {
+		if errors.Is(err, service.ErrInvalidVote) {
+			h.errorPage(w, http.StatusBadRequest, err)
 			return
 		}
-
-		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
-	default:
-		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		h.errorPage(w, http.StatusInternalServerError, nil)
+		return
 	}
+
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
 }
@@ -0,0 +1,73 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// adminLockouts lists the accounts and addresses locked out of signing in
+// after too many failed attempts.
+func (h *Handler) adminLockouts(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	lockouts, err := h.services.LoginGuard.Lockouts(user)
+	if errors.Is(err, service.ErrForbidden) {
+		h.errorPage(w, http.StatusForbidden, err)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template: "admin-lockouts",
+		User:     user,
+		Lockouts: lockouts,
+	}
+
+	h.render(w, r, data)
+}
+
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.services.LoginGuard.Unlock(user, r.Form.Get("kind"), r.Form.Get("value")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrNoLockout):
+			h.errorPage(w, http.StatusNotFound, nil)
+		case errors.Is(err, service.ErrForbidden):
+			h.errorPage(w, http.StatusForbidden, err)
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
+}
@@ -2,32 +2,106 @@ package delivery
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 
 	"forum/internal/models"
+	"forum/internal/service"
 )
 
-const contextKeyUser contextKey = "user"
+const (
+	contextKeyUser  contextKey = "user"
+	contextKeyToken contextKey = "token"
+	contextKeyCSRF  contextKey = "csrf"
+)
 
 type contextKey string
 
+var errTokenReadOnly = errors.New("api tokens can only read pages, use the JSON API to make changes")
+
+// middleware resolves the caller from an "Authorization: Bearer" header,
+// holding either a personal API token or a session token, or else from the
+// session cookie. It also checks the CSRF token of state-changing requests
+// made by browsers.
 func (h *Handler) middleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_token")
-		var user models.User
-		switch err {
-		case http.ErrNoCookie:
-			user = models.User{}
-		case nil:
-			user, err = h.services.Authorization.UserByToken(cookie.Value)
-			if err != nil {
-				fmt.Printf("user by token: %s\n", err)
+		user, token, err := h.authenticate(w, r)
+		if errors.Is(err, service.ErrInvalidToken) {
+			h.fail(w, r, http.StatusUnauthorized, err)
+			return
+		} else if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Only the JSON API checks the scopes of a token for each route.
+		if token.ID != 0 && !isAPIRequest(r) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !token.HasScope(models.ScopeRead) {
+				h.fail(w, r, http.StatusForbidden, errTokenReadOnly)
+				return
+			}
+		}
+
+		// Anonymous API calls carry no cookie a forged request could ride on.
+		var csrf string
+		if !isAPIRequest(r) || user.ID != 0 {
+			csrf = h.csrfToken(w, r, user.ID != 0)
+			if err := checkCSRF(r, csrf); err != nil {
+				h.fail(w, r, http.StatusForbidden, err)
+				return
+			}
+			if isAPIRequest(r) && csrf != "" {
+				w.Header().Set(csrfHeader, csrf)
 			}
-		default:
-			h.errorPage(w, http.StatusBadRequest, err)
 		}
+
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeyToken, token)
+		ctx = context.WithValue(ctx, contextKeyCSRF, csrf)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// authenticate returns the caller of the request, and the API token it
+// was made with if any. A persistent session renewed on the way gets its
+// cookie extended too.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (models.User, models.APIToken, error) {
+	if bearer := bearerToken(r); strings.HasPrefix(bearer, models.APITokenPrefix) {
+		return h.services.APIToken.UserByAPIToken(bearer)
+	}
+
+	token := sessionToken(r)
+	if token == "" {
+		return models.User{}, models.APIToken{}, nil
+	}
+
+	// Stale and unknown tokens are no error: the caller is anonymous.
+	user, err := h.services.Authorization.UserByToken(token)
+	if err != nil {
+		return models.User{}, models.APIToken{}, err
+	}
+	if user.ID != 0 {
+		session, renewed, err := h.services.Authorization.TouchSession(token, clientIP(r))
+		if err != nil {
+			log.Printf("touch session: %s", err)
+		} else if renewed && session.Persistent && bearerToken(r) == "" {
+			h.setSessionCookie(w, session)
+		}
+	}
+	return user, models.APIToken{}, nil
+}
+
+// fail reports an error as JSON to API clients and as a page to browsers.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if isAPIRequest(r) {
+		writeAPIError(w, status, err)
+		return
+	}
+	h.errorPage(w, status, err)
+}
+
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiPrefix+"/")
+}
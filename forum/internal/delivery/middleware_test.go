@@ -0,0 +1,116 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+func TestRenewedSessionCookie(t *testing.T) {
+	alice := models.User{ID: 1, Username: "alice"}
+	expires := time.Now().Add(time.Hour * 24 * 30).UTC().Truncate(time.Second)
+	h := newTestHandler(t, &service.Service{
+		Authorization: &fakeAuth{
+			sessions: map[string]models.User{"remembered": alice, "browser": alice, "fresh": alice},
+			renewed: map[string]models.Session{
+				"remembered": {Token: "remembered", ExpirationDate: expires, Persistent: true},
+				"browser":    {Token: "browser", ExpirationDate: expires},
+			},
+		},
+	})
+	page := h.middleware(echoUser)
+
+	tests := []struct {
+		name   string
+		token  string
+		bearer bool
+		cookie bool
+	}{
+		{name: "renewed remembered session", token: "remembered", cookie: true},
+		// A session cookie lasts as long as the browser: nothing to extend.
+		{name: "renewed browser session", token: "browser"},
+		{name: "session not renewed", token: "fresh"},
+		{name: "renewed bearer session", token: "remembered", bearer: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(http.MethodGet, "/", "")
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			} else {
+				r.AddCookie(&http.Cookie{Name: "session_token", Value: tt.token})
+			}
+
+			rec := httptest.NewRecorder()
+			page(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var session *http.Cookie
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == "session_token" {
+					session = cookie
+				}
+			}
+			if !tt.cookie {
+				if session != nil {
+					t.Errorf("session cookie set: %v", session)
+				}
+				return
+			}
+			if session == nil || session.Value != tt.token || !session.Expires.Equal(expires) {
+				t.Errorf("session cookie %v, want %s until %s", session, tt.token, expires)
+			}
+		})
+	}
+}
+
+func TestAPITokenOnPages(t *testing.T) {
+	alice := models.User{ID: 1, Username: "alice"}
+	h := newTestHandler(t, &service.Service{
+		Authorization: &fakeAuth{},
+		APIToken: &fakeTokens{
+			tokens: map[string]models.APIToken{
+				"fat_all":   {ID: 1, UserID: alice.ID, Scopes: models.Scopes},
+				"fat_posts": {ID: 2, UserID: alice.ID, Scopes: []models.Scope{models.ScopePosts}},
+			},
+			users: map[int]models.User{alice.ID: alice},
+		},
+	})
+	page := h.middleware(echoUser)
+
+	tests := []struct {
+		name   string
+		method string
+		bearer string
+		status int
+	}{
+		{name: "read", method: http.MethodGet, bearer: "fat_all", status: http.StatusOK},
+		{name: "read without the scope", method: http.MethodGet, bearer: "fat_posts", status: http.StatusForbidden},
+		// Pages have no scopes of their own: a token may only read them,
+		// even one allowed to write posts through the API.
+		{name: "post", method: http.MethodPost, bearer: "fat_all", status: http.StatusForbidden},
+		{name: "post with the write scope", method: http.MethodPost, bearer: "fat_posts", status: http.StatusForbidden},
+		{name: "revoked token", method: http.MethodGet, bearer: "fat_revoked", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(tt.method, "/posts/create", "title=t&content=c")
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			rec := httptest.NewRecorder()
+			page(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.status)
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != alice.Username {
+				t.Errorf("signed in as %q, want %q", rec.Body, alice.Username)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package delivery
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+const (
+	// oidcStateCookie ties the answer of the identity provider to the
+	// browser that was sent there.
+	oidcStateCookie    = "oidc_state"
+	oidcStateCookieAge = 10 * 60
+)
+
+// oidcSignIn sends the browser to the identity provider. It is a link
+// rather than a form: the Content-Security-Policy keeps forms from
+// redirecting to another origin.
+func (h *Handler) oidcSignIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	state, authURL, err := h.services.OIDC.BeginOIDCSignIn(r.URL.Query().Get("remember") != "")
+	if err != nil {
+		h.oidcError(w, err)
+		return
+	}
+
+	// The provider sends the browser back from another site, which a
+	// Strict cookie wouldn't survive.
+	h.setCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		MaxAge:   oidcStateCookieAge,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// oidcCallback signs in the user the identity provider sent back.
+func (h *Handler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	query := r.URL.Query()
+	state, code := query.Get("state"), query.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	h.setCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err != nil || state == "" || code == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		h.errorPage(w, http.StatusBadRequest, service.ErrInvalidOIDCLogin)
+		return
+	}
+
+	session, err := h.services.Authorization.SignInWithOIDC(state, code, models.SignInRequest{
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	})
+	if err != nil {
+		h.oidcError(w, err)
+		return
+	}
+
+	h.setSessionCookie(w, session)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (h *Handler) oidcError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrOIDCDisabled):
+		h.errorPage(w, http.StatusNotFound, nil)
+	case errors.Is(err, service.ErrInvalidOIDCLogin), errors.Is(err, service.ErrOIDCNoEmail):
+		h.errorPage(w, http.StatusBadRequest, err)
+	case errors.Is(err, service.ErrOIDCEmailTaken):
+		h.errorPage(w, http.StatusConflict, err)
+	case errors.Is(err, service.ErrOIDCUnavailable):
+		h.errorPage(w, http.StatusBadGateway, err)
+	default:
+		h.errorPage(w, http.StatusInternalServerError, err)
+	}
+}
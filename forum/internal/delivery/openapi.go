@@ -0,0 +1,408 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+)
+
+// apiDoc describes one route of apiRoutes in the OpenAPI document.
+type apiDoc struct {
+	summary string
+	query   []apiParam
+	// request and response are values of the types of the JSON bodies,
+	// nil when there is none.
+	request  interface{}
+	response interface{}
+	status   int
+}
+
+type apiParam struct {
+	name        string
+	kind        string
+	description string
+	// repeated parameters may be given several times.
+	repeated bool
+}
+
+var listingParams = []apiParam{
+	{name: "sort", kind: "string", description: "new, top, hot or controversial"},
+	{name: "t", kind: "string", description: "time window of the listing: day, week, month or all"},
+	{name: "after", kind: "string", description: "cursor to list the next page after, as given by pagination.next"},
+	{name: "before", kind: "string", description: "cursor to list the previous page before, as given by pagination.prev"},
+	{name: "limit", kind: "integer", description: "number of posts per page"},
+	{name: "category", kind: "string", description: "category slug", repeated: true},
+	{name: "match", kind: "string", description: "any or all of the categories"},
+	{name: "author", kind: "string", description: "username of the author"},
+	{name: "liked", kind: "string", description: "only posts the caller liked"},
+	{name: "commented", kind: "string", description: "only posts the caller commented"},
+	{name: "images", kind: "string", description: "only posts with images"},
+	{name: "from", kind: "string", description: "earliest creation date, YYYY-MM-DD"},
+	{name: "to", kind: "string", description: "latest creation date, YYYY-MM-DD"},
+}
+
+var searchParams = []apiParam{
+	{name: "q", kind: "string", description: "search terms"},
+	{name: "category", kind: "string", description: "category slug"},
+	{name: "author", kind: "string", description: "username of the author"},
+	{name: "page", kind: "integer", description: "page of results, from 1"},
+}
+
+// apiDocs is keyed by the method and the pattern of a route. Every route
+// must be described here: TestOpenAPIDescribesEveryRoute fails and
+// NewHandler refuses to start otherwise.
+var apiDocs = map[string]apiDoc{
+	"POST /sessions":           {summary: "Sign in", request: signInRequest{}, response: models.Session{}, status: http.StatusCreated},
+	"GET /sessions":            {summary: "List the signed in devices of the user", response: []models.Session{}, status: http.StatusOK},
+	"DELETE /sessions/current": {summary: "Sign out of the current session", status: http.StatusNoContent},
+	"DELETE /sessions/others":  {summary: "Sign out of every other session", status: http.StatusNoContent},
+	"DELETE /sessions/{id}":    {summary: "Sign out of a session", status: http.StatusNoContent},
+
+	"POST /users":                 {summary: "Sign up", request: signUpRequest{}, response: models.User{}, status: http.StatusCreated},
+	"GET /users/me":               {summary: "The signed in user", response: models.User{}, status: http.StatusOK},
+	"POST /users/me/verification": {summary: "Mail a new email confirmation link to the user", status: http.StatusAccepted},
+	"GET /users/{username}":       {summary: "Public profile of a user", response: models.User{}, status: http.StatusOK},
+
+	"GET /posts":                           {summary: "List posts", query: listingParams, response: postList{}, status: http.StatusOK},
+	"POST /posts":                          {summary: "Create a post", request: postRequest{}, response: models.Post{}, status: http.StatusCreated},
+	"GET /posts/{id}":                      {summary: "Get a post", response: models.Post{}, status: http.StatusOK},
+	"PUT /posts/{id}":                      {summary: "Edit a post", request: postRequest{}, response: models.Post{}, status: http.StatusOK},
+	"DELETE /posts/{id}":                   {summary: "Delete a post", status: http.StatusNoContent},
+	"GET /posts/{id}/revisions":            {summary: "Edit history of a post", response: []models.Revision{}, status: http.StatusOK},
+	"POST /posts/{id}/reactions":           {summary: "Like (1) or dislike (-1) a post", request: reactionRequest{}, response: models.Post{}, status: http.StatusOK},
+	"GET /posts/{id}/comments":             {summary: "Comment tree of a post", response: []models.Comment{}, status: http.StatusOK},
+	"POST /posts/{id}/comments":            {summary: "Comment on a post or reply to a comment", request: commentRequest{}, response: models.Comment{}, status: http.StatusCreated},
+	"GET /posts/{id}/comments/{commentID}": {summary: "A comment with its replies", response: models.Comment{}, status: http.StatusOK},
+
+	"PUT /comments/{id}":            {summary: "Edit a comment", request: commentRequest{}, response: models.Comment{}, status: http.StatusOK},
+	"DELETE /comments/{id}":         {summary: "Delete a comment", status: http.StatusNoContent},
+	"POST /comments/{id}/reactions": {summary: "Like (1) or dislike (-1) a comment", request: reactionRequest{}, response: models.Comment{}, status: http.StatusOK},
+
+	"GET /categories":        {summary: "List categories", response: []models.Category{}, status: http.StatusOK},
+	"POST /categories":       {summary: "Create a category", request: categoryRequest{}, response: models.Category{}, status: http.StatusCreated},
+	"GET /categories/{slug}": {summary: "Get a category with its subcategories", response: models.Category{}, status: http.StatusOK},
+	"PUT /categories/{slug}": {summary: "Edit a category", request: categoryRequest{}, response: models.Category{}, status: http.StatusOK},
+
+	"GET /search": {summary: "Full-text search of posts and comments", query: searchParams, response: searchList{}, status: http.StatusOK},
+
+	"GET /tokens":         {summary: "List the API tokens of the user", response: []models.APIToken{}, status: http.StatusOK},
+	"POST /tokens":        {summary: "Mint an API token", request: tokenRequest{}, response: createdToken{}, status: http.StatusCreated},
+	"DELETE /tokens/{id}": {summary: "Revoke an API token", status: http.StatusNoContent},
+
+	"GET /two-factor":          {summary: "Whether two-factor authentication is on for the user", response: models.TwoFactorStatus{}, status: http.StatusOK},
+	"POST /two-factor/setup":   {summary: "Start setting up an authenticator app", response: models.TwoFactorSetup{}, status: http.StatusOK},
+	"POST /two-factor/enable":  {summary: "Turn two-factor authentication on with a first code", request: twoFactorCodeRequest{}, response: recoveryCodes{}, status: http.StatusOK},
+	"POST /two-factor/disable": {summary: "Turn two-factor authentication off", request: passwordRequest{}, status: http.StatusNoContent},
+
+	"GET /admin/lockouts":                   {summary: "List the accounts and addresses locked out of signing in", response: []models.LoginThrottle{}, status: http.StatusOK},
+	"DELETE /admin/lockouts/{kind}/{value}": {summary: "Lift a sign in lockout", status: http.StatusNoContent},
+
+	"GET /admin/roles":            {summary: "List the moderators and admins", response: []models.User{}, status: http.StatusOK},
+	"PUT /admin/roles/{username}": {summary: "Change the role of a user", request: roleRequest{}, response: models.User{}, status: http.StatusOK},
+}
+
+// mustOpenAPI builds the OpenAPI document of the routes, panicking when it
+// is out of sync with them.
+func mustOpenAPI(routes []apiRoute) []byte {
+	spec, err := buildOpenAPI(routes)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+func buildOpenAPI(routes []apiRoute) ([]byte, error) {
+	schemas := newSchemaSet()
+	paths := make(map[string]map[string]interface{})
+	described := make(map[string]bool, len(routes))
+
+	for _, route := range routes {
+		key := route.method + " " + route.pattern
+		doc, ok := apiDocs[key]
+		if !ok {
+			return nil, fmt.Errorf("openapi: route %s is not described in apiDocs", key)
+		}
+		if doc.summary == "" || doc.status == 0 {
+			return nil, fmt.Errorf("openapi: route %s needs a summary and a status", key)
+		}
+		described[key] = true
+
+		op, err := operation(route, doc, schemas)
+		if err != nil {
+			return nil, err
+		}
+		if paths[route.pattern] == nil {
+			paths[route.pattern] = make(map[string]interface{})
+		}
+		paths[route.pattern][strings.ToLower(route.method)] = op
+	}
+
+	for key := range apiDocs {
+		if !described[key] {
+			return nil, fmt.Errorf("openapi: %s is described but has no route", key)
+		}
+	}
+
+	errorSchema, err := schemas.of(reflect.TypeOf(apiError{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Forum API",
+			"version": "1",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "The request failed, error.code tells why",
+					"content":     jsonContent(errorSchema),
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal API token, or a session token from POST /sessions",
+				},
+				"cookie": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "session_token",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"cookie": []string{}},
+			map[string]interface{}{},
+		},
+	}, "", "  ")
+}
+
+func operation(route apiRoute, doc apiDoc, schemas *schemaSet) (map[string]interface{}, error) {
+	description := "API tokens can't call this endpoint, it needs a session."
+	if route.scope != "" {
+		description = fmt.Sprintf("API tokens need the %s scope.", route.scope)
+	}
+
+	var params []interface{}
+	for _, segment := range strings.Split(route.pattern, "/") {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		kind := "string"
+		if name == "id" || strings.HasSuffix(name, "ID") {
+			kind = "integer"
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": kind},
+		})
+	}
+	for _, p := range doc.query {
+		var schema interface{} = map[string]interface{}{"type": p.kind}
+		if p.repeated {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+		params = append(params, map[string]interface{}{
+			"name":        p.name,
+			"in":          "query",
+			"description": p.description,
+			"schema":      schema,
+		})
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(doc.status)}
+	if doc.response != nil {
+		schema, err := schemas.of(reflect.TypeOf(doc.response))
+		if err != nil {
+			return nil, err
+		}
+		success["content"] = jsonContent(schema)
+	}
+
+	op := map[string]interface{}{
+		"operationId":   operationID(route.handler),
+		"summary":       doc.summary,
+		"description":   description,
+		"x-token-scope": route.scope,
+		"responses": map[string]interface{}{
+			fmt.Sprint(doc.status): success,
+			"default":              map[string]interface{}{"$ref": "#/components/responses/Error"},
+		},
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+	if doc.request != nil {
+		schema, err := schemas.of(reflect.TypeOf(doc.request))
+		if err != nil {
+			return nil, err
+		}
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(schema),
+		}
+	}
+	return op, nil
+}
+
+// operationID names an operation after its handler: apiCreatePost
+// becomes createPost.
+func operationID(handler apiHandler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	name = strings.TrimPrefix(name, "api")
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemaSet collects the component schemas of the structs sent over the
+// API, derived from their fields and json tags.
+type schemaSet struct {
+	schemas map[string]interface{}
+	types   map[string]reflect.Type
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{
+		schemas: make(map[string]interface{}),
+		types:   make(map[string]reflect.Type),
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *schemaSet) of(t reflect.Type) (map[string]interface{}, error) {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := s.of(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		values, err := s.of(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if other, ok := s.types[name]; ok {
+			if other != t {
+				return nil, fmt.Errorf("openapi: %s and %s have the same schema name", other, t)
+			}
+		} else {
+			// Registered before the fields are walked, so that recursive
+			// types such as models.Comment refer to themselves.
+			s.types[name] = t
+			schema, err := s.object(t)
+			if err != nil {
+				return nil, err
+			}
+			s.schemas[name] = schema
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}, nil
+	}
+	return nil, fmt.Errorf("openapi: can't describe %s", t)
+}
+
+func (s *schemaSet) object(t reflect.Type) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	var required []string
+
+	if err := s.fields(t, properties, &required); err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// fields adds the properties encoding/json writes for the fields of t,
+// flattening embedded structs the same way.
+func (s *schemaSet) fields(t reflect.Type, properties map[string]interface{}, required *[]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := s.fields(field.Type, properties, required); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema, err := s.of(field.Type)
+		if err != nil {
+			return err
+		}
+		properties[name] = schema
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) openAPISpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(h.openAPI)
+}
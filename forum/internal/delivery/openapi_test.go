@@ -0,0 +1,292 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIDescribesEveryRoute fails when a route is added to apiRoutes
+// without being described in apiDocs, or the other way around, and checks
+// the document follows the structure of OpenAPI 3.
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	h := &Handler{}
+	routes := h.apiRoutes()
+
+	spec, err := buildOpenAPI(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		key := route.method + " " + route.pattern
+		if keys[key] {
+			t.Errorf("route %s is listed twice", key)
+		}
+		keys[key] = true
+	}
+	for key := range apiDocs {
+		if !keys[key] {
+			t.Errorf("apiDocs describes %s, which has no route", key)
+		}
+	}
+
+	undescribed := append(routes[:len(routes):len(routes)], apiRoute{http.MethodGet, "/undescribed", "", h.apiMe})
+	if _, err := buildOpenAPI(undescribed); err == nil {
+		t.Error("buildOpenAPI accepted a route missing from apiDocs")
+	}
+	if _, err := buildOpenAPI(routes[1:]); err == nil {
+		t.Errorf("buildOpenAPI accepted apiDocs describing %s %s without a route", routes[0].method, routes[0].pattern)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("the document isn't JSON: %v", err)
+	}
+	(&openAPIChecker{t: t, doc: doc}).check()
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	operations := 0
+	for _, item := range paths {
+		operations += len(item.(map[string]interface{}))
+	}
+	if operations != len(routes) {
+		t.Errorf("the document has %d operations, want one per route: %d", operations, len(routes))
+	}
+}
+
+// openAPIChecker checks a document against the structure of the OpenAPI
+// 3.0 specification (https://spec.openapis.org/oas/v3.0.3), as far as the
+// forum's documents use it.
+type openAPIChecker struct {
+	t            *testing.T
+	doc          map[string]interface{}
+	operationIDs map[string]string
+}
+
+var (
+	statusKey    = regexp.MustCompile(`^([1-5][0-9][0-9]|default)$`)
+	pathParam    = regexp.MustCompile(`\{([^{}/]+)\}`)
+	httpMethods  = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "options": true, "head": true, "patch": true, "trace": true}
+	schemaTypes  = map[string]bool{"string": true, "integer": true, "number": true, "boolean": true, "array": true, "object": true}
+	paramIn      = map[string]bool{"path": true, "query": true, "header": true, "cookie": true}
+	securityType = map[string]bool{"apiKey": true, "http": true, "oauth2": true, "openIdConnect": true}
+)
+
+func (c *openAPIChecker) errorf(at, format string, args ...interface{}) {
+	c.t.Helper()
+	c.t.Errorf(at+": "+format, args...)
+}
+
+func (c *openAPIChecker) object(at string, v interface{}) map[string]interface{} {
+	c.t.Helper()
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		c.errorf(at, "want an object, got %T", v)
+	}
+	return m
+}
+
+func (c *openAPIChecker) str(at string, v interface{}) string {
+	c.t.Helper()
+	s, ok := v.(string)
+	if !ok || s == "" {
+		c.errorf(at, "want a non-empty string, got %#v", v)
+	}
+	return s
+}
+
+func (c *openAPIChecker) check() {
+	if v := c.str("openapi", c.doc["openapi"]); !strings.HasPrefix(v, "3.0.") {
+		c.errorf("openapi", "version %q isn't 3.0.x", v)
+	}
+	info := c.object("info", c.doc["info"])
+	c.str("info.title", info["title"])
+	c.str("info.version", info["version"])
+
+	for i, server := range c.doc["servers"].([]interface{}) {
+		c.str(fmt.Sprintf("servers[%d].url", i), c.object("servers", server)["url"])
+	}
+
+	components := c.object("components", c.doc["components"])
+	schemes := c.object("components.securitySchemes", components["securitySchemes"])
+	for name, scheme := range schemes {
+		at := "components.securitySchemes." + name
+		if typ := c.str(at+".type", c.object(at, scheme)["type"]); !securityType[typ] {
+			c.errorf(at, "unknown type %q", typ)
+		}
+	}
+	for _, requirement := range c.doc["security"].([]interface{}) {
+		for name := range c.object("security", requirement) {
+			if schemes[name] == nil {
+				c.errorf("security", "unknown scheme %q", name)
+			}
+		}
+	}
+	for name, schema := range c.object("components.schemas", components["schemas"]) {
+		c.schema("components.schemas."+name, schema)
+	}
+	for name, response := range c.object("components.responses", components["responses"]) {
+		c.response("components.responses."+name, response)
+	}
+
+	c.operationIDs = make(map[string]string)
+	paths := c.object("paths", c.doc["paths"])
+	if len(paths) == 0 {
+		c.errorf("paths", "no paths")
+	}
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+	for _, path := range names {
+		if !strings.HasPrefix(path, "/") {
+			c.errorf("paths", "%q doesn't start with /", path)
+		}
+		for method, op := range c.object("paths."+path, paths[path]) {
+			if !httpMethods[method] {
+				c.errorf("paths."+path, "unknown method %q", method)
+				continue
+			}
+			c.operation(path, method, c.object(path+" "+method, op))
+		}
+	}
+}
+
+func (c *openAPIChecker) operation(path, method string, op map[string]interface{}) {
+	at := method + " " + path
+	id := c.str(at+".operationId", op["operationId"])
+	if other, ok := c.operationIDs[id]; ok {
+		c.errorf(at, "operationId %q is also used by %s", id, other)
+	}
+	c.operationIDs[id] = at
+	c.str(at+".summary", op["summary"])
+
+	want := make(map[string]bool)
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		want[m[1]] = true
+	}
+	seen := make(map[string]bool)
+	if params, ok := op["parameters"]; ok {
+		for _, p := range params.([]interface{}) {
+			param := c.object(at+".parameters", p)
+			name := c.str(at+".parameters.name", param["name"])
+			in := c.str(at+".parameters."+name+".in", param["in"])
+			if !paramIn[in] {
+				c.errorf(at, "parameter %s is in %q", name, in)
+			}
+			if seen[in+" "+name] {
+				c.errorf(at, "parameter %s is listed twice", name)
+			}
+			seen[in+" "+name] = true
+			if in == "path" {
+				if !want[name] {
+					c.errorf(at, "path parameter %s isn't in the path", name)
+				}
+				if param["required"] != true {
+					c.errorf(at, "path parameter %s isn't required", name)
+				}
+				delete(want, name)
+			}
+			c.schema(at+".parameters."+name+".schema", param["schema"])
+		}
+	}
+	for name := range want {
+		c.errorf(at, "path parameter %s isn't described", name)
+	}
+
+	if body, ok := op["requestBody"]; ok {
+		c.content(at+".requestBody", c.object(at+".requestBody", body)["content"])
+	}
+
+	responses := c.object(at+".responses", op["responses"])
+	if len(responses) == 0 {
+		c.errorf(at, "no responses")
+	}
+	for status, response := range responses {
+		if !statusKey.MatchString(status) {
+			c.errorf(at+".responses", "bad status %q", status)
+		}
+		c.response(at+".responses."+status, response)
+	}
+}
+
+func (c *openAPIChecker) response(at string, v interface{}) {
+	response := c.object(at, v)
+	if ref, ok := response["$ref"]; ok {
+		c.ref(at, ref)
+		return
+	}
+	c.str(at+".description", response["description"])
+	if content, ok := response["content"]; ok {
+		c.content(at, content)
+	}
+}
+
+func (c *openAPIChecker) content(at string, v interface{}) {
+	content := c.object(at+".content", v)
+	if len(content) == 0 {
+		c.errorf(at, "empty content")
+	}
+	for mediaType, media := range content {
+		c.schema(at+".content."+mediaType+".schema", c.object(at, media)["schema"])
+	}
+}
+
+func (c *openAPIChecker) schema(at string, v interface{}) {
+	schema := c.object(at, v)
+	if ref, ok := schema["$ref"]; ok {
+		if len(schema) != 1 {
+			c.errorf(at, "$ref with siblings")
+		}
+		c.ref(at, ref)
+		return
+	}
+
+	typ := c.str(at+".type", schema["type"])
+	if !schemaTypes[typ] {
+		c.errorf(at, "unknown type %q", typ)
+	}
+	switch typ {
+	case "array":
+		c.schema(at+".items", schema["items"])
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			c.schema(at+"."+name, property)
+		}
+		if additional, ok := schema["additionalProperties"]; ok {
+			c.schema(at+".additionalProperties", additional)
+		}
+		if required, ok := schema["required"]; ok {
+			for _, name := range required.([]interface{}) {
+				if _, ok := properties[name.(string)]; !ok {
+					c.errorf(at, "required property %v isn't defined", name)
+				}
+			}
+		}
+	}
+}
+
+// ref checks that a reference points into the document.
+func (c *openAPIChecker) ref(at string, v interface{}) {
+	ref := c.str(at+".$ref", v)
+	if !strings.HasPrefix(ref, "#/components/") {
+		c.errorf(at, "reference %q is outside the components", ref)
+		return
+	}
+	var node interface{} = c.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, _ := node.(map[string]interface{})
+		if node = m[part]; node == nil {
+			c.errorf(at, "reference %q doesn't resolve", ref)
+			return
+		}
+	}
+}
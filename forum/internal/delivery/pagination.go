@@ -0,0 +1,124 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"forum/internal/models"
+)
+
+var (
+	errBadCursor = errors.New("invalid page cursor")
+	errBadSort   = errors.New("invalid sort order")
+	errBadWindow = errors.New("invalid time window")
+)
+
+// pageFromQuery reads the ?after= and ?before= cursors of a listing along
+// with its ?sort= order and ?t= time window.
+func pageFromQuery(query url.Values) (models.Page, error) {
+	page := models.Page{
+		Sort:   models.SortNew,
+		Window: models.WindowAll,
+	}
+
+	if val := query.Get("sort"); val != "" {
+		page.Sort = models.Sort(val)
+		if !containsSort(models.Sorts, page.Sort) {
+			return page, errBadSort
+		}
+	}
+
+	if val := query.Get("t"); val != "" {
+		page.Window = models.Window(val)
+		if !containsWindow(models.Windows, page.Window) {
+			return page, errBadWindow
+		}
+	}
+
+	for key, dst := range map[string]*models.Cursor{"after": &page.After, "before": &page.Before} {
+		val := query.Get(key)
+		if val == "" {
+			continue
+		}
+		cursor, ok := models.ParseCursor(val, page.Sort)
+		if !ok {
+			return page, errBadCursor
+		}
+		*dst = cursor
+	}
+
+	if !page.After.IsZero() && !page.Before.IsZero() {
+		return page, errBadCursor
+	}
+
+	return page, nil
+}
+
+// withPageLinks fills in the URLs of the neighbouring pages, keeping every
+// other query parameter of the current request.
+func withPageLinks(r *http.Request, pagination models.Pagination) models.Pagination {
+	if pagination.Next != "" {
+		pagination.NextURL = listingLink(r, "after", pagination.Next)
+	}
+	if pagination.Prev != "" {
+		pagination.PrevURL = listingLink(r, "before", pagination.Prev)
+	}
+	return pagination
+}
+
+// sortLinks lists the sort orders of a listing, keeping its other query
+// parameters but starting again from the first page.
+func sortLinks(r *http.Request, page models.Page) []models.Link {
+	links := make([]models.Link, len(models.Sorts))
+	for i, sort := range models.Sorts {
+		links[i] = models.Link{
+			Name:   string(sort),
+			URL:    listingLink(r, "sort", string(sort)),
+			Active: sort == page.Sort,
+		}
+	}
+	return links
+}
+
+// windowLinks lists the time windows of a listing.
+func windowLinks(r *http.Request, page models.Page) []models.Link {
+	links := make([]models.Link, len(models.Windows))
+	for i, window := range models.Windows {
+		links[i] = models.Link{
+			Name:   string(window),
+			URL:    listingLink(r, "t", string(window)),
+			Active: window == page.Window,
+		}
+	}
+	return links
+}
+
+// listingLink links to the current listing with key set to val. The cursors
+// are removed first, so the link starts from the first page unless key is a
+// cursor itself.
+func listingLink(r *http.Request, key, val string) string {
+	query := r.URL.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(key, val)
+	return r.URL.Path + "?" + query.Encode()
+}
+
+func containsSort(sorts []models.Sort, sort models.Sort) bool {
+	for _, s := range sorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWindow(windows []models.Window, window models.Window) bool {
+	for _, w := range windows {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"forum/internal/models"
+)
+
+func TestPageFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		page  models.Page
+		err   error
+	}{
+		{query: "", page: models.Page{Sort: models.SortNew, Window: models.WindowAll}},
+		{query: "after=4", page: models.Page{Sort: models.SortNew, Window: models.WindowAll, After: models.Cursor{ID: 4}}},
+		{query: "sort=top&t=week&before=4_2", page: models.Page{Sort: models.SortTop, Window: models.WindowWeek, Before: models.Cursor{ID: 4, Score: 2}}},
+		{query: "sort=hot&after=4_39123.456", page: models.Page{Sort: models.SortHot, Window: models.WindowAll, After: models.Cursor{ID: 4, Score: 39123.456}}},
+		{query: "sort=controversial&after=4_-1.5e-3", page: models.Page{Sort: models.SortControversial, Window: models.WindowAll, After: models.Cursor{ID: 4, Score: -1.5e-3}}},
+		{query: "sort=best", err: errBadSort},
+		{query: "sort=top&t=year", err: errBadWindow},
+		// Every sort takes a time window.
+		{query: "t=all", page: models.Page{Sort: models.SortNew, Window: models.WindowAll}},
+		{query: "t=week", page: models.Page{Sort: models.SortNew, Window: models.WindowWeek}},
+		{query: "sort=hot&t=day", page: models.Page{Sort: models.SortHot, Window: models.WindowDay}},
+		{query: "after=0", err: errBadCursor},
+		{query: "after=four", err: errBadCursor},
+		{query: "after=4_2", err: errBadCursor},
+		{query: "sort=top&after=4", err: errBadCursor},
+		{query: "sort=top&after=4_NaN", err: errBadCursor},
+		{query: "sort=top&after=4_Inf", err: errBadCursor},
+		{query: "after=4&before=5", err: errBadCursor},
+	}
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := pageFromQuery(query)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("pageFromQuery(%q) = %v, want %v", tt.query, err, tt.err)
+			continue
+		}
+		if err == nil && page != tt.page {
+			t.Errorf("pageFromQuery(%q) = %+v, want %+v", tt.query, page, tt.page)
+		}
+	}
+}
+
+func TestSortLinksKeepWindow(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?sort=top&t=week&after=4_2", nil)
+	want := map[string]string{
+		"new":           "/?sort=new&t=week",
+		"hot":           "/?sort=hot&t=week",
+		"top":           "/?sort=top&t=week",
+		"controversial": "/?sort=controversial&t=week",
+	}
+	for _, link := range sortLinks(r, models.Page{Sort: models.SortTop}) {
+		if link.URL != want[link.Name] {
+			t.Errorf("%s links to %q, want %q", link.Name, link.URL, want[link.Name])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// The passkey ceremonies are run by templates/js/passkeys.js, which talks
+// JSON to the handlers below. They sit outside the API so that the
+// middleware checks their CSRF token like that of any form.
+
+type passkeyRegistrationStart struct {
+	Password string `json:"password"`
+}
+
+type passkeyRegistration struct {
+	Name string `json:"name"`
+	models.PasskeyAttestation
+}
+
+type passkeySignIn struct {
+	models.PasskeyAssertion
+	Remember bool `json:"remember"`
+}
+
+func (h *Handler) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	if err := requireUser(user); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	var req passkeyRegistrationStart
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	options, err := h.services.Passkey.BeginPasskeyRegistration(user, req.Password, clientIP(r))
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, options)
+}
+
+func (h *Handler) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	if err := requireUser(user); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	var req passkeyRegistration
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	passkey, err := h.services.Passkey.FinishPasskeyRegistration(user, req.Name, req.PasskeyAttestation)
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, passkey)
+}
+
+func (h *Handler) beginPasskeySignIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	options, err := h.services.Passkey.BeginPasskeySignIn()
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, options)
+}
+
+// finishPasskeySignIn opens a session for the owner of the passkey and
+// sets its cookie, like a sign in with a password.
+func (h *Handler) finishPasskeySignIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	var req passkeySignIn
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	session, err := h.services.Authorization.SignInWithPasskey(req.PasskeyAssertion, models.SignInRequest{
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Remember:  req.Remember,
+	})
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	h.setSessionCookie(w, session)
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// passkeys lists the passkeys of the user, with a button to add another.
+func (h *Handler) passkeys(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	passkeys, err := h.services.Passkey.Passkeys(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template: "passkeys",
+		User:     user,
+		Passkeys: passkeys,
+	}
+
+	h.render(w, r, data)
+}
+
+func (h *Handler) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	passkeyID, err := IDFromURL(r.URL.Path, "/settings/passkeys/delete/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	}
+
+	if err := h.services.Passkey.DeletePasskey(passkeyID, user.ID); errors.Is(err, service.ErrNoPasskey) {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/passkeys", http.StatusSeeOther)
+}
@@ -0,0 +1,90 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+const resetSentNotice = "If an account uses this address, a link to reset its password is on its way. It works for an hour."
+
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		data := models.TemplateData{
+			Template: "forgot-password",
+		}
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := h.services.PasswordReset.RequestPasswordReset(r.Form.Get("email"), clientIP(r)); err != nil {
+			if errors.Is(err, service.ErrInvalidEmail) {
+				h.errorPage(w, http.StatusBadRequest, err)
+				return
+			} else if errors.Is(err, service.ErrTooManyAttempts) {
+				setRetryAfter(w, err)
+				h.errorPage(w, http.StatusTooManyRequests, err)
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template: "forgot-password",
+			Notice:   resetSentNotice,
+		}
+		h.render(w, r, data)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		if err := h.services.PasswordReset.CheckPasswordReset(token); err != nil {
+			h.resetPasswordError(w, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template:   "reset-password",
+			ResetToken: token,
+		}
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		err := h.services.PasswordReset.ResetPassword(r.Form.Get("token"), r.Form.Get("password"), r.Form.Get("confirm_password"))
+		if err != nil {
+			h.resetPasswordError(w, err)
+			return
+		}
+
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler) resetPasswordError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidResetLink):
+		h.errorPage(w, http.StatusGone, err)
+	case errors.Is(err, service.ErrInvalidPassword), errors.Is(err, service.ErrPasswordMismatch):
+		h.errorPage(w, http.StatusBadRequest, err)
+	default:
+		h.errorPage(w, http.StatusInternalServerError, err)
+	}
+}
@@ -17,6 +17,11 @@ func IDFromURL(url, prefix string) (int, error) {
 }
 
 func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/history") {
+		h.postHistory(w, r)
+		return
+	}
+
 	user := r.Context().Value(contextKeyUser).(models.User)
 	postID, err := IDFromURL(r.URL.Path, "/posts/")
 	if err != nil {
@@ -36,9 +41,26 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		comments, err := h.services.Commentary.CommentsByPostID(postID, user.ID)
-		if err != nil {
-			log.Printf("error getting comments by post ID: %s", err)
+		var comments []models.Comment
+		thread := r.URL.Query().Get("thread")
+		if thread != "" {
+			commentID, err := strconv.Atoi(thread)
+			if err != nil {
+				h.errorPage(w, http.StatusNotFound, nil)
+				return
+			}
+
+			comment, err := h.services.Commentary.CommentThread(postID, commentID, user.ID)
+			if err != nil {
+				h.commentError(w, err)
+				return
+			}
+			comments = []models.Comment{comment}
+		} else {
+			comments, err = h.services.Commentary.CommentsByPostID(postID, user.ID)
+			if err != nil {
+				log.Printf("error getting comments by post ID: %s", err)
+			}
 		}
 
 		data := models.TemplateData{
@@ -46,17 +68,15 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 			User:     user,
 			Post:     post,
 			Comments: comments,
+			Thread:   thread != "",
 		}
 
-		if err := h.tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			h.errorPage(w, http.StatusInternalServerError, err)
-		}
+		h.render(w, r, data)
 	case http.MethodPost:
 		if user == (models.User{}) {
 			h.errorPage(w, http.StatusUnauthorized, nil)
 			return
 		}
-
 		if err := r.ParseForm(); err != nil {
 			h.errorPage(w, http.StatusInternalServerError, err)
 			return
@@ -69,13 +89,25 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		comment := models.Comment{
-			UserID:  user.ID,
 			PostID:  postID,
 			Content: commentContent[0],
 		}
 
-		if err := h.services.Commentary.CreateComment(comment); err != nil {
-			if errors.Is(err, service.ErrEmptyComment) {
+		if parent := r.Form.Get("parent"); parent != "" {
+			parentID, err := strconv.Atoi(parent)
+			if err != nil {
+				h.errorPage(w, http.StatusBadRequest, nil)
+				return
+			}
+			comment.ParentID = parentID
+		}
+
+		if _, err := h.services.Commentary.CreateComment(comment, user); err != nil {
+			if errors.Is(err, service.ErrEmailNotVerified) {
+				h.errorPage(w, http.StatusForbidden, err)
+				return
+			}
+			if errors.Is(err, service.ErrEmptyComment) || errors.Is(err, service.ErrNoComment) {
 				h.errorPage(w, http.StatusBadRequest, err)
 				return
 			}
@@ -83,30 +115,72 @@ func (h *Handler) postPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
 	default:
 		h.errorPage(w, http.StatusMethodNotAllowed, nil)
 	}
 }
 
+func (h *Handler) postHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	user := r.Context().Value(contextKeyUser).(models.User)
+	postID, err := IDFromURL(strings.TrimSuffix(r.URL.Path, "/history"), "/posts/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, fmt.Errorf("error getting post ID: %s", err))
+		return
+	}
+
+	post, err := h.services.Post.PostById(postID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrNoPost) {
+			h.errorPage(w, http.StatusNotFound, nil)
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	revisions, err := h.services.Post.PostHistory(postID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template:  "post-history",
+		User:      user,
+		Post:      post,
+		Revisions: revisions,
+	}
+
+	h.render(w, r, data)
+}
+
 func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(contextKeyUser).(models.User)
 	if user == (models.User{}) {
 		h.errorPage(w, http.StatusUnauthorized, nil)
 		return
 	}
-
 	switch r.Method {
 	case http.MethodGet:
-		data := models.TemplateData{
-			Template: "create-post",
-			User:     user,
-		}
-
-		if err := h.tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		categories, err := h.services.Category.Categories()
+		if err != nil {
 			h.errorPage(w, http.StatusInternalServerError, err)
 			return
 		}
+
+		data := models.TemplateData{
+			Template:   "create-post",
+			User:       user,
+			Categories: categories,
+		}
+
+		h.render(w, r, data)
 	case http.MethodPost:
 		if err := r.ParseMultipartForm(5 << 20); err != nil {
 			h.errorPage(w, http.StatusInternalServerError, err)
@@ -121,6 +195,18 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		post := models.Post{
+			Title:      title[0],
+			Content:    content[0],
+			Categories: category,
+		}
+
+		// The images are only written once the post is known to be accepted.
+		if err := h.services.Post.CheckPost(post, user); err != nil {
+			h.createPostError(w, err)
+			return
+		}
+
 		images := r.MultipartForm.File["image"]
 		paths, err := service.SaveImages(images)
 		if err != nil {
@@ -131,21 +217,10 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 			h.errorPage(w, http.StatusInternalServerError, err)
 			return
 		}
+		post.ImagesPath = paths
 
-		post := models.Post{
-			Title:      title[0],
-			AuthorID:   user.ID,
-			Content:    content[0],
-			Categories: category,
-			ImagesPath: paths,
-		}
-
-		if err := h.services.Post.CreatePost(post); err != nil {
-			if errors.Is(err, service.ErrEmptyPost) {
-				h.errorPage(w, http.StatusBadRequest, err)
-				return
-			}
-			h.errorPage(w, http.StatusInternalServerError, err)
+		if _, err := h.services.Post.CreatePost(post, user); err != nil {
+			h.createPostError(w, err)
 			return
 		}
 
@@ -155,6 +230,17 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) createPostError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrEmailNotVerified):
+		h.errorPage(w, http.StatusForbidden, err)
+	case errors.Is(err, service.ErrEmptyPost), errors.Is(err, service.ErrUnknownCategory), errors.Is(err, service.ErrNoPostCategories):
+		h.errorPage(w, http.StatusBadRequest, err)
+	default:
+		h.errorPage(w, http.StatusInternalServerError, err)
+	}
+}
+
 func (h *Handler) reactToPost(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(contextKeyUser).(models.User)
 
@@ -191,9 +277,137 @@ func (h *Handler) reactToPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.services.Reaction.ReactToPost(id, user.ID, reaction[0]); err != nil {
+		if errors.Is(err, service.ErrInvalidVote) {
+			h.errorPage(w, http.StatusBadRequest, err)
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	http.Redirect(w, r, fmt.Sprintf("/posts/%v", id), http.StatusSeeOther)
 }
+
+func (h *Handler) editPost(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	postID, err := IDFromURL(r.URL.Path, "/posts/edit/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, fmt.Errorf("error getting post ID: %s", err))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		post, err := h.services.Post.PostById(postID, user.ID)
+		if err != nil {
+			if errors.Is(err, service.ErrNoPost) {
+				h.errorPage(w, http.StatusNotFound, nil)
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !service.CanEditPost(user, post) {
+			h.errorPage(w, http.StatusForbidden, service.ErrForbidden)
+			return
+		}
+
+		categories, err := h.services.Category.Categories()
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template:   "edit-post",
+			User:       user,
+			Post:       post,
+			Categories: categories,
+		}
+
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		title, ok1 := r.Form["title"]
+		content, ok2 := r.Form["content"]
+		category, ok3 := r.Form["category"]
+
+		if !ok1 || !ok2 || !ok3 {
+			h.errorPage(w, http.StatusBadRequest, nil)
+			return
+		}
+
+		post := models.Post{
+			ID:         postID,
+			Title:      title[0],
+			Content:    content[0],
+			Categories: category,
+		}
+
+		if err := h.services.Post.UpdatePost(post, user); err != nil {
+			switch {
+			case errors.Is(err, service.ErrNoPost):
+				h.errorPage(w, http.StatusNotFound, nil)
+			case errors.Is(err, service.ErrForbidden):
+				h.errorPage(w, http.StatusForbidden, err)
+			case errors.Is(err, service.ErrEmptyPost), errors.Is(err, service.ErrUnknownCategory), errors.Is(err, service.ErrNoPostCategories):
+				h.errorPage(w, http.StatusBadRequest, err)
+			default:
+				h.errorPage(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/posts/%v", postID), http.StatusSeeOther)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler) deletePost(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	postID, err := IDFromURL(r.URL.Path, "/posts/delete/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, fmt.Errorf("error getting post ID: %s", err))
+		return
+	}
+
+	if err := h.services.Post.DeletePost(postID, user); err != nil {
+		switch {
+		case errors.Is(err, service.ErrNoPost):
+			h.errorPage(w, http.StatusNotFound, nil)
+		case errors.Is(err, service.ErrForbidden):
+			h.errorPage(w, http.StatusForbidden, err)
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,69 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// TestCreatePostSavesNoImagesForRefusedPosts checks the images of a post
+// are only written to disk once the post is accepted.
+func TestCreatePostSavesNoImagesForRefusedPosts(t *testing.T) {
+	h := newTestHandler(t, &service.Service{
+		Post: &fakePosts{posts: map[int]models.Post{}},
+	})
+
+	// The images are saved relative to the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	tests := []struct {
+		name    string
+		user    models.User
+		content string
+		status  int
+	}{
+		{name: "unverified author", user: models.User{ID: 1, Username: "alice"}, content: "Hello", status: http.StatusForbidden},
+		{name: "empty post", user: models.User{ID: 1, Username: "alice", EmailVerified: true}, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			form.WriteField("title", "Hi")
+			form.WriteField("content", tt.content)
+			form.WriteField("category", "airplane")
+			image, err := form.CreateFormFile("image", "dot.gif")
+			if err != nil {
+				t.Fatal(err)
+			}
+			image.Write([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"))
+			form.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/posts/create", &body)
+			r.Header.Set("Content-Type", form.FormDataContentType())
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyUser, tt.user))
+			rec := httptest.NewRecorder()
+			h.createPost(rec, r)
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.status)
+			}
+			if _, err := os.Stat("uploads"); !os.IsNotExist(err) {
+				t.Errorf("uploads written for a refused post: %v", err)
+			}
+		})
+	}
+}
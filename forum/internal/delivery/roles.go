@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// adminRoles lists the moderators and admins, with a form to change the
+// role of any user.
+func (h *Handler) adminRoles(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	staff, err := h.services.Roles.Staff(user)
+	if errors.Is(err, service.ErrForbidden) {
+		h.errorPage(w, http.StatusForbidden, err)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template: "admin-roles",
+		User:     user,
+		Staff:    staff,
+		Roles:    models.Roles,
+	}
+
+	h.render(w, r, data)
+}
+
+func (h *Handler) setRole(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	_, err := h.services.Roles.SetRole(user, r.Form.Get("username"), models.Role(r.Form.Get("role")))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNoUsername):
+			h.errorPage(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrForbidden):
+			h.errorPage(w, http.StatusForbidden, err)
+		case errors.Is(err, service.ErrInvalidRole):
+			h.errorPage(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrLastAdmin):
+			h.errorPage(w, http.StatusConflict, err)
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
@@ -0,0 +1,80 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		search := models.SearchQuery{
+			Text:     query.Get("q"),
+			Category: query.Get("category"),
+			Author:   query.Get("author"),
+		}
+
+		page := 1
+		if val := query.Get("page"); val != "" {
+			var err error
+			page, err = strconv.Atoi(val)
+			if err != nil || page < 1 {
+				h.errorPage(w, http.StatusBadRequest, errBadCursor)
+				return
+			}
+		}
+
+		categories, err := h.services.Category.Categories()
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template:   "search",
+			User:       user,
+			Search:     search,
+			Categories: categories,
+		}
+
+		if search.Text != "" {
+			results, more, err := h.services.Search.Search(search, page, user.ID)
+			if err != nil && !errors.Is(err, service.ErrEmptySearch) {
+				h.errorPage(w, http.StatusInternalServerError, err)
+				return
+			}
+			data.Results = results
+			data.Pagination = searchPageLinks(r, page, more)
+		}
+
+		h.render(w, r, data)
+	case http.MethodPost:
+		h.reactFromListing(w, r, user)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func searchPageLinks(r *http.Request, page int, more bool) models.Pagination {
+	link := func(page int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		return r.URL.Path + "?" + query.Encode()
+	}
+
+	var pagination models.Pagination
+	if page > 1 {
+		pagination.PrevURL = link(page - 1)
+	}
+	if more {
+		pagination.NextURL = link(page + 1)
+	}
+	return pagination
+}
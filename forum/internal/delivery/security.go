@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"log"
+	"net/http"
+
+	"forum/internal/config"
+)
+
+// contentSecurityPolicy only lets pages load the forum's own resources and
+// Bootstrap from its CDN. Images may also be data: URLs, which Bootstrap's
+// stylesheet uses for its icons.
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' https://cdn.jsdelivr.net; " +
+	"style-src 'self' https://cdn.jsdelivr.net; " +
+	"img-src 'self' data:; " +
+	"font-src 'self' https://cdn.jsdelivr.net; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'"
+
+type cookiePolicy struct {
+	secure   bool
+	sameSite http.SameSite
+}
+
+func newCookiePolicy(cfg config.Config) cookiePolicy {
+	policy := cookiePolicy{
+		secure:   cfg.CookieSecure,
+		sameSite: http.SameSiteLaxMode,
+	}
+
+	switch cfg.CookieSameSite {
+	case "strict":
+		policy.sameSite = http.SameSiteStrictMode
+	case "none":
+		if !cfg.CookieSecure {
+			log.Printf("config: SameSite=None cookies must be Secure, using Lax")
+			break
+		}
+		policy.sameSite = http.SameSiteNoneMode
+	}
+	return policy
+}
+
+// setCookie sets a cookie with the attributes of the cookie policy, unless
+// it asks for its own SameSite. None of the forum's cookies is meant for
+// scripts, so all of them are HttpOnly.
+func (h *Handler) setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	cookie.HttpOnly = true
+	cookie.Secure = h.cookies.secure
+	if cookie.SameSite == 0 {
+		cookie.SameSite = h.cookies.sameSite
+	}
+	http.SetCookie(w, cookie)
+}
+
+// secure adds the security headers to every response.
+func (h *Handler) secure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Security-Policy", contentSecurityPolicy)
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		header.Set("Cross-Origin-Opener-Policy", "same-origin")
+		header.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+		if h.cookies.secure {
+			header.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,109 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+// settings shows the account settings of the user: the personal API tokens
+// they minted and a form to mint another.
+func (h *Handler) settings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	h.renderSettings(w, r, user, "")
+}
+
+// createToken mints a token and shows it on the settings page, the only
+// time it is ever displayed.
+func (h *Handler) createToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var scopes []models.Scope
+	for _, scope := range r.Form["scope"] {
+		scopes = append(scopes, models.Scope(scope))
+	}
+
+	_, plaintext, err := h.services.APIToken.CreateToken(user.ID, r.Form.Get("name"), scopes)
+	if errors.Is(err, service.ErrInvalidTokenName) || errors.Is(err, service.ErrInvalidScope) {
+		h.errorPage(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.renderSettings(w, r, user, plaintext)
+}
+
+func (h *Handler) revokeToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	tokenID, err := IDFromURL(r.URL.Path, "/settings/tokens/revoke/")
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	}
+
+	if err := h.services.APIToken.RevokeToken(tokenID, user.ID); errors.Is(err, service.ErrNoToken) {
+		h.errorPage(w, http.StatusNotFound, nil)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+func (h *Handler) renderSettings(w http.ResponseWriter, r *http.Request, user models.User, newToken string) {
+	tokens, err := h.services.APIToken.Tokens(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template: "settings",
+		User:     user,
+		Tokens:   tokens,
+		NewToken: newToken,
+		Scopes:   models.Scopes,
+	}
+
+	h.render(w, r, data)
+}
@@ -0,0 +1,126 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"forum/internal/service"
+)
+
+var templateFuncs = template.FuncMap{
+	"timeAgo":        timeAgo,
+	"fullDate":       fullDate,
+	"revisionNumber": revisionNumber,
+	"dict":           dict,
+	"inputDate":      inputDate,
+	"plural":         plural,
+	"deviceName":     deviceName,
+	// The permission checks tell the pages which actions to offer.
+	"canEditPost":         service.CanEditPost,
+	"canDeletePost":       service.CanDeletePost,
+	"canEditComment":      service.CanEditComment,
+	"canDeleteComment":    service.CanDeleteComment,
+	"canManageCategories": service.CanManageCategories,
+	"canManageLockouts":   service.CanManageLockouts,
+	"canManageRoles":      service.CanManageRoles,
+}
+
+// timeAgo renders t relative to now, e.g. "3 hours ago".
+func timeAgo(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day") + " ago"
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month") + " ago"
+	default:
+		return plural(int(d/(365*24*time.Hour)), "year") + " ago"
+	}
+}
+
+func fullDate(t time.Time) string {
+	return t.Local().Format("02 Jan 2006 15:04")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// revisionNumber numbers revisions listed newest first so that the oldest one is 1.
+func revisionNumber(count, index int) int {
+	return count - index
+}
+
+// dict builds a map from alternating keys and values so that templates
+// can pass more than one value to a nested template.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict: odd number of arguments")
+	}
+
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, errors.New("dict: keys must be strings")
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// inputDate formats t for a date input, leaving it empty for the zero time.
+func inputDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+// deviceName names the browser and operating system of a user agent, e.g.
+// "Firefox on Linux", falling back to the user agent itself.
+func deviceName(userAgent string) string {
+	find := func(names [][2]string) string {
+		for _, n := range names {
+			if strings.Contains(userAgent, n[0]) {
+				return n[1]
+			}
+		}
+		return ""
+	}
+
+	// Order matters: Edge and Opera also claim to be Chrome, which claims
+	// to be Safari.
+	browser := find([][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	})
+	os := find([][2]string{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	case userAgent == "":
+		return "Unknown device"
+	}
+	return userAgent
+}
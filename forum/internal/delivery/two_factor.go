@@ -0,0 +1,200 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+const (
+	// challengeCookie carries a sign in from the password to the second
+	// factor.
+	challengeCookie    = "signin_challenge"
+	challengeCookieAge = 5 * 60
+)
+
+// signInTwoFactor asks for the second factor of a sign in whose password
+// was right.
+func (h *Handler) signInTwoFactor(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(challengeCookie)
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data := models.TemplateData{
+			Template: "sign-in-two-factor",
+		}
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		session, err := h.services.Authorization.CompleteSignIn(cookie.Value, r.Form.Get("code"))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrWrongCode):
+				h.errorPage(w, http.StatusUnauthorized, err)
+			case errors.Is(err, service.ErrLoginExpired):
+				h.clearChallenge(w)
+				h.errorPage(w, http.StatusUnauthorized, err)
+			case errors.Is(err, service.ErrTooManyAttempts):
+				setRetryAfter(w, err)
+				h.errorPage(w, http.StatusTooManyRequests, err)
+			default:
+				h.errorPage(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		h.clearChallenge(w)
+		h.setSessionCookie(w, session)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler) clearChallenge(w http.ResponseWriter) {
+	h.setCookie(w, &http.Cookie{
+		Name:   challengeCookie,
+		MaxAge: -1,
+	})
+}
+
+// twoFactor shows whether two-factor authentication is on, with the
+// forms to turn it on or off.
+func (h *Handler) twoFactor(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	h.renderTwoFactor(w, r, user, models.TwoFactorSetup{}, nil)
+}
+
+// setupTwoFactor shows a secret to add to an authenticator app, with a
+// form to confirm it with a first code.
+func (h *Handler) setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	setup, err := h.services.TwoFactor.SetupTwoFactor(user)
+	if errors.Is(err, service.ErrTwoFactorEnabled) {
+		h.errorPage(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.renderTwoFactor(w, r, user, setup, nil)
+}
+
+// enableTwoFactor turns two-factor authentication on and shows the
+// recovery codes, the only time they are ever displayed.
+func (h *Handler) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	codes, err := h.services.TwoFactor.EnableTwoFactor(user, r.Form.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWrongCode):
+			h.errorPage(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorDisabled):
+			h.errorPage(w, http.StatusConflict, err)
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	h.renderTwoFactor(w, r, user, models.TwoFactorSetup{}, codes)
+}
+
+func (h *Handler) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user == (models.User{}) {
+		h.errorPage(w, http.StatusUnauthorized, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.services.TwoFactor.DisableTwoFactor(user, r.Form.Get("password"), clientIP(r)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrWrongPassword):
+			h.errorPage(w, http.StatusUnauthorized, err)
+		case errors.Is(err, service.ErrTooManyAttempts):
+			setRetryAfter(w, err)
+			h.errorPage(w, http.StatusTooManyRequests, err)
+		case errors.Is(err, service.ErrTwoFactorDisabled):
+			h.errorPage(w, http.StatusConflict, err)
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/settings/two-factor", http.StatusSeeOther)
+}
+
+func (h *Handler) renderTwoFactor(w http.ResponseWriter, r *http.Request, user models.User, setup models.TwoFactorSetup, codes []string) {
+	status, err := h.services.TwoFactor.TwoFactorStatus(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.TemplateData{
+		Template:       "two-factor",
+		User:           user,
+		TwoFactor:      status,
+		TwoFactorSetup: setup,
+		RecoveryCodes:  codes,
+	}
+
+	h.render(w, r, data)
+}
@@ -0,0 +1,87 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"forum/internal/models"
+	"forum/internal/service"
+)
+
+const verificationSentNotice = "If an unconfirmed account uses this address, a new confirmation link is on its way."
+
+// verifyEmail confirms the email address of the link at GET /verify-email.
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	if err := h.services.EmailVerification.VerifyEmail(r.URL.Query().Get("token")); err != nil {
+		if errors.Is(err, service.ErrInvalidVerifyLink) {
+			h.errorPage(w, http.StatusGone, err)
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user := r.Context().Value(contextKeyUser).(models.User)
+	if user.ID != 0 {
+		user.EmailVerified = true
+	}
+
+	data := models.TemplateData{
+		Template: "verify-email",
+		User:     user,
+		Notice:   "Your email address is confirmed. Welcome aboard!",
+	}
+	h.render(w, r, data)
+}
+
+// resendVerification mails a new confirmation link, to the address typed
+// in or else to that of the signed in user.
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(contextKeyUser).(models.User)
+
+	switch r.Method {
+	case http.MethodGet:
+		data := models.TemplateData{
+			Template: "verify-email",
+			User:     user,
+		}
+		h.render(w, r, data)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		email := r.Form.Get("email")
+		if email == "" {
+			email = user.Email
+		}
+
+		if err := h.services.EmailVerification.ResendVerification(email, clientIP(r)); err != nil {
+			if errors.Is(err, service.ErrInvalidEmail) {
+				h.errorPage(w, http.StatusBadRequest, err)
+				return
+			} else if errors.Is(err, service.ErrTooManyAttempts) {
+				setRetryAfter(w, err)
+				h.errorPage(w, http.StatusTooManyRequests, err)
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := models.TemplateData{
+			Template: "verify-email",
+			User:     user,
+			Notice:   verificationSentNotice,
+		}
+		h.render(w, r, data)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, nil)
+	}
+}
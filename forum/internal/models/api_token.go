@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// APITokenPrefix starts every personal API token, telling them apart from
+// session tokens in an Authorization header.
+const APITokenPrefix = "fat_"
+
+// Scope limits what an API token may be used for.
+type Scope string
+
+const (
+	ScopeRead       Scope = "read"
+	ScopePosts      Scope = "posts:write"
+	ScopeComments   Scope = "comments:write"
+	ScopeReactions  Scope = "reactions:write"
+	ScopeCategories Scope = "categories:write"
+)
+
+var Scopes = []Scope{ScopeRead, ScopePosts, ScopeComments, ScopeReactions, ScopeCategories}
+
+// APIToken is a named, revocable credential a user mints for scripted
+// access. Only the SHA-256 hash of the token itself is stored.
+type APIToken struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"-"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt and RevokedAt are nil until the token is used or revoked.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (t APIToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t APIToken) Revoked() bool {
+	return t.RevokedAt != nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Category is a subforum posts are filed under. Posts refer to it by Slug.
+type Category struct {
+	ID          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Position orders the categories that share a parent.
+	Position int `json:"position"`
+	// ParentID is the ID of the enclosing category, 0 for a top-level one.
+	ParentID int `json:"parent_id,omitempty"`
+	// Archived categories keep their posts but take no new ones.
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PostCount int `json:"post_count"`
+	// LastActivity is when a post or comment was last written in the
+	// category, the zero time if it is empty.
+	LastActivity time.Time  `json:"last_activity"`
+	Children     []Category `json:"children,omitempty"`
+}
@@ -1,12 +1,31 @@
 package models
 
+import "time"
+
 type Comment struct {
-	ID           int
-	UserID       int
-	PostID       int
-	LikeCount    int
-	DislikeCount int
-	Vote         int
-	Content      string
-	Author       string
+	ID           int       `json:"id"`
+	UserID       int       `json:"author_id"`
+	PostID       int       `json:"post_id"`
+	ParentID     int       `json:"parent_id,omitempty"`
+	LikeCount    int       `json:"like_count"`
+	DislikeCount int       `json:"dislike_count"`
+	Vote         int       `json:"vote"`
+	Content      string    `json:"content"`
+	Author       string    `json:"author"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// Deleted comments had replies when they were deleted; they stay in
+	// the thread without their content and author.
+	Deleted bool `json:"deleted"`
+
+	// Depth is the nesting level of the comment in the rendered thread, 0 for top-level comments.
+	Depth   int       `json:"depth"`
+	Replies []Comment `json:"replies,omitempty"`
+	// HiddenReplies counts the replies cut off by the maximum thread depth.
+	HiddenReplies int `json:"hidden_replies,omitempty"`
+}
+
+// Edited reports whether the comment was changed after it had been posted.
+func (c Comment) Edited() bool {
+	return c.UpdatedAt.After(c.CreatedAt)
 }
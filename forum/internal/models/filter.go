@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// PostFilter narrows a post listing. Zero fields do not filter anything, so
+// the zero value lists every post.
+type PostFilter struct {
+	Categories []string
+	// MatchAll requires a post to have every category instead of any of them.
+	MatchAll bool
+	// Author is matched against the username, ignoring case.
+	Author   string
+	AuthorID int
+	// LikedBy and CommentedBy keep the posts the user with this ID liked
+	// or commented on.
+	LikedBy     int
+	CommentedBy int
+	HasImages   bool
+	// From and To are the first and the last day of the creation date range.
+	From time.Time
+	To   time.Time
+}
+
+func (f PostFilter) HasCategory(category string) bool {
+	for _, c := range f.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
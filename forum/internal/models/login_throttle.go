@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Failed sign ins are counted per account and per client address, and
+// password reset requests and email confirmation mails per email address
+// and per client address.
+const (
+	ThrottleAccount     = "account"
+	ThrottleIP          = "ip"
+	ThrottleResetEmail  = "reset-email"
+	ThrottleResetIP     = "reset-ip"
+	ThrottleVerifyEmail = "verify-email"
+	ThrottleVerifyIP    = "verify-ip"
+)
+
+// LoginThrottle tracks the recent failed sign ins of an account or an IP
+// address.
+type LoginThrottle struct {
+	Kind          string    `json:"kind"`
+	Value         string    `json:"value"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	// LockedUntil is the zero time unless sign ins are locked out.
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+func (t LoginThrottle) Locked(now time.Time) bool {
+	return now.Before(t.LockedUntil)
+}
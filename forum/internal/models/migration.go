@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type Migration struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
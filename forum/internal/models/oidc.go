@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// OIDCIdentity links a user to their account at the OpenID provider.
+type OIDCIdentity struct {
+	ID        int
+	UserID    int
+	Issuer    string
+	Subject   string
+	CreatedAt time.Time
+}
+
+// OIDCLogin is a sign in sent to the OpenID provider, waiting for the
+// browser to come back. State names it in the redirects; Nonce and
+// Verifier tie the code and ID token returned to it.
+type OIDCLogin struct {
+	State      string
+	Nonce      string
+	Verifier   string
+	Persistent bool
+	ExpiresAt  time.Time
+}
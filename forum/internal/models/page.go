@@ -0,0 +1,132 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort is the order of a post listing.
+type Sort string
+
+const (
+	SortNew           Sort = "new"
+	SortTop           Sort = "top"
+	SortHot           Sort = "hot"
+	SortControversial Sort = "controversial"
+)
+
+var Sorts = []Sort{SortNew, SortHot, SortTop, SortControversial}
+
+// Scored reports whether the sort ranks posts by a score computed from
+// their votes rather than by their age.
+func (s Sort) Scored() bool {
+	return s != SortNew
+}
+
+// Window limits a listing to the posts created within a recent period.
+type Window string
+
+const (
+	WindowDay   Window = "day"
+	WindowWeek  Window = "week"
+	WindowMonth Window = "month"
+	WindowAll   Window = "all"
+)
+
+var Windows = []Window{WindowDay, WindowWeek, WindowMonth, WindowAll}
+
+// Start returns the earliest creation time a post may have to fall in the
+// window, or the zero time if the window is unlimited.
+func (w Window) Start(now time.Time) time.Time {
+	switch w {
+	case WindowDay:
+		return now.AddDate(0, 0, -1)
+	case WindowWeek:
+		return now.AddDate(0, 0, -7)
+	case WindowMonth:
+		return now.AddDate(0, -1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+// Cursor is the place of a post in a listing. In the scored sorts it
+// carries the score the post had when its page was read, so that the next
+// page starts at the same place even if the post got votes or was deleted
+// meanwhile.
+type Cursor struct {
+	ID    int
+	Score float64
+}
+
+// IsZero reports whether the cursor is unset, which starts at the top of
+// the listing.
+func (c Cursor) IsZero() bool {
+	return c.ID == 0
+}
+
+// Format encodes the cursor for a listing in sort: the post ID, followed
+// by its score in the scored sorts.
+func (c Cursor) Format(sort Sort) string {
+	id := strconv.Itoa(c.ID)
+	if !sort.Scored() {
+		return id
+	}
+	return id + "_" + strconv.FormatFloat(c.Score, 'g', -1, 64)
+}
+
+// ParseCursor decodes a cursor made by Format for the same sort.
+func ParseCursor(s string, sort Sort) (Cursor, bool) {
+	idPart, scorePart, scored := strings.Cut(s, "_")
+	if scored != sort.Scored() {
+		return Cursor{}, false
+	}
+
+	var (
+		c   Cursor
+		err error
+	)
+	if c.ID, err = strconv.Atoi(idPart); err != nil || c.ID <= 0 {
+		return Cursor{}, false
+	}
+	if scored {
+		c.Score, err = strconv.ParseFloat(scorePart, 64)
+		if err != nil || math.IsNaN(c.Score) || math.IsInf(c.Score, 0) {
+			return Cursor{}, false
+		}
+	}
+	return c, true
+}
+
+// Page selects a slice of a post listing, starting from a cursor. At most
+// one of After and Before is set.
+type Page struct {
+	// After returns the posts that come after this cursor.
+	After Cursor
+	// Before returns the posts that come before this cursor.
+	Before Cursor
+	Limit  int
+	Sort   Sort
+	Window Window
+	// Since is the start of Window, filled in by the service.
+	Since time.Time
+}
+
+// Pagination tells a listing how to reach its neighbouring pages.
+type Pagination struct {
+	// Next is the cursor of the following page, empty if there is none.
+	Next string `json:"next,omitempty"`
+	// Prev is the cursor of the preceding page, empty if there is none.
+	Prev    string `json:"prev,omitempty"`
+	NextURL string `json:"next_url,omitempty"`
+	PrevURL string `json:"prev_url,omitempty"`
+}
+
+// Link is an entry of a listing menu, such as a sort order.
+type Link struct {
+	Name   string
+	URL    string
+	Active bool
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential a user signs in with instead of their
+// password.
+type Passkey struct {
+	ID     int `json:"id"`
+	UserID int `json:"-"`
+	// CredentialID is base64url encoded, as browsers send it.
+	CredentialID string `json:"credential_id"`
+	// PublicKey is COSE encoded.
+	PublicKey []byte    `json:"-"`
+	SignCount uint32    `json:"-"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt is nil until the passkey signs in.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthn ceremonies a challenge can be answered in.
+const (
+	CeremonyRegister = "register"
+	CeremonyLogin    = "login"
+)
+
+// WebAuthnChallenge is a challenge sent to the browser, answered once. A
+// registration challenge belongs to the user adding a passkey.
+type WebAuthnChallenge struct {
+	Challenge string
+	UserID    int
+	Kind      string
+	ExpiresAt time.Time
+}
+
+// PasskeyAttestation is what the browser returns from
+// navigator.credentials.create, base64url encoded.
+type PasskeyAttestation struct {
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+// PasskeyAssertion is what the browser returns from
+// navigator.credentials.get, base64url encoded.
+type PasskeyAssertion struct {
+	CredentialID      string `json:"credential_id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+}
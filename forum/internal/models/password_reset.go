@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// PasswordReset is a single-use link to set a new password, sent to the
+// email address of the user. Only the hash of its token is stored.
+type PasswordReset struct {
+	ID        int
+	UserID    int
+	Username  string
+	Hash      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+// Usable reports whether the reset can still be used at now.
+func (r PasswordReset) Usable(now time.Time) bool {
+	return r.UsedAt.IsZero() && now.Before(r.ExpiresAt)
+}
@@ -1,17 +1,38 @@
 package models
 
-import "html/template"
+import (
+	"html/template"
+	"time"
+)
 
 type Post struct {
-	ID           int
-	AuthorID     int
-	LikeCount    int
-	DislikeCount int
-	CommentCount int
-	Vote         int
-	Author       string
-	Title        string
-	Content      string
-	ImagesPath   []template.URL
-	Categories   []string
+	ID           int            `json:"id"`
+	AuthorID     int            `json:"author_id"`
+	LikeCount    int            `json:"like_count"`
+	DislikeCount int            `json:"dislike_count"`
+	CommentCount int            `json:"comment_count"`
+	Vote         int            `json:"vote"`
+	Author       string         `json:"author"`
+	Title        string         `json:"title"`
+	Content      string         `json:"content"`
+	ImagesPath   []template.URL `json:"images"`
+	Categories   []string       `json:"categories"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	// Score ranks the post in a listing in a scored sort.
+	Score float64 `json:"-"`
+}
+
+// Edited reports whether the post was changed after it had been published.
+func (p Post) Edited() bool {
+	return p.UpdatedAt.After(p.CreatedAt)
+}
+
+func (p Post) HasCategory(category string) bool {
+	for _, c := range p.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
 }
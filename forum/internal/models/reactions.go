@@ -1,9 +1,13 @@
 package models
 
+import "time"
+
 type Reaction struct {
 	ID        string
 	UserID    int
 	PostID    int
 	CommentID int
 	Vote      int
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
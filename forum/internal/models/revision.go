@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Revision is one saved version of a post's title and content.
+type Revision struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	AuthorID  int       `json:"author_id"`
+	Author    string    `json:"author"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// PrevTitle is the title of the version this one replaced, empty for the first one.
+	PrevTitle string     `json:"prev_title,omitempty"`
+	Diff      []DiffLine `json:"diff,omitempty"`
+}
+
+const (
+	DiffUnchanged = "unchanged"
+	DiffAdded     = "added"
+	DiffRemoved   = "removed"
+)
+
+type DiffLine struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+func (r Revision) TitleChanged() bool {
+	return r.PrevTitle != "" && r.PrevTitle != r.Title
+}
@@ -0,0 +1,28 @@
+package models
+
+import "html/template"
+
+// Search snippets mark the matched terms with these control characters,
+// which are replaced by HTML tags once the snippet has been escaped.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+type SearchQuery struct {
+	Text string
+	// Match is the full-text expression built from Text.
+	Match    string
+	Category string
+	Author   string
+	Limit    int
+	Offset   int
+}
+
+type SearchResult struct {
+	Post Post `json:"post"`
+	// Excerpt is the best matching fragment with its terms wrapped in
+	// HighlightStart and HighlightEnd.
+	Excerpt string        `json:"-"`
+	Snippet template.HTML `json:"snippet"`
+}
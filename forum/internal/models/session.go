@@ -3,8 +3,32 @@ package models
 import "time"
 
 type Session struct {
-	ID             int
-	UserID         int
-	Token          string
-	ExpirationDate time.Time
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	Token          string    `json:"token,omitempty"`
+	ExpirationDate time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	// UserAgent and IP identify the device the session was started on;
+	// IP follows the device as it is used.
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	// Persistent sessions were started with "remember me": they last
+	// longer and their cookie outlives the browser.
+	Persistent bool `json:"persistent"`
+	// Current marks the session of the request when sessions are listed.
+	Current bool `json:"current"`
+}
+
+// SignInRequest holds the credentials of a sign in and the device it is
+// made from.
+type SignInRequest struct {
+	Username  string
+	Password  string
+	UserAgent string
+	IP        string
+	Remember  bool
+	// Code is the second factor, for users with two-factor
+	// authentication on.
+	Code string
 }
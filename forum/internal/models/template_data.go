@@ -1,12 +1,43 @@
 package models
 
 type TemplateData struct {
-	Template string
-	User     User
-	Post     Post
-	Posts    []Post
-	Comments []Comment
-	Error    ErrorMsg
+	Template   string
+	User       User
+	Post       Post
+	Posts      []Post
+	Pagination Pagination
+	Sorts      []Link
+	Windows    []Link
+	Filter     PostFilter
+	Categories []Category
+	Category   Category
+	Comments   []Comment
+	Comment    Comment
+	Revisions  []Revision
+	Thread     bool
+	Search     SearchQuery
+	Results    []SearchResult
+	Tokens     []APIToken
+	Sessions   []Session
+	NewToken   string
+	Scopes     []Scope
+	Lockouts   []LoginThrottle
+	Staff      []User
+	Roles      []Role
+	// Notice confirms that a form was sent.
+	Notice         string
+	ResetToken     string
+	TwoFactor      TwoFactorStatus
+	TwoFactorSetup TwoFactorSetup
+	// RecoveryCodes are shown once, when two-factor authentication is
+	// turned on.
+	RecoveryCodes []string
+	Passkeys      []Passkey
+	// OIDCProvider names the identity provider offered on the sign in
+	// page, if any.
+	OIDCProvider string
+	Error        ErrorMsg
+	CSRFToken    string
 }
 
 type ErrorMsg struct {
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"html/template"
+	"time"
+)
+
+// TOTP is the authenticator app of a user. It only guards sign ins once
+// the user confirmed it with a first code.
+type TOTP struct {
+	UserID    int
+	Secret    string
+	CreatedAt time.Time
+	EnabledAt time.Time
+	// LastStep is the time step of the last code accepted, which can't be
+	// used again.
+	LastStep int64
+}
+
+func (t TOTP) Enabled() bool {
+	return !t.EnabledAt.IsZero()
+}
+
+// TwoFactorStatus is what the settings show about the two-factor
+// authentication of a user.
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// RecoveryCodes is how many unused recovery codes are left.
+	RecoveryCodes int `json:"recovery_codes"`
+}
+
+// TwoFactorSetup is a secret waiting for its first code. URI and QRCode
+// are built by the server from the secret and the username only, which is
+// what lets templates use them as links.
+type TwoFactorSetup struct {
+	Secret string       `json:"secret"`
+	URI    template.URL `json:"uri"`
+	// QRCode is a data: URL of a PNG of URI.
+	QRCode template.URL `json:"qr_code"`
+}
+
+// LoginChallenge is a sign in whose password was right, waiting for the
+// second factor. It keeps what the session will be created with.
+type LoginChallenge struct {
+	ID         int
+	UserID     int
+	Hash       string
+	ExpiresAt  time.Time
+	Attempts   int
+	Persistent bool
+	UserAgent  string
+	IP         string
+}
@@ -1,9 +1,42 @@
 package models
 
+import "time"
+
 type User struct {
-	ID              int
-	Username        string
-	Email           string
-	Password        string
-	ConfirmPassword string
+	ID              int       `json:"id"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	Password        string    `json:"-"`
+	ConfirmPassword string    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	// EmailVerified is set once the user opened the confirmation link
+	// mailed at sign up; until then they can't post.
+	EmailVerified bool `json:"email_verified"`
+	Role          Role `json:"role"`
+}
+
+// Role is what a user is allowed to do on the forum, each role allowing
+// what the ones before it do.
+type Role string
+
+const (
+	RoleUser Role = "user"
+	// RoleModerator can remove the posts and comments of others.
+	RoleModerator Role = "moderator"
+	// RoleAdmin manages categories, lockouts and the roles of others.
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists the roles from the least to the most allowed.
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// Valid reports whether r is one of Roles.
+func (r Role) Valid() bool {
+	for _, role := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,324 @@
+// Package oidc signs users in through an OpenID Connect provider
+// (https://openid.net/specs/openid-connect-core-1_0.html) with the
+// authorization code flow and PKCE. The provider is found by discovery and
+// the ID tokens it returns are checked against its published keys; RS256
+// and ES256 signatures are supported.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnavailable reports a provider that can't be reached or
+	// discovered.
+	ErrUnavailable = errors.New("oidc: provider unavailable")
+	ErrExchange    = errors.New("oidc: code exchange failed")
+	ErrInvalidID   = errors.New("oidc: invalid id token")
+)
+
+// leeway is how far the clocks of the forum and the provider may drift
+// apart when checking the times of a token.
+const leeway = time.Minute
+
+// Provider is an OpenID provider the forum is registered with as a
+// client.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the browser back with the
+	// code; it must be registered with the provider.
+	RedirectURL string
+
+	client *http.Client
+	now    func() time.Time
+
+	mu   sync.Mutex
+	meta *metadata
+	keys map[string]interface{}
+}
+
+// metadata is the part of the discovery document the flow needs.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider configures a provider. Discovery happens on first use, so
+// that the forum starts while the provider is down.
+func NewProvider(issuer, clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+}
+
+// Claims are the claims of an ID token the forum uses.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     Bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// Bool is a boolean claim. Some providers send them as the strings "true"
+// and "false", which it accepts too.
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("oidc: invalid boolean claim %s", data)
+	}
+	return nil
+}
+
+// RandomString returns a random value for a state, nonce or PKCE code
+// verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL is the address of the provider's sign in page for a new
+// sign in. The code verifier is kept until Exchange, which needs it.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange trades the code the provider sent back for an ID token and
+// returns its claims once the token is verified and carries nonce.
+func (p *Provider) Exchange(code, verifier, nonce string) (Claims, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.ClientID},
+	}
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &token); errors.Is(err, ErrUnavailable) {
+		return Claims{}, err
+	} else if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrExchange, err)
+	}
+	if token.IDToken == "" {
+		return Claims{}, fmt.Errorf("%w: no id token", ErrExchange)
+	}
+
+	claims, err := p.verify(token.IDToken)
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidID)
+	}
+	return claims, nil
+}
+
+// verify checks the signature, issuer, audience and lifetime of an ID
+// token.
+func (p *Provider) verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed", ErrInvalidID)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed signature", ErrInvalidID)
+	}
+
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return Claims{}, err
+	}
+
+	var payload struct {
+		Claims
+		Audience  audience `json:"aud"`
+		AZP       string   `json:"azp"`
+		ExpiresAt int64    `json:"exp"`
+		IssuedAt  int64    `json:"iat"`
+	}
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return Claims{}, err
+	}
+
+	now := p.now()
+	switch {
+	case payload.Issuer != p.Issuer:
+		return Claims{}, fmt.Errorf("%w: issued by %q", ErrInvalidID, payload.Issuer)
+	case !payload.Audience.contains(p.ClientID):
+		return Claims{}, fmt.Errorf("%w: not issued to this client", ErrInvalidID)
+	case len(payload.Audience) > 1 && payload.AZP != p.ClientID:
+		return Claims{}, fmt.Errorf("%w: not authorized for this client", ErrInvalidID)
+	case now.After(time.Unix(payload.ExpiresAt, 0).Add(leeway)):
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidID)
+	case now.Add(leeway).Before(time.Unix(payload.IssuedAt, 0)):
+		return Claims{}, fmt.Errorf("%w: issued in the future", ErrInvalidID)
+	case payload.Subject == "":
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidID)
+	}
+	return payload.Claims, nil
+}
+
+// audience is the aud claim, which is a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalidID)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalidID)
+	}
+	return nil
+}
+
+// metadata fetches the discovery document once it's first needed, and
+// again after a failure.
+func (p *Provider) metadata() (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+	var meta metadata
+	if err := p.do(req, &meta); errors.Is(err, ErrUnavailable) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: discovery: %s", ErrUnavailable, err)
+	}
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: discovery: issuer %q doesn't match", ErrUnavailable, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery: missing endpoints", ErrUnavailable)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// do sends the request and decodes its JSON response into v.
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -2,18 +2,43 @@ package repository
 
 import (
 	"database/sql"
+	"time"
 
 	"forum/internal/models"
 )
 
 type Authorization interface {
-	CreateUser(user models.User) error
+	CreateUser(user models.User) (int, error)
 	GetUser(username, email string) (models.User, error)
-	CreateSession(user models.Session) error
+	GetUserByID(ID int) (models.User, error)
+	// VerifyEmail marks the email address of the user verified, provided
+	// it is still email.
+	VerifyEmail(userID int, email string, at time.Time) error
+	// SetRole gives the user the role, unless that would leave the forum
+	// without an admin, reporting whether it did.
+	SetRole(userID int, role models.Role) (bool, error)
+	// GetStaff returns the users with a role above RoleUser.
+	GetStaff() ([]models.User, error)
+	CreateSession(session models.Session) (int, error)
 	GetSession(token string) (models.Session, error)
 	DeleteSession(token string) error
-	DeleteSessionByUserId(userID int) error
-	UserByToken(token string) (models.User, error)
+	// UserByToken returns the owner of a session that is unexpired at now.
+	UserByToken(token string, now time.Time) (models.User, error)
+	// GetSessions returns the sessions of the user unexpired at now.
+	GetSessions(userID int, now time.Time) ([]models.Session, error)
+	// DeleteSessionByID deletes a session of the user, reporting whether
+	// there was one.
+	DeleteSessionByID(ID, userID int) (bool, error)
+	// DeleteOtherSessions deletes every session of the user but the one
+	// with the given token.
+	DeleteOtherSessions(userID int, token string) error
+	// TouchSession records that the session was seen from ip, at most once
+	// every interval.
+	TouchSession(token, ip string, seenAt time.Time, interval time.Duration) error
+	RenewSession(token string, expiresAt time.Time) error
+	// DeleteExpiredSessions purges the sessions expired at now and
+	// returns how many there were.
+	DeleteExpiredSessions(now time.Time) (int, error)
 }
 
 type AuthSqlite struct {
@@ -26,87 +51,215 @@ func NewAuthSqlite(db *sql.DB) *AuthSqlite {
 	}
 }
 
-func (s *AuthSqlite) CreateUser(user models.User) error {
+func (s *AuthSqlite) CreateUser(user models.User) (int, error) {
 	query := `
-		INSERT INTO USERS (Username, Email, Password) VALUES ($1, $2, $3);
+		INSERT INTO USERS (Username, Email, Password, CreatedAt, UpdatedAt) VALUES ($1, $2, $3, $4, $5);
 	`
 
-	if _, err := s.db.Exec(query, user.Username, user.Email, user.Password); err != nil {
-		return err
+	res, err := s.db.Exec(query, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	id, err := res.LastInsertId()
+	return int(id), err
 }
 
 func (s *AuthSqlite) GetUser(username, email string) (models.User, error) {
 	query := `
-		SELECT ID, Username, Email, Password FROM USERS WHERE Username=$1 or Email = $2;
+		SELECT ID, Username, Email, Password, CreatedAt, UpdatedAt, EmailVerifiedAt IS NOT NULL, Role FROM USERS WHERE Username=$1 or Email = $2;
 	`
 
 	var user models.User
 
-	if err := s.db.QueryRow(query, username, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password); err != nil {
+	if err := s.db.QueryRow(query, username, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerified, &user.Role); err != nil {
 		return user, err
 	}
 
 	return user, nil
 }
 
-func (s *AuthSqlite) CreateSession(session models.Session) error {
+func (s *AuthSqlite) GetUserByID(ID int) (models.User, error) {
 	query := `
-		INSERT INTO SESSIONS (UserID, Token, ExpDate) VALUES ($1, $2, $3);
+		SELECT ID, Username, Email, Password, CreatedAt, UpdatedAt, EmailVerifiedAt IS NOT NULL, Role FROM USERS WHERE ID = ?;
 	`
 
-	if _, err := s.db.Exec(query, session.UserID, session.Token, session.ExpirationDate); err != nil {
-		return err
-	}
+	var user models.User
+	err := s.db.QueryRow(query, ID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerified, &user.Role)
+	return user, err
+}
 
-	return nil
+func (s *AuthSqlite) VerifyEmail(userID int, email string, at time.Time) error {
+	query := `
+		UPDATE USERS SET EmailVerifiedAt = $1 WHERE ID = $2 AND Email = $3 AND EmailVerifiedAt IS NULL;
+	`
+
+	_, err := s.db.Exec(query, at, userID, email)
+	return err
 }
 
-func (s *AuthSqlite) GetSession(token string) (models.Session, error) {
+func (s *AuthSqlite) SetRole(userID int, role models.Role) (bool, error) {
+	// Counting the admins in the update itself keeps two admins demoting
+	// each other at once from both succeeding.
 	query := `
-		SELECT ID, UserID, Token, ExpDate FROM SESSIONS WHERE Token = ?;
+		UPDATE USERS SET Role = $1
+		WHERE ID = $2 AND ($1 = 'admin' OR Role != 'admin' OR (SELECT COUNT(*) FROM USERS WHERE Role = 'admin') > 1);
 	`
-	var session models.Session
-	if err := s.db.QueryRow(query, token).Scan(&session.ID, &session.UserID, &session.Token, &session.ExpirationDate); err != nil {
-		return session, err
+
+	return execAffected(s.db, query, role, userID)
+}
+
+// GetStaff returns the admins then the moderators, by username.
+func (s *AuthSqlite) GetStaff() ([]models.User, error) {
+	query := `
+		SELECT ID, Username, Email, Password, CreatedAt, UpdatedAt, EmailVerifiedAt IS NOT NULL, Role FROM USERS
+		WHERE Role != 'user' ORDER BY Role = 'admin' DESC, Username;
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
 	}
-	return session, nil
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerified, &user.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
 
-func (s *AuthSqlite) DeleteSession(token string) error {
+func (s *AuthSqlite) CreateSession(session models.Session) (int, error) {
 	query := `
-		DELETE FROM SESSIONS WHERE Token = ?;
+		INSERT INTO SESSIONS (UserID, Token, ExpDate, CreatedAt, LastSeenAt, UserAgent, IP, Persistent) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
 	`
 
-	if _, err := s.db.Exec(query, token); err != nil {
-		return err
+	res, err := s.db.Exec(query, session.UserID, session.Token, session.ExpirationDate,
+		session.CreatedAt, session.LastSeenAt, session.UserAgent, session.IP, session.Persistent)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const querySelectSessions = `
+	SELECT ID, UserID, Token, ExpDate, CreatedAt, LastSeenAt, UserAgent, IP, Persistent FROM SESSIONS
+`
+
+func (s *AuthSqlite) GetSession(token string) (models.Session, error) {
+	return scanSession(s.db.QueryRow(querySelectSessions+` WHERE Token = ?`, token))
+}
+
+// GetSessions returns the sessions of the user, most recently seen first.
+func (s *AuthSqlite) GetSessions(userID int, now time.Time) ([]models.Session, error) {
+	rows, err := s.db.Query(querySelectSessions+` WHERE UserID = ? AND julianday(ExpDate) > julianday(?)
+		ORDER BY julianday(LastSeenAt) DESC, ID DESC`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
 }
 
-func (s *AuthSqlite) DeleteSessionByUserId(userID int) error {
+func scanSession(row scanner) (models.Session, error) {
+	var session models.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.Token, &session.ExpirationDate,
+		&session.CreatedAt, &session.LastSeenAt, &session.UserAgent, &session.IP, &session.Persistent)
+	return session, err
+}
+
+func (s *AuthSqlite) DeleteSession(token string) error {
 	query := `
-		DELETE FROM SESSIONS WHERE UserID = ?;
+		DELETE FROM SESSIONS WHERE Token = ?;
 	`
 
-	if _, err := s.db.Exec(query, userID); err != nil {
+	if _, err := s.db.Exec(query, token); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *AuthSqlite) UserByToken(token string) (models.User, error) {
+func (s *AuthSqlite) UserByToken(token string, now time.Time) (models.User, error) {
 	query := `
-		SELECT USERS.ID, USERS.Username, USERS.Email, USERS.Password 
+		SELECT USERS.ID, USERS.Username, USERS.Email, USERS.Password, USERS.CreatedAt, USERS.UpdatedAt, USERS.EmailVerifiedAt IS NOT NULL, USERS.Role
 		FROM SESSIONS INNER JOIN USERS 
 		ON USERS.ID = SESSIONS.UserID
-		WHERE SESSIONS.Token = ?;
+		WHERE SESSIONS.Token = ? AND julianday(SESSIONS.ExpDate) > julianday(?);
 	`
 	var user models.User
-	if err := s.db.QueryRow(query, token).Scan(&user.ID, &user.Username, &user.Email, &user.Password); err != nil {
+	if err := s.db.QueryRow(query, token, now).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerified, &user.Role); err != nil {
 		return user, err
 	}
 	return user, nil
 }
+
+func (s *AuthSqlite) DeleteSessionByID(ID, userID int) (bool, error) {
+	query := `
+		DELETE FROM SESSIONS WHERE ID = ? AND UserID = ?;
+	`
+
+	res, err := s.db.Exec(query, ID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *AuthSqlite) DeleteOtherSessions(userID int, token string) error {
+	query := `
+		DELETE FROM SESSIONS WHERE UserID = ? AND Token != ?;
+	`
+
+	_, err := s.db.Exec(query, userID, token)
+	return err
+}
+
+func (s *AuthSqlite) TouchSession(token, ip string, seenAt time.Time, interval time.Duration) error {
+	query := `
+		UPDATE SESSIONS SET LastSeenAt = $1, IP = $2
+		WHERE Token = $3 AND (IP != $2 OR julianday(LastSeenAt) < julianday($4));
+	`
+
+	_, err := s.db.Exec(query, seenAt, ip, token, seenAt.Add(-interval))
+	return err
+}
+
+func (s *AuthSqlite) RenewSession(token string, expiresAt time.Time) error {
+	query := `
+		UPDATE SESSIONS SET ExpDate = ? WHERE Token = ?;
+	`
+
+	_, err := s.db.Exec(query, expiresAt, token)
+	return err
+}
+
+func (s *AuthSqlite) DeleteExpiredSessions(now time.Time) (int, error) {
+	query := `
+		DELETE FROM SESSIONS WHERE julianday(ExpDate) <= julianday(?);
+	`
+
+	res, err := s.db.Exec(query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 0, 0)
+	repo := NewAuthSqlite(db)
+	now := time.Now().UTC()
+
+	for token, expires := range map[string]time.Time{
+		"live":    now.Add(time.Hour),
+		"expired": now.Add(-time.Second),
+		"old":     now.Add(-time.Hour * 24 * 30),
+	} {
+		if _, err := repo.CreateSession(models.Session{UserID: userID, Token: token, ExpirationDate: expires, CreatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if user, err := repo.UserByToken("live", now); err != nil || user.ID != userID {
+		t.Errorf("UserByToken(live) = %+v, %v; want user %d", user, err, userID)
+	}
+	if _, err := repo.UserByToken("expired", now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UserByToken(expired) = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := repo.UserByToken("live", now.Add(time.Hour)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UserByToken(live) an hour later = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Renewing a session brings it back.
+	if err := repo.RenewSession("expired", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.UserByToken("expired", now); err != nil {
+		t.Errorf("UserByToken(renewed) = %v", err)
+	}
+
+	n, err := repo.DeleteExpiredSessions(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteExpiredSessions = %d, want 1", n)
+	}
+	sessions, err := repo.GetSessions(userID, now.Add(-time.Hour*24*365))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("%d sessions left, want the live and the renewed one", len(sessions))
+	}
+}
+
+func TestSetRoleKeepsAnAdmin(t *testing.T) {
+	db := openCountingDB(t)
+	aliceID, _ := seedListing(t, db, 0, 0)
+	repo := NewAuthSqlite(db)
+	now := time.Now().UTC()
+	bobID, err := repo.CreateUser(models.User{Username: "bob", Email: "bob@example.com", Password: "x", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		userID int
+		role   models.Role
+		ok     bool
+	}{
+		{aliceID, models.RoleAdmin, true},
+		// Alice is the only admin left.
+		{aliceID, models.RoleModerator, false},
+		{aliceID, models.RoleAdmin, true},
+		{bobID, models.RoleAdmin, true},
+		{aliceID, models.RoleUser, true},
+		{bobID, models.RoleModerator, false},
+		{bobID, models.RoleAdmin, true},
+	} {
+		ok, err := repo.SetRole(step.userID, step.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != step.ok {
+			t.Fatalf("SetRole(%d, %s) = %t, want %t", step.userID, step.role, ok, step.ok)
+		}
+	}
+
+	staff, err := repo.GetStaff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staff) != 1 || staff[0].ID != bobID || staff[0].Role != models.RoleAdmin {
+		t.Errorf("staff = %+v, want bob alone as admin", staff)
+	}
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"forum/internal/models"
+)
+
+type Category interface {
+	CreateCategory(category models.Category) error
+	GetCategories() ([]models.Category, error)
+	GetCategoryBySlug(slug string) (models.Category, error)
+	GetCategoryByID(ID int) (models.Category, error)
+	UpdateCategory(category models.Category) error
+}
+
+type CategorySqlite struct {
+	db *sql.DB
+}
+
+func NewCategorySqlite(db *sql.DB) *CategorySqlite {
+	return &CategorySqlite{
+		db: db,
+	}
+}
+
+func (s *CategorySqlite) CreateCategory(category models.Category) error {
+	query := `
+		INSERT INTO FORUM_CATEGORIES (Slug, Name, Description, Position, ParentID, Archived, CreatedAt, UpdatedAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.db.Exec(query, category.Slug, category.Name, category.Description, category.Position,
+		nullableID(category.ParentID), category.Archived, category.CreatedAt, category.UpdatedAt)
+	return err
+}
+
+// querySelectCategories selects categories with the number of their posts and
+// the time of the latest post or comment in them.
+const querySelectCategories = `
+	SELECT FORUM_CATEGORIES.ID, FORUM_CATEGORIES.Slug, FORUM_CATEGORIES.Name, FORUM_CATEGORIES.Description,
+		FORUM_CATEGORIES.Position, COALESCE(FORUM_CATEGORIES.ParentID, 0), FORUM_CATEGORIES.Archived,
+		FORUM_CATEGORIES.CreatedAt, FORUM_CATEGORIES.UpdatedAt,
+		(SELECT COUNT(*) FROM CATEGORIES WHERE CATEGORIES.Category = FORUM_CATEGORIES.Slug),
+		(SELECT MAX(Activity) FROM (
+			SELECT MAX(julianday(POSTS.CreatedAt)) AS Activity FROM POSTS
+			INNER JOIN CATEGORIES ON CATEGORIES.PostID = POSTS.ID WHERE CATEGORIES.Category = FORUM_CATEGORIES.Slug
+			UNION ALL
+			SELECT MAX(julianday(COMMENTS.CreatedAt)) FROM COMMENTS
+			INNER JOIN CATEGORIES ON CATEGORIES.PostID = COMMENTS.PostID WHERE CATEGORIES.Category = FORUM_CATEGORIES.Slug
+		))
+	FROM FORUM_CATEGORIES
+`
+
+// GetCategories returns every category, ordered by position.
+func (s *CategorySqlite) GetCategories() ([]models.Category, error) {
+	rows, err := s.db.Query(querySelectCategories + ` ORDER BY FORUM_CATEGORIES.Position, FORUM_CATEGORIES.ID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return categories, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+func (s *CategorySqlite) GetCategoryBySlug(slug string) (models.Category, error) {
+	return scanCategory(s.db.QueryRow(querySelectCategories+` WHERE FORUM_CATEGORIES.Slug = $1`, slug))
+}
+
+func (s *CategorySqlite) GetCategoryByID(ID int) (models.Category, error) {
+	return scanCategory(s.db.QueryRow(querySelectCategories+` WHERE FORUM_CATEGORIES.ID = $1`, ID))
+}
+
+func (s *CategorySqlite) UpdateCategory(category models.Category) error {
+	query := `
+		UPDATE FORUM_CATEGORIES SET Name = $1, Description = $2, Position = $3, ParentID = $4, Archived = $5, UpdatedAt = $6
+		WHERE ID = $7
+	`
+	_, err := s.db.Exec(query, category.Name, category.Description, category.Position,
+		nullableID(category.ParentID), category.Archived, category.UpdatedAt, category.ID)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCategory(row scanner) (models.Category, error) {
+	var (
+		category models.Category
+		activity sql.NullFloat64
+	)
+	err := row.Scan(&category.ID, &category.Slug, &category.Name, &category.Description,
+		&category.Position, &category.ParentID, &category.Archived, &category.CreatedAt, &category.UpdatedAt,
+		&category.PostCount, &activity)
+	if activity.Valid {
+		category.LastActivity = fromJulianDay(activity.Float64)
+	}
+	return category, err
+}
+
+// fromJulianDay converts a julianday() result back to a time.
+func fromJulianDay(day float64) time.Time {
+	const unixEpoch = 2440587.5
+	return time.Unix(0, int64((day-unixEpoch)*86400*float64(time.Second))).UTC()
+}
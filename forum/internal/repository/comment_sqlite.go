@@ -7,8 +7,11 @@ import (
 )
 
 type Commentary interface {
-	CreateComment(comment models.Comment) error
+	CreateComment(comment models.Comment) (int, error)
 	CommentsByPostID(ID int, userID int) ([]models.Comment, error)
+	GetCommentByID(commentID int) (models.Comment, error)
+	UpdateComment(comment models.Comment) error
+	DeleteComment(commentID int) error
 }
 
 type CommentSqlite struct {
@@ -21,32 +24,102 @@ func NewCommentSqlite(db *sql.DB) *CommentSqlite {
 	}
 }
 
-func (s *CommentSqlite) CreateComment(comment models.Comment) error {
+func (s *CommentSqlite) CreateComment(comment models.Comment) (int, error) {
 	query := `
-        INSERT INTO COMMENTS(AuthorID, PostID, Content) VALUES ($1, $2, $3)
+        INSERT INTO COMMENTS(AuthorID, PostID, ParentID, Content, CreatedAt, UpdatedAt) VALUES ($1, $2, $3, $4, $5, $6)
     `
 
-	if _, err := s.db.Exec(query, comment.UserID, comment.PostID, comment.Content); err != nil {
+	res, err := s.db.Exec(query, comment.UserID, comment.PostID, nullableID(comment.ParentID), comment.Content, comment.CreatedAt, comment.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *CommentSqlite) GetCommentByID(commentID int) (models.Comment, error) {
+	query := `
+		SELECT COMMENTS.ID, COMMENTS.AuthorID, COMMENTS.PostID, COALESCE(COMMENTS.ParentID, 0), COMMENTS.Content, COALESCE(USERS.Username, ''), COMMENTS.CreatedAt, COMMENTS.UpdatedAt, COMMENTS.Deleted
+		FROM COMMENTS LEFT JOIN USERS ON USERS.ID=COMMENTS.AuthorID 
+		WHERE COMMENTS.ID = $1
+	`
+
+	var comment models.Comment
+	if err := s.db.QueryRow(query, commentID).Scan(&comment.ID, &comment.UserID, &comment.PostID, &comment.ParentID, &comment.Content, &comment.Author, &comment.CreatedAt, &comment.UpdatedAt, &comment.Deleted); err != nil {
+		return comment, err
+	}
+
+	return comment, nil
+}
+
+func (s *CommentSqlite) UpdateComment(comment models.Comment) error {
+	query := `
+		UPDATE COMMENTS SET Content = $1, UpdatedAt = $2 WHERE ID = $3
+	`
+
+	if _, err := s.db.Exec(query, comment.Content, comment.UpdatedAt, comment.ID); err != nil {
 		return err
 	}
 	return nil
 }
 
+// DeleteComment removes the comment and the reactions left on it. A comment
+// with replies is only blanked and marked deleted, so that the replies of
+// other users stay in their thread; the deleted comments left without
+// replies once it is gone are removed along with it.
+func (s *CommentSqlite) DeleteComment(commentID int) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM REACTIONS WHERE CommentID = $1`, commentID); err != nil {
+			return err
+		}
+
+		var replies int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM COMMENTS WHERE ParentID = $1`, commentID).Scan(&replies); err != nil {
+			return err
+		}
+		if replies > 0 {
+			_, err := tx.Exec(`UPDATE COMMENTS SET Content = '', AuthorID = 0, Deleted = 1 WHERE ID = $1`, commentID)
+			return err
+		}
+
+		for commentID != 0 {
+			var parentID int
+			if err := tx.QueryRow(`SELECT COALESCE(ParentID, 0) FROM COMMENTS WHERE ID = $1`, commentID).Scan(&parentID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`DELETE FROM COMMENTS WHERE ID = $1`, commentID); err != nil {
+				return err
+			}
+
+			err := tx.QueryRow(`
+				SELECT ID FROM COMMENTS
+				WHERE ID = $1 AND Deleted = 1 AND NOT EXISTS (SELECT 1 FROM COMMENTS AS REPLIES WHERE REPLIES.ParentID = COMMENTS.ID)
+			`, parentID).Scan(&commentID)
+			if errors.Is(err, sql.ErrNoRows) {
+				commentID = 0
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CommentsByPostID returns every comment of a post in the order they were
+// written, with their feedback counters and the vote of userID, in one query.
 func (s *CommentSqlite) CommentsByPostID(ID int, userID int) ([]models.Comment, error) {
 	query := `
-		SELECT COMMENTS.ID, COMMENTS.AuthorID, COMMENTS.PostID, COMMENTS.Content, USERS.Username 
-		FROM COMMENTS INNER JOIN USERS ON USERS.ID=COMMENTS.AuthorID 
-		WHERE COMMENTS.PostID = $1
+		SELECT COMMENTS.ID, COMMENTS.AuthorID, COMMENTS.PostID, COALESCE(COMMENTS.ParentID, 0), COMMENTS.Content, COALESCE(USERS.Username, ''), COMMENTS.CreatedAt, COMMENTS.UpdatedAt, COMMENTS.Deleted,
+			(SELECT COUNT(*) FROM REACTIONS WHERE REACTIONS.CommentID = COMMENTS.ID AND REACTIONS.VOTE = 1),
+			(SELECT COUNT(*) FROM REACTIONS WHERE REACTIONS.CommentID = COMMENTS.ID AND REACTIONS.VOTE = -1),
+			COALESCE((SELECT REACTIONS.VOTE FROM REACTIONS WHERE REACTIONS.CommentID = COMMENTS.ID AND REACTIONS.UserID = $1), 0)
+		FROM COMMENTS LEFT JOIN USERS ON USERS.ID=COMMENTS.AuthorID 
+		WHERE COMMENTS.PostID = $2
+		ORDER BY COMMENTS.ID
 	`
 
-	queryCount := `
-		SELECT COUNT(*), (
-			SELECT COUNT(*) FROM REACTIONS WHERE VOTE=-1 AND CommentID = $1
-		)
-		FROM REACTIONS WHERE VOTE=1 AND CommentID = $1
-	`
-
-	rows, err := s.db.Query(query, ID)
+	rows, err := s.db.Query(query, userID, ID)
 	if err != nil {
 		return nil, err
 	}
@@ -55,23 +128,11 @@ func (s *CommentSqlite) CommentsByPostID(ID int, userID int) ([]models.Comment,
 	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.PostID, &comment.Content, &comment.Author); err != nil {
-			return comments, err
-		}
-
-		if err := s.db.QueryRow(queryCount, &comment.ID).Scan(&comment.LikeCount, &comment.DislikeCount); err != nil {
+		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.PostID, &comment.ParentID, &comment.Content, &comment.Author, &comment.CreatedAt, &comment.UpdatedAt, &comment.Deleted,
+			&comment.LikeCount, &comment.DislikeCount, &comment.Vote); err != nil {
 			return comments, err
 		}
 
-		vote, err := s.getCommentReactions(userID, comment.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return comments, err
-			}
-			vote = 0
-		}
-		comment.Vote = vote
-
 		comments = append(comments, comment)
 	}
 
@@ -82,15 +143,6 @@ func (s *CommentSqlite) CommentsByPostID(ID int, userID int) ([]models.Comment,
 	return comments, nil
 }
 
-func (s *CommentSqlite) getCommentReactions(UserID int, CommentID int) (int, error) {
-	query := `
-		SELECT VOTE FROM REACTIONS WHERE UserID = $1 AND CommentID = $2
-	`
-
-	var vote int
-	if err := s.db.QueryRow(query, UserID, CommentID).Scan(&vote); err != nil {
-		return vote, err
-	}
-
-	return vote, nil
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
 }
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+// TestDeleteCommentKeepsReplies deletes a comment another user replied to:
+// the reply stays in the thread under a blank comment, which goes away
+// with the last of its replies.
+func TestDeleteCommentKeepsReplies(t *testing.T) {
+	db := openCountingDB(t)
+	aliceID, postID := seedListing(t, db, 1, 0)
+	now := time.Now().UTC()
+	bobID, err := NewAuthSqlite(db).CreateUser(models.User{Username: "bob", Email: "bob@example.com", Password: "x", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewCommentSqlite(db)
+	create := func(userID, parentID int, content string) int {
+		t.Helper()
+		id, err := repo.CreateComment(models.Comment{UserID: userID, PostID: postID, ParentID: parentID, Content: content, CreatedAt: now, UpdatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	parentID := create(aliceID, 0, "first")
+	replyID := create(bobID, parentID, "reply by bob")
+	leafID := create(aliceID, 0, "second")
+
+	if err := repo.DeleteComment(parentID); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := repo.GetCommentByID(parentID)
+	if err != nil {
+		t.Fatalf("comment with a reply is gone: %v", err)
+	}
+	if !parent.Deleted || parent.Content != "" || parent.UserID != 0 || parent.Author != "" {
+		t.Errorf("deleted comment = %+v, want it blank and marked deleted", parent)
+	}
+	reply, err := repo.GetCommentByID(replyID)
+	if err != nil {
+		t.Fatalf("reply by bob is gone: %v", err)
+	}
+	if reply.Content != "reply by bob" || reply.ParentID != parentID {
+		t.Errorf("reply by bob = %+v, want it unchanged", reply)
+	}
+
+	comments, err := repo.CommentsByPostID(postID, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 3 {
+		t.Errorf("%d comments listed, want the deleted one, its reply and the second one", len(comments))
+	}
+
+	// A comment without replies is removed for good.
+	if err := repo.DeleteComment(leafID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetCommentByID(leafID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetCommentByID(leaf) = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// So is the deleted comment once its last reply goes.
+	if err := repo.DeleteComment(replyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetCommentByID(parentID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetCommentByID(deleted parent) = %v, want %v", err, sql.ErrNoRows)
+	}
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"forum/internal/models"
+)
+
+type LoginThrottle interface {
+	GetLoginThrottle(kind, value string) (models.LoginThrottle, error)
+	// SaveLoginThrottle inserts the throttle or replaces the one with the
+	// same kind and value.
+	SaveLoginThrottle(throttle models.LoginThrottle) error
+	DeleteLoginThrottle(kind, value string) error
+	// GetLockedThrottles returns the throttles locked at now, the longest
+	// locked first.
+	GetLockedThrottles(now time.Time) ([]models.LoginThrottle, error)
+	// DeleteStaleLoginThrottles deletes the throttles without failures
+	// since before and not locked past it.
+	DeleteStaleLoginThrottles(before time.Time) error
+}
+
+type LoginThrottleSqlite struct {
+	db *sql.DB
+}
+
+func NewLoginThrottleSqlite(db *sql.DB) *LoginThrottleSqlite {
+	return &LoginThrottleSqlite{
+		db: db,
+	}
+}
+
+const querySelectLoginThrottles = `
+	SELECT Kind, Value, Failures, LastFailureAt, LockedUntil FROM LOGIN_THROTTLES
+`
+
+func (s *LoginThrottleSqlite) GetLoginThrottle(kind, value string) (models.LoginThrottle, error) {
+	return scanLoginThrottle(s.db.QueryRow(querySelectLoginThrottles+` WHERE Kind = ? AND Value = ?`, kind, value))
+}
+
+func (s *LoginThrottleSqlite) SaveLoginThrottle(throttle models.LoginThrottle) error {
+	query := `
+		INSERT OR REPLACE INTO LOGIN_THROTTLES (Kind, Value, Failures, LastFailureAt, LockedUntil) VALUES ($1, $2, $3, $4, $5);
+	`
+
+	var lockedUntil interface{}
+	if !throttle.LockedUntil.IsZero() {
+		lockedUntil = throttle.LockedUntil
+	}
+
+	_, err := s.db.Exec(query, throttle.Kind, throttle.Value, throttle.Failures, throttle.LastFailureAt, lockedUntil)
+	return err
+}
+
+func (s *LoginThrottleSqlite) DeleteLoginThrottle(kind, value string) error {
+	query := `
+		DELETE FROM LOGIN_THROTTLES WHERE Kind = ? AND Value = ?;
+	`
+
+	_, err := s.db.Exec(query, kind, value)
+	return err
+}
+
+func (s *LoginThrottleSqlite) GetLockedThrottles(now time.Time) ([]models.LoginThrottle, error) {
+	rows, err := s.db.Query(querySelectLoginThrottles+` WHERE julianday(LockedUntil) > julianday(?) ORDER BY julianday(LockedUntil) DESC`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var throttles []models.LoginThrottle
+	for rows.Next() {
+		throttle, err := scanLoginThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, throttle)
+	}
+	return throttles, rows.Err()
+}
+
+func (s *LoginThrottleSqlite) DeleteStaleLoginThrottles(before time.Time) error {
+	query := `
+		DELETE FROM LOGIN_THROTTLES
+		WHERE julianday(LastFailureAt) < julianday($1) AND (LockedUntil IS NULL OR julianday(LockedUntil) < julianday($1));
+	`
+
+	_, err := s.db.Exec(query, before)
+	return err
+}
+
+func scanLoginThrottle(row scanner) (models.LoginThrottle, error) {
+	var (
+		throttle    models.LoginThrottle
+		lockedUntil sql.NullTime
+	)
+	err := row.Scan(&throttle.Kind, &throttle.Value, &throttle.Failures, &throttle.LastFailureAt, &lockedUntil)
+	throttle.LockedUntil = lockedUntil.Time
+	return throttle, err
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+func TestDeleteStaleLoginThrottles(t *testing.T) {
+	repo := NewLoginThrottleSqlite(openCountingDB(t))
+	now := time.Now().UTC()
+	before := now.Add(-time.Hour * 24)
+
+	for _, throttle := range []models.LoginThrottle{
+		{Kind: models.ThrottleIP, Value: "recent", Failures: 1, LastFailureAt: now.Add(-time.Hour)},
+		{Kind: models.ThrottleIP, Value: "stale", Failures: 3, LastFailureAt: before.Add(-time.Minute)},
+		{Kind: models.ThrottleAccount, Value: "stale", Failures: 10, LastFailureAt: before.Add(-time.Hour), LockedUntil: before.Add(-time.Minute * 30)},
+		// Failed long ago, yet still locked.
+		{Kind: models.ThrottleAccount, Value: "locked", Failures: 10, LastFailureAt: before.Add(-time.Hour), LockedUntil: now.Add(time.Hour)},
+	} {
+		if err := repo.SaveLoginThrottle(throttle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.DeleteStaleLoginThrottles(before); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range [][2]string{
+		{models.ThrottleIP, "recent"},
+		{models.ThrottleAccount, "locked"},
+	} {
+		if _, err := repo.GetLoginThrottle(key[0], key[1]); err != nil {
+			t.Errorf("%s %s: %v, want it kept", key[0], key[1], err)
+		}
+	}
+	for _, key := range [][2]string{
+		{models.ThrottleIP, "stale"},
+		{models.ThrottleAccount, "stale"},
+	} {
+		if _, err := repo.GetLoginThrottle(key[0], key[1]); err == nil {
+			t.Errorf("%s %s is kept, want it deleted", key[0], key[1])
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package repository
+
+// migrations lists every schema change in the order it has to be applied.
+// Versions must be unique and increasing; never edit a migration that has
+// already been released, add a new one instead.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create_tables",
+		Up: `
+			CREATE TABLE IF NOT EXISTS USERS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				Username TEXT NOT NULL UNIQUE,
+				Email TEXT NOT NULL UNIQUE,
+				Password TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS SESSIONS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL UNIQUE,
+				Token VARCHAR(32) NOT NULL,
+				ExpDate DATATIME NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS POSTS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				AuthorID INTEGER NOT NULL,
+				Title TEXT NOT NULL,
+				Content TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS COMMENTS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				AuthorID INTEGER NOT NULL,
+				PostID INTEGER NOT NULL,
+				Content TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS REACTIONS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				PostID INTEGER,
+				CommentID INTEGER,
+				VOTE BLOB NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS CATEGORIES(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				PostID INTEGER NOT NULL,
+				Category TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS IMAGES(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				PostID INTEGER,
+				Image TEXT,
+				FOREIGN KEY(PostID) REFERENCES POSTS(ID)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS IMAGES;
+			DROP TABLE IF EXISTS CATEGORIES;
+			DROP TABLE IF EXISTS REACTIONS;
+			DROP TABLE IF EXISTS COMMENTS;
+			DROP TABLE IF EXISTS POSTS;
+			DROP TABLE IF EXISTS SESSIONS;
+			DROP TABLE IF EXISTS USERS;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "add_timestamps",
+		Up: `
+			ALTER TABLE USERS ADD COLUMN CreatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE USERS ADD COLUMN UpdatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE POSTS ADD COLUMN CreatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE POSTS ADD COLUMN UpdatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE COMMENTS ADD COLUMN CreatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE COMMENTS ADD COLUMN UpdatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE REACTIONS ADD COLUMN CreatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			ALTER TABLE REACTIONS ADD COLUMN UpdatedAt DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+			UPDATE USERS SET CreatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), UpdatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+			UPDATE POSTS SET CreatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), UpdatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+			UPDATE COMMENTS SET CreatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), UpdatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+			UPDATE REACTIONS SET CreatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), UpdatedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+		`,
+		Down: `
+			ALTER TABLE REACTIONS DROP COLUMN UpdatedAt;
+			ALTER TABLE REACTIONS DROP COLUMN CreatedAt;
+			ALTER TABLE COMMENTS DROP COLUMN UpdatedAt;
+			ALTER TABLE COMMENTS DROP COLUMN CreatedAt;
+			ALTER TABLE POSTS DROP COLUMN UpdatedAt;
+			ALTER TABLE POSTS DROP COLUMN CreatedAt;
+			ALTER TABLE USERS DROP COLUMN UpdatedAt;
+			ALTER TABLE USERS DROP COLUMN CreatedAt;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "add_post_revisions",
+		Up: `
+			CREATE TABLE IF NOT EXISTS POST_REVISIONS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				PostID INTEGER NOT NULL,
+				AuthorID INTEGER NOT NULL,
+				Title TEXT NOT NULL,
+				Content TEXT NOT NULL,
+				CreatedAt DATETIME NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS POST_REVISIONS_PostID ON POST_REVISIONS(PostID);
+			INSERT INTO POST_REVISIONS (PostID, AuthorID, Title, Content, CreatedAt)
+			SELECT ID, AuthorID, Title, Content, UpdatedAt FROM POSTS;
+		`,
+		Down: `
+			DROP TABLE IF EXISTS POST_REVISIONS;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "add_comment_parent",
+		Up: `
+			ALTER TABLE COMMENTS ADD COLUMN ParentID INTEGER;
+			CREATE INDEX IF NOT EXISTS COMMENTS_ParentID ON COMMENTS(ParentID);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS COMMENTS_ParentID;
+			ALTER TABLE COMMENTS DROP COLUMN ParentID;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add_listing_indexes",
+		Up: `
+			CREATE INDEX IF NOT EXISTS REACTIONS_PostID_UserID ON REACTIONS(PostID, UserID);
+			CREATE INDEX IF NOT EXISTS REACTIONS_CommentID_UserID ON REACTIONS(CommentID, UserID);
+			CREATE INDEX IF NOT EXISTS REACTIONS_UserID ON REACTIONS(UserID);
+			CREATE INDEX IF NOT EXISTS COMMENTS_PostID ON COMMENTS(PostID);
+			CREATE INDEX IF NOT EXISTS CATEGORIES_PostID ON CATEGORIES(PostID);
+			CREATE INDEX IF NOT EXISTS CATEGORIES_Category ON CATEGORIES(Category);
+			CREATE INDEX IF NOT EXISTS IMAGES_PostID ON IMAGES(PostID);
+			CREATE INDEX IF NOT EXISTS POSTS_AuthorID ON POSTS(AuthorID);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS POSTS_AuthorID;
+			DROP INDEX IF EXISTS IMAGES_PostID;
+			DROP INDEX IF EXISTS CATEGORIES_Category;
+			DROP INDEX IF EXISTS CATEGORIES_PostID;
+			DROP INDEX IF EXISTS COMMENTS_PostID;
+			DROP INDEX IF EXISTS REACTIONS_UserID;
+			DROP INDEX IF EXISTS REACTIONS_CommentID_UserID;
+			DROP INDEX IF EXISTS REACTIONS_PostID_UserID;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "add_search_index",
+		Up: `
+			CREATE VIRTUAL TABLE IF NOT EXISTS POSTS_FTS USING fts5(Title, Content, content='POSTS', content_rowid='ID');
+			CREATE VIRTUAL TABLE IF NOT EXISTS COMMENTS_FTS USING fts5(Content, content='COMMENTS', content_rowid='ID');
+
+			CREATE TRIGGER IF NOT EXISTS POSTS_FTS_INSERT AFTER INSERT ON POSTS BEGIN
+				INSERT INTO POSTS_FTS(rowid, Title, Content) VALUES (new.ID, new.Title, new.Content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS POSTS_FTS_DELETE AFTER DELETE ON POSTS BEGIN
+				INSERT INTO POSTS_FTS(POSTS_FTS, rowid, Title, Content) VALUES ('delete', old.ID, old.Title, old.Content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS POSTS_FTS_UPDATE AFTER UPDATE OF Title, Content ON POSTS BEGIN
+				INSERT INTO POSTS_FTS(POSTS_FTS, rowid, Title, Content) VALUES ('delete', old.ID, old.Title, old.Content);
+				INSERT INTO POSTS_FTS(rowid, Title, Content) VALUES (new.ID, new.Title, new.Content);
+			END;
+
+			CREATE TRIGGER IF NOT EXISTS COMMENTS_FTS_INSERT AFTER INSERT ON COMMENTS BEGIN
+				INSERT INTO COMMENTS_FTS(rowid, Content) VALUES (new.ID, new.Content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS COMMENTS_FTS_DELETE AFTER DELETE ON COMMENTS BEGIN
+				INSERT INTO COMMENTS_FTS(COMMENTS_FTS, rowid, Content) VALUES ('delete', old.ID, old.Content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS COMMENTS_FTS_UPDATE AFTER UPDATE OF Content ON COMMENTS BEGIN
+				INSERT INTO COMMENTS_FTS(COMMENTS_FTS, rowid, Content) VALUES ('delete', old.ID, old.Content);
+				INSERT INTO COMMENTS_FTS(rowid, Content) VALUES (new.ID, new.Content);
+			END;
+
+			INSERT INTO POSTS_FTS(POSTS_FTS) VALUES ('rebuild');
+			INSERT INTO COMMENTS_FTS(COMMENTS_FTS) VALUES ('rebuild');
+		`,
+		Down: `
+			DROP TRIGGER IF EXISTS COMMENTS_FTS_UPDATE;
+			DROP TRIGGER IF EXISTS COMMENTS_FTS_DELETE;
+			DROP TRIGGER IF EXISTS COMMENTS_FTS_INSERT;
+			DROP TRIGGER IF EXISTS POSTS_FTS_UPDATE;
+			DROP TRIGGER IF EXISTS POSTS_FTS_DELETE;
+			DROP TRIGGER IF EXISTS POSTS_FTS_INSERT;
+			DROP TABLE IF EXISTS COMMENTS_FTS;
+			DROP TABLE IF EXISTS POSTS_FTS;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "add_forum_categories",
+		Up: `
+			CREATE TABLE IF NOT EXISTS FORUM_CATEGORIES(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				Slug TEXT NOT NULL UNIQUE,
+				Name TEXT NOT NULL,
+				Description TEXT NOT NULL DEFAULT '',
+				Position INTEGER NOT NULL DEFAULT 0,
+				ParentID INTEGER,
+				Archived INTEGER NOT NULL DEFAULT 0,
+				CreatedAt DATETIME NOT NULL,
+				UpdatedAt DATETIME NOT NULL
+			);
+			INSERT INTO FORUM_CATEGORIES (Slug, Name, Position, CreatedAt, UpdatedAt) VALUES
+				('alem', 'Alem', 1, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+				('boats', 'Boats', 2, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+				('cars', 'Cars', 3, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+				('airplane', 'Airplane', 4, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+				('train', 'Train', 5, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+				('travel', 'Travel', 6, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+				('other', 'Other', 7, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'));
+			INSERT INTO FORUM_CATEGORIES (Slug, Name, Position, Archived, CreatedAt, UpdatedAt)
+			SELECT DISTINCT Category, Category, 100, 1, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')
+			FROM CATEGORIES WHERE Category NOT IN (SELECT Slug FROM FORUM_CATEGORIES);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS FORUM_CATEGORIES;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add_api_tokens",
+		Up: `
+			CREATE TABLE IF NOT EXISTS API_TOKENS(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Name TEXT NOT NULL,
+				Hash TEXT NOT NULL UNIQUE,
+				Scopes TEXT NOT NULL,
+				CreatedAt DATETIME NOT NULL,
+				LastUsedAt DATETIME,
+				RevokedAt DATETIME,
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+			CREATE INDEX IF NOT EXISTS API_TOKENS_USER ON API_TOKENS(UserID);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS API_TOKENS_USER;
+			DROP TABLE IF EXISTS API_TOKENS;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "allow_multiple_sessions",
+		Up: `
+			CREATE TABLE SESSIONS_NEW(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Token VARCHAR(32) NOT NULL UNIQUE,
+				ExpDate DATETIME NOT NULL,
+				CreatedAt DATETIME NOT NULL,
+				LastSeenAt DATETIME NOT NULL,
+				UserAgent TEXT NOT NULL DEFAULT '',
+				IP TEXT NOT NULL DEFAULT ''
+			);
+			INSERT INTO SESSIONS_NEW (ID, UserID, Token, ExpDate, CreatedAt, LastSeenAt)
+			SELECT ID, UserID, Token, ExpDate, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')
+			FROM SESSIONS;
+			DROP TABLE SESSIONS;
+			ALTER TABLE SESSIONS_NEW RENAME TO SESSIONS;
+			CREATE INDEX IF NOT EXISTS SESSIONS_USER ON SESSIONS(UserID);
+		`,
+		Down: `
+			CREATE TABLE SESSIONS_OLD(
+				ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL UNIQUE,
+				Token VARCHAR(32) NOT NULL,
+				ExpDate DATATIME NOT NULL
+			);
+			INSERT INTO SESSIONS_OLD (ID, UserID, Token, ExpDate)
+			SELECT ID, UserID, Token, ExpDate FROM SESSIONS
+			WHERE ID IN (SELECT MAX(ID) FROM SESSIONS GROUP BY UserID);
+			DROP TABLE SESSIONS;
+			ALTER TABLE SESSIONS_OLD RENAME TO SESSIONS;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "add_session_persistence",
+		Up: `
+			ALTER TABLE SESSIONS ADD COLUMN Persistent INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX IF NOT EXISTS SESSIONS_EXPIRY ON SESSIONS(ExpDate);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS SESSIONS_EXPIRY;
+			ALTER TABLE SESSIONS DROP COLUMN Persistent;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "add_login_throttles",
+		Up: `
+			CREATE TABLE IF NOT EXISTS LOGIN_THROTTLES(
+				Kind TEXT NOT NULL,
+				Value TEXT NOT NULL,
+				Failures INTEGER NOT NULL,
+				LastFailureAt DATETIME NOT NULL,
+				LockedUntil DATETIME,
+				PRIMARY KEY (Kind, Value)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS LOGIN_THROTTLES;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "add_password_resets",
+		Up: `
+			CREATE TABLE IF NOT EXISTS PASSWORD_RESETS(
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Hash TEXT NOT NULL UNIQUE,
+				CreatedAt DATETIME NOT NULL,
+				ExpiresAt DATETIME NOT NULL,
+				UsedAt DATETIME,
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+			CREATE INDEX IF NOT EXISTS PASSWORD_RESETS_USER ON PASSWORD_RESETS(UserID);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS PASSWORD_RESETS;
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "add_email_verification",
+		Up: `
+			ALTER TABLE USERS ADD COLUMN EmailVerifiedAt DATETIME;
+			UPDATE USERS SET EmailVerifiedAt = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+		`,
+		Down: `
+			ALTER TABLE USERS DROP COLUMN EmailVerifiedAt;
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "add_two_factor",
+		Up: `
+			CREATE TABLE IF NOT EXISTS TOTP(
+				UserID INTEGER NOT NULL PRIMARY KEY,
+				Secret TEXT NOT NULL,
+				CreatedAt DATETIME NOT NULL,
+				EnabledAt DATETIME,
+				LastStep INTEGER NOT NULL DEFAULT 0,
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+			CREATE TABLE IF NOT EXISTS RECOVERY_CODES(
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Hash TEXT NOT NULL,
+				UsedAt DATETIME,
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+			CREATE INDEX IF NOT EXISTS RECOVERY_CODES_USER ON RECOVERY_CODES(UserID);
+			CREATE TABLE IF NOT EXISTS LOGIN_CHALLENGES(
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Hash TEXT NOT NULL UNIQUE,
+				ExpiresAt DATETIME NOT NULL,
+				Attempts INTEGER NOT NULL DEFAULT 0,
+				Persistent INTEGER NOT NULL DEFAULT 0,
+				UserAgent TEXT NOT NULL DEFAULT '',
+				IP TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS LOGIN_CHALLENGES;
+			DROP TABLE IF EXISTS RECOVERY_CODES;
+			DROP TABLE IF EXISTS TOTP;
+		`,
+	},
+	{
+		Version: 15,
+		Name:    "add_passkeys",
+		Up: `
+			CREATE TABLE IF NOT EXISTS PASSKEYS(
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				CredentialID TEXT NOT NULL UNIQUE,
+				PublicKey BLOB NOT NULL,
+				SignCount INTEGER NOT NULL DEFAULT 0,
+				Name TEXT NOT NULL,
+				CreatedAt DATETIME NOT NULL,
+				LastUsedAt DATETIME,
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+			CREATE INDEX IF NOT EXISTS PASSKEYS_USER ON PASSKEYS(UserID);
+			CREATE TABLE IF NOT EXISTS WEBAUTHN_CHALLENGES(
+				Challenge TEXT NOT NULL PRIMARY KEY,
+				UserID INTEGER NOT NULL DEFAULT 0,
+				Kind TEXT NOT NULL,
+				ExpiresAt DATETIME NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS WEBAUTHN_CHALLENGES;
+			DROP TABLE IF EXISTS PASSKEYS;
+		`,
+	},
+	{
+		Version: 16,
+		Name:    "add_oidc",
+		Up: `
+			CREATE TABLE IF NOT EXISTS OIDC_IDENTITIES(
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Issuer TEXT NOT NULL,
+				Subject TEXT NOT NULL,
+				CreatedAt DATETIME NOT NULL,
+				UNIQUE(Issuer, Subject),
+				FOREIGN KEY(UserID) REFERENCES USERS(ID)
+			);
+			CREATE TABLE IF NOT EXISTS OIDC_LOGINS(
+				State TEXT NOT NULL PRIMARY KEY,
+				Nonce TEXT NOT NULL,
+				Verifier TEXT NOT NULL,
+				Persistent INTEGER NOT NULL DEFAULT 0,
+				ExpiresAt DATETIME NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS OIDC_LOGINS;
+			DROP TABLE IF EXISTS OIDC_IDENTITIES;
+		`,
+	},
+	{
+		Version: 17,
+		Name:    "add_user_roles",
+		Up: `
+			ALTER TABLE USERS ADD COLUMN Role TEXT NOT NULL DEFAULT 'user';
+		`,
+		Down: `
+			ALTER TABLE USERS DROP COLUMN Role;
+		`,
+	},
+	{
+		Version: 18,
+		Name:    "add_comment_deletion",
+		Up: `
+			ALTER TABLE COMMENTS ADD COLUMN Deleted INTEGER NOT NULL DEFAULT 0;
+		`,
+		Down: `
+			ALTER TABLE COMMENTS DROP COLUMN Deleted;
+		`,
+	},
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"forum/internal/models"
+)
+
+type OIDC interface {
+	CreateOIDCLogin(login models.OIDCLogin) error
+	// TakeOIDCLogin deletes the sign in and returns it, so that the
+	// provider's answer is only accepted once.
+	TakeOIDCLogin(state string) (models.OIDCLogin, error)
+	DeleteExpiredOIDCLogins(now time.Time) error
+
+	GetOIDCIdentity(issuer, subject string) (models.OIDCIdentity, error)
+	CreateOIDCIdentity(identity models.OIDCIdentity) error
+	// CreateOIDCUser creates a user together with their identity at the
+	// provider. The user has no usable password; their email address is
+	// verified if user.EmailVerified is set.
+	CreateOIDCUser(user models.User, identity models.OIDCIdentity) (int, error)
+}
+
+type OIDCSqlite struct {
+	db *sql.DB
+}
+
+func NewOIDCSqlite(db *sql.DB) *OIDCSqlite {
+	return &OIDCSqlite{
+		db: db,
+	}
+}
+
+func (s *OIDCSqlite) CreateOIDCLogin(login models.OIDCLogin) error {
+	query := `
+		INSERT INTO OIDC_LOGINS (State, Nonce, Verifier, Persistent, ExpiresAt) VALUES ($1, $2, $3, $4, $5);
+	`
+
+	_, err := s.db.Exec(query, login.State, login.Nonce, login.Verifier, login.Persistent, login.ExpiresAt)
+	return err
+}
+
+func (s *OIDCSqlite) TakeOIDCLogin(state string) (models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`SELECT State, Nonce, Verifier, Persistent, ExpiresAt FROM OIDC_LOGINS WHERE State = ?;`, state).
+			Scan(&login.State, &login.Nonce, &login.Verifier, &login.Persistent, &login.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM OIDC_LOGINS WHERE State = ?;`, state)
+		return err
+	})
+	return login, err
+}
+
+func (s *OIDCSqlite) DeleteExpiredOIDCLogins(now time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM OIDC_LOGINS WHERE julianday(ExpiresAt) <= julianday(?);`, now)
+	return err
+}
+
+func (s *OIDCSqlite) GetOIDCIdentity(issuer, subject string) (models.OIDCIdentity, error) {
+	query := `
+		SELECT ID, UserID, Issuer, Subject, CreatedAt FROM OIDC_IDENTITIES WHERE Issuer = $1 AND Subject = $2;
+	`
+
+	var identity models.OIDCIdentity
+	err := s.db.QueryRow(query, issuer, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.CreatedAt)
+	return identity, err
+}
+
+func (s *OIDCSqlite) CreateOIDCIdentity(identity models.OIDCIdentity) error {
+	return createOIDCIdentity(s.db, identity)
+}
+
+func (s *OIDCSqlite) CreateOIDCUser(user models.User, identity models.OIDCIdentity) (int, error) {
+	var verifiedAt sql.NullTime
+	if user.EmailVerified {
+		verifiedAt = sql.NullTime{Time: user.CreatedAt, Valid: true}
+	}
+
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO USERS (Username, Email, Password, CreatedAt, UpdatedAt, EmailVerifiedAt) VALUES ($1, $2, $3, $4, $5, $6);
+		`
+		res, err := tx.Exec(query, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt, verifiedAt)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		user.ID = int(id)
+		identity.UserID = user.ID
+		return createOIDCIdentity(tx, identity)
+	})
+	return user.ID, err
+}
+
+// execer is what a statement needs from a database or transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createOIDCIdentity(db execer, identity models.OIDCIdentity) error {
+	query := `
+		INSERT INTO OIDC_IDENTITIES (UserID, Issuer, Subject, CreatedAt) VALUES ($1, $2, $3, $4);
+	`
+
+	_, err := db.Exec(query, identity.UserID, identity.Issuer, identity.Subject, identity.CreatedAt)
+	return err
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"forum/internal/models"
+)
+
+type Passkey interface {
+	CreatePasskey(passkey models.Passkey) (int, error)
+	GetPasskeys(userID int) ([]models.Passkey, error)
+	GetPasskeyByCredentialID(credentialID string) (models.Passkey, error)
+	// UsePasskey records a sign in with the passkey and its new sign
+	// counter.
+	UsePasskey(ID int, signCount uint32, at time.Time) error
+	// DeletePasskey deletes a passkey of the user, reporting whether there
+	// was one.
+	DeletePasskey(ID, userID int) (bool, error)
+
+	CreateWebAuthnChallenge(challenge models.WebAuthnChallenge) error
+	// TakeWebAuthnChallenge deletes the challenge and returns it, so that
+	// it can only be answered once.
+	TakeWebAuthnChallenge(challenge string) (models.WebAuthnChallenge, error)
+	DeleteExpiredWebAuthnChallenges(now time.Time) error
+}
+
+type PasskeySqlite struct {
+	db *sql.DB
+}
+
+func NewPasskeySqlite(db *sql.DB) *PasskeySqlite {
+	return &PasskeySqlite{
+		db: db,
+	}
+}
+
+const querySelectPasskeys = `
+	SELECT ID, UserID, CredentialID, PublicKey, SignCount, Name, CreatedAt, LastUsedAt FROM PASSKEYS
+`
+
+func (s *PasskeySqlite) CreatePasskey(passkey models.Passkey) (int, error) {
+	query := `
+		INSERT INTO PASSKEYS (UserID, CredentialID, PublicKey, SignCount, Name, CreatedAt) VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	res, err := s.db.Exec(query, passkey.UserID, passkey.CredentialID, passkey.PublicKey,
+		passkey.SignCount, passkey.Name, passkey.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *PasskeySqlite) GetPasskeys(userID int) ([]models.Passkey, error) {
+	rows, err := s.db.Query(querySelectPasskeys+` WHERE UserID = ? ORDER BY ID`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+func (s *PasskeySqlite) GetPasskeyByCredentialID(credentialID string) (models.Passkey, error) {
+	return scanPasskey(s.db.QueryRow(querySelectPasskeys+` WHERE CredentialID = ?`, credentialID))
+}
+
+func (s *PasskeySqlite) UsePasskey(ID int, signCount uint32, at time.Time) error {
+	query := `
+		UPDATE PASSKEYS SET SignCount = $1, LastUsedAt = $2 WHERE ID = $3;
+	`
+
+	_, err := s.db.Exec(query, signCount, at, ID)
+	return err
+}
+
+func (s *PasskeySqlite) DeletePasskey(ID, userID int) (bool, error) {
+	return execAffected(s.db, `DELETE FROM PASSKEYS WHERE ID = ? AND UserID = ?;`, ID, userID)
+}
+
+func (s *PasskeySqlite) CreateWebAuthnChallenge(challenge models.WebAuthnChallenge) error {
+	query := `
+		INSERT INTO WEBAUTHN_CHALLENGES (Challenge, UserID, Kind, ExpiresAt) VALUES ($1, $2, $3, $4);
+	`
+
+	_, err := s.db.Exec(query, challenge.Challenge, challenge.UserID, challenge.Kind, challenge.ExpiresAt)
+	return err
+}
+
+func (s *PasskeySqlite) TakeWebAuthnChallenge(challenge string) (models.WebAuthnChallenge, error) {
+	var c models.WebAuthnChallenge
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`SELECT Challenge, UserID, Kind, ExpiresAt FROM WEBAUTHN_CHALLENGES WHERE Challenge = ?;`, challenge).
+			Scan(&c.Challenge, &c.UserID, &c.Kind, &c.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM WEBAUTHN_CHALLENGES WHERE Challenge = ?;`, challenge)
+		return err
+	})
+	return c, err
+}
+
+func (s *PasskeySqlite) DeleteExpiredWebAuthnChallenges(now time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM WEBAUTHN_CHALLENGES WHERE julianday(ExpiresAt) <= julianday(?);`, now)
+	return err
+}
+
+func scanPasskey(row scanner) (models.Passkey, error) {
+	var (
+		passkey    models.Passkey
+		lastUsedAt sql.NullTime
+	)
+	err := row.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID, &passkey.PublicKey,
+		&passkey.SignCount, &passkey.Name, &passkey.CreatedAt, &lastUsedAt)
+	passkey.LastUsedAt = timePtr(lastUsedAt)
+	return passkey, err
+}
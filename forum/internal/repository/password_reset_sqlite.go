@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"forum/internal/models"
+)
+
+type PasswordReset interface {
+	CreatePasswordReset(reset models.PasswordReset) (int, error)
+	GetPasswordReset(hash string) (models.PasswordReset, error)
+	// ResetPassword uses up the reset, if it is still usable at now, to set
+	// the password hash of its user, sign them out everywhere and revoke
+	// their API tokens. It reports whether the reset was usable.
+	ResetPassword(resetID int, password string, now time.Time) (bool, error)
+}
+
+type PasswordResetSqlite struct {
+	db *sql.DB
+}
+
+func NewPasswordResetSqlite(db *sql.DB) *PasswordResetSqlite {
+	return &PasswordResetSqlite{
+		db: db,
+	}
+}
+
+func (s *PasswordResetSqlite) CreatePasswordReset(reset models.PasswordReset) (int, error) {
+	query := `
+		INSERT INTO PASSWORD_RESETS (UserID, Hash, CreatedAt, ExpiresAt) VALUES ($1, $2, $3, $4);
+	`
+
+	res, err := s.db.Exec(query, reset.UserID, reset.Hash, reset.CreatedAt, reset.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *PasswordResetSqlite) GetPasswordReset(hash string) (models.PasswordReset, error) {
+	query := `
+		SELECT r.ID, r.UserID, u.Username, r.Hash, r.CreatedAt, r.ExpiresAt, r.UsedAt
+		FROM PASSWORD_RESETS r
+		JOIN USERS u ON u.ID = r.UserID
+		WHERE r.Hash = ?;
+	`
+
+	var (
+		reset  models.PasswordReset
+		usedAt sql.NullTime
+	)
+	err := s.db.QueryRow(query, hash).Scan(&reset.ID, &reset.UserID, &reset.Username, &reset.Hash, &reset.CreatedAt, &reset.ExpiresAt, &usedAt)
+	reset.UsedAt = usedAt.Time
+	return reset, err
+}
+
+func (s *PasswordResetSqlite) ResetPassword(resetID int, password string, now time.Time) (bool, error) {
+	used := false
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		// Claiming the reset first makes it single-use even when two
+		// requests race.
+		res, err := tx.Exec(`
+			UPDATE PASSWORD_RESETS SET UsedAt = $1
+			WHERE ID = $2 AND UsedAt IS NULL AND julianday(ExpiresAt) > julianday($1);
+		`, now, resetID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		used = true
+
+		if _, err := tx.Exec(`
+			UPDATE USERS SET Password = $1, UpdatedAt = $2
+			WHERE ID = (SELECT UserID FROM PASSWORD_RESETS WHERE ID = $3);
+		`, password, now, resetID); err != nil {
+			return err
+		}
+
+		// The other links of the user, all their sessions, API tokens and
+		// passkeys go too: whoever knew the old password, or added a
+		// passkey with it, is signed out.
+		if _, err := tx.Exec(`
+			UPDATE PASSWORD_RESETS SET UsedAt = $1
+			WHERE UserID = (SELECT UserID FROM PASSWORD_RESETS WHERE ID = $2) AND UsedAt IS NULL;
+		`, now, resetID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM SESSIONS WHERE UserID = (SELECT UserID FROM PASSWORD_RESETS WHERE ID = ?);
+		`, resetID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE API_TOKENS SET RevokedAt = $1
+			WHERE UserID = (SELECT UserID FROM PASSWORD_RESETS WHERE ID = $2) AND RevokedAt IS NULL;
+		`, now, resetID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			DELETE FROM PASSKEYS WHERE UserID = (SELECT UserID FROM PASSWORD_RESETS WHERE ID = ?);
+		`, resetID)
+		return err
+	})
+	return used && err == nil, err
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+func TestResetPasswordSignsOutEverywhere(t *testing.T) {
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 0, 0)
+	now := time.Now().UTC()
+
+	if _, err := NewAuthSqlite(db).CreateSession(models.Session{UserID: userID, Token: "session", ExpirationDate: now.Add(time.Hour), CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := NewAPITokenSqlite(db)
+	tokenID, err := tokens.CreateAPIToken(models.APIToken{UserID: userID, Name: "ci", Hash: "token", Scopes: []models.Scope{models.ScopeRead}, CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passkeys := NewPasskeySqlite(db)
+	if _, err := passkeys.CreatePasskey(models.Passkey{UserID: userID, CredentialID: "credential", PublicKey: []byte("key"), Name: "phone", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	resets := NewPasswordResetSqlite(db)
+	resetID, err := resets.CreatePasswordReset(models.PasswordReset{UserID: userID, Hash: "reset", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := resets.ResetPassword(resetID, "new hash", now); !ok || err != nil {
+		t.Fatalf("ResetPassword = %v, %v", ok, err)
+	}
+
+	var sessions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM SESSIONS WHERE UserID = ?`, userID).Scan(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 0 {
+		t.Errorf("%d sessions left after the reset", sessions)
+	}
+
+	_, token, err := tokens.UserByAPIToken("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID != tokenID || !token.Revoked() {
+		t.Errorf("API token after the reset: %+v, want it revoked", token)
+	}
+
+	if left, err := passkeys.GetPasskeys(userID); err != nil || len(left) != 0 {
+		t.Errorf("passkeys after the reset: %v, %v; want none", left, err)
+	}
+
+	if ok, err := resets.ResetPassword(resetID, "other hash", now); ok || err != nil {
+		t.Errorf("second ResetPassword = %v, %v; want the reset used up", ok, err)
+	}
+}
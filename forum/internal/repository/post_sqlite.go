@@ -2,20 +2,19 @@ package repository
 
 import (
 	"database/sql"
-	"errors"
-	"fmt"
 	"html/template"
+	"strings"
 
 	"forum/internal/models"
 )
 
 type Post interface {
-	CreatePost(post models.Post) error
+	CreatePost(post models.Post) (int, error)
 	GetPostById(postID, UserID int) (models.Post, error)
-	GetAllPosts(userID int) ([]models.Post, error)
-	GetAllUserPosts(userID int) ([]models.Post, error)
-	GetPostsByCategory(userID int, Category string) ([]models.Post, error)
-	GetLikedPosts(userID int) ([]models.Post, error)
+	GetPosts(userID int, filter models.PostFilter, page models.Page) ([]models.Post, error)
+	UpdatePost(post models.Post, editorID int) error
+	DeletePost(postID int) error
+	GetPostRevisions(postID int) ([]models.Revision, error)
 }
 
 type PostSqlite struct {
@@ -28,349 +27,397 @@ func NewPostSqlite(db *sql.DB) *PostSqlite {
 	}
 }
 
-const queryCountFeedback = `
-	SELECT COUNT(*), (
-		SELECT COUNT(*) FROM REACTIONS WHERE VOTE=-1 AND PostID = $1
-	), (
-		SELECT COUNT(*) FROM COMMENTS WHERE PostID = $1
-	)
-	FROM REACTIONS WHERE VOTE=1 AND PostID = $1
+const queryInsertRevision = `
+	INSERT INTO POST_REVISIONS (PostID, AuthorID, Title, Content, CreatedAt) VALUES ($1, $2, $3, $4, $5)
 `
 
-func (s *PostSqlite) CreatePost(post models.Post) error {
-	query := `
-        INSERT INTO POSTS (AuthorID, Title, Content) VALUES ($1, $2, $3)
-    `
+// CreatePost saves the post with its first revision, categories and images.
+func (s *PostSqlite) CreatePost(post models.Post) (int, error) {
+	var id int64
+	err := runInTx(s.db, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO POSTS (AuthorID, Title, Content, CreatedAt, UpdatedAt) VALUES ($1, $2, $3, $4, $5)
+		`
 
-	res, err := s.db.Exec(query, post.AuthorID, post.Title, post.Content)
-	if err != nil {
-		return err
-	}
+		res, err := tx.Exec(query, post.AuthorID, post.Title, post.Content, post.CreatedAt, post.UpdatedAt)
+		if err != nil {
+			return err
+		}
 
-	id, err := res.LastInsertId()
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(queryInsertRevision, id, post.AuthorID, post.Title, post.Content, post.CreatedAt); err != nil {
+			return err
+		}
+
+		for _, category := range post.Categories {
+			query := `
+				INSERT INTO CATEGORIES (PostID, Category) VALUES ($1, $2)
+			`
+			if _, err := tx.Exec(query, id, category); err != nil {
+				return err
+			}
+		}
+
+		for _, path := range post.ImagesPath {
+			query := `
+				INSERT INTO IMAGES (PostID, Image) VALUES ($1, $2)
+			`
+			if _, err := tx.Exec(query, id, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return int(id), nil
+}
 
-	for _, category := range post.Categories {
+// UpdatePost saves the new title, content and categories of the post and
+// records the new version in its revision history.
+func (s *PostSqlite) UpdatePost(post models.Post, editorID int) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
 		query := `
-			INSERT INTO CATEGORIES (PostID, Category) VALUES ($1, $2)
+			UPDATE POSTS SET Title = $1, Content = $2, UpdatedAt = $3 WHERE ID = $4
 		`
-		if _, err := s.db.Exec(query, id, category); err != nil {
+		if _, err := tx.Exec(query, post.Title, post.Content, post.UpdatedAt, post.ID); err != nil {
 			return err
 		}
-	}
 
-	for _, path := range post.ImagesPath {
-		query := `
-			INSERT INTO IMAGES (PostID, Image) VALUES ($1, $2)
-		`
-		if _, err := s.db.Exec(query, id, path); err != nil {
+		if _, err := tx.Exec(queryInsertRevision, post.ID, editorID, post.Title, post.Content, post.UpdatedAt); err != nil {
 			return err
 		}
-	}
 
-	return nil
-}
+		if _, err := tx.Exec(`DELETE FROM CATEGORIES WHERE PostID = $1`, post.ID); err != nil {
+			return err
+		}
 
-func (s *PostSqlite) GetPostById(postID, UserID int) (models.Post, error) {
-	query := `
-		SELECT POSTS.ID, POSTS.AuthorID, POSTS.Title, POSTS.Content, USERS.Username 
-		FROM POSTS INNER JOIN USERS ON USERS.ID=POSTS.AuthorID 
-		WHERE POSTS.ID = $1
-	`
+		for _, category := range post.Categories {
+			query := `
+				INSERT INTO CATEGORIES (PostID, Category) VALUES ($1, $2)
+			`
+			if _, err := tx.Exec(query, post.ID, category); err != nil {
+				return err
+			}
+		}
 
-	var post models.Post
-	if err := s.db.QueryRow(query, postID).Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.Author); err != nil {
-		return post, err
-	}
+		return nil
+	})
+}
 
-	if err := s.db.QueryRow(queryCountFeedback, &post.ID).Scan(&post.LikeCount, &post.DislikeCount, &post.CommentCount); err != nil {
-		return post, err
+// DeletePost removes the post together with its categories, images, revisions,
+// comments and every reaction left on the post or its comments.
+func (s *PostSqlite) DeletePost(postID int) error {
+	queries := []string{
+		`DELETE FROM REACTIONS WHERE PostID = $1 OR CommentID IN (SELECT ID FROM COMMENTS WHERE PostID = $1)`,
+		`DELETE FROM COMMENTS WHERE PostID = $1`,
+		`DELETE FROM CATEGORIES WHERE PostID = $1`,
+		`DELETE FROM IMAGES WHERE PostID = $1`,
+		`DELETE FROM POST_REVISIONS WHERE PostID = $1`,
+		`DELETE FROM POSTS WHERE ID = $1`,
 	}
 
-	categories, err := s.getPostCategories(post.ID)
-	if err != nil {
-		return post, err
-	}
-	post.Categories = categories
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		for _, query := range queries {
+			if _, err := tx.Exec(query, postID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// querySelectPosts selects posts together with their feedback counters and
+// the vote of the user passed as the first argument, so a whole listing is
+// read in a single statement.
+var querySelectPosts = selectPosts(`0`)
+
+// selectPosts builds querySelectPosts with score as the expression of the
+// score of the posts, their last column.
+func selectPosts(score string) string {
+	return `
+	SELECT POSTS.ID, POSTS.AuthorID, POSTS.Title, POSTS.Content, USERS.Username, POSTS.CreatedAt, POSTS.UpdatedAt,
+		(SELECT COUNT(*) FROM REACTIONS WHERE REACTIONS.PostID = POSTS.ID AND REACTIONS.VOTE = 1),
+		(SELECT COUNT(*) FROM REACTIONS WHERE REACTIONS.PostID = POSTS.ID AND REACTIONS.VOTE = -1),
+		(SELECT COUNT(*) FROM COMMENTS WHERE COMMENTS.PostID = POSTS.ID),
+		COALESCE((SELECT REACTIONS.VOTE FROM REACTIONS WHERE REACTIONS.PostID = POSTS.ID AND REACTIONS.UserID = ?), 0),
+		` + score + `
+	FROM POSTS INNER JOIN USERS ON USERS.ID=POSTS.AuthorID
+`
+}
 
-	vote, err := s.getReactionToPost(UserID, post.ID)
+func (s *PostSqlite) GetPostById(postID, UserID int) (models.Post, error) {
+	posts, err := s.queryPosts(querySelectPosts+` WHERE POSTS.ID = ?`, UserID, postID)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return post, err
-		}
-		vote = 0
+		return models.Post{}, err
 	}
-	post.Vote = vote
 
-	images, err := s.getPostImages(post.ID)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return post, err
-		}
+	if len(posts) == 0 {
+		return models.Post{}, sql.ErrNoRows
 	}
-	post.ImagesPath = images
 
-	return post, nil
+	return posts[0], nil
 }
 
-func (s *PostSqlite) GetAllPosts(userID int) ([]models.Post, error) {
-	query := `
-		SELECT POSTS.ID, POSTS.AuthorID, POSTS.Title, POSTS.Content, USERS.Username 
-		FROM POSTS INNER JOIN USERS ON USERS.ID=POSTS.AuthorID
-		ORDER BY POSTS.ID DESC
-	`
-
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, err
-	}
+// GetPosts returns one page of the posts matching the filter.
+func (s *PostSqlite) GetPosts(userID int, filter models.PostFilter, page models.Page) ([]models.Post, error) {
+	where, args := filterClause(filter)
+	return s.listPosts(userID, where, args, page)
+}
 
-	defer rows.Close()
+// filterClause turns a filter into a condition on the rows of querySelectPosts.
+func filterClause(filter models.PostFilter) (string, []interface{}) {
+	conds := []string{`1 = 1`}
+	var args []interface{}
 
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.Author); err != nil {
-			return posts, err
+	if len(filter.Categories) > 0 {
+		cond := `POSTS.ID IN (SELECT CATEGORIES.PostID FROM CATEGORIES WHERE CATEGORIES.Category IN (` + placeholders(len(filter.Categories)) + `)`
+		for _, category := range filter.Categories {
+			args = append(args, category)
 		}
-
-		if err := s.db.QueryRow(queryCountFeedback, &post.ID).Scan(&post.LikeCount, &post.DislikeCount, &post.CommentCount); err != nil {
-			return posts, err
+		if filter.MatchAll {
+			cond += ` GROUP BY CATEGORIES.PostID HAVING COUNT(DISTINCT CATEGORIES.Category) = ?`
+			args = append(args, len(filter.Categories))
 		}
+		conds = append(conds, cond+`)`)
+	}
+	if filter.Author != "" {
+		conds = append(conds, `USERS.Username = ? COLLATE NOCASE`)
+		args = append(args, filter.Author)
+	}
+	if filter.AuthorID != 0 {
+		conds = append(conds, `POSTS.AuthorID = ?`)
+		args = append(args, filter.AuthorID)
+	}
+	if filter.LikedBy != 0 {
+		conds = append(conds, `POSTS.ID IN (SELECT REACTIONS.PostID FROM REACTIONS WHERE REACTIONS.VOTE = 1 AND REACTIONS.UserID = ?)`)
+		args = append(args, filter.LikedBy)
+	}
+	if filter.CommentedBy != 0 {
+		conds = append(conds, `POSTS.ID IN (SELECT COMMENTS.PostID FROM COMMENTS WHERE COMMENTS.AuthorID = ?)`)
+		args = append(args, filter.CommentedBy)
+	}
+	if filter.HasImages {
+		conds = append(conds, `EXISTS (SELECT 1 FROM IMAGES WHERE IMAGES.PostID = POSTS.ID)`)
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, `julianday(POSTS.CreatedAt) >= julianday(?)`)
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, `julianday(POSTS.CreatedAt) < julianday(?, '+1 day')`)
+		args = append(args, filter.To.UTC())
+	}
 
-		categories, err := s.getPostCategories(post.ID)
-		if err != nil {
-			return posts, err
-		}
-		post.Categories = categories
+	return strings.Join(conds, ` AND `), args
+}
 
-		vote, err := s.getReactionToPost(userID, post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-			vote = 0
-		}
-		post.Vote = vote
+// queryPostVotes counts the likes and dislikes of every post that has any.
+const queryPostVotes = `
+	SELECT PostID, SUM(VOTE = 1) AS Likes, SUM(VOTE = -1) AS Dislikes
+	FROM REACTIONS WHERE PostID IS NOT NULL GROUP BY PostID
+`
 
-		images, err := s.getPostImages(post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-		}
-		post.ImagesPath = images
+// sortScores ranks every post for the sorts other than new; the scores
+// follow the formulas popularised by Reddit. Hot only depends on the votes
+// and the creation time, not on the current time, so a post keeps its
+// score and pages stay stable while it ages.
+var sortScores = map[models.Sort]string{
+	models.SortTop: `
+		SELECT POSTS.ID, COALESCE(VOTES.Likes, 0) - COALESCE(VOTES.Dislikes, 0) AS Score
+		FROM POSTS LEFT JOIN (` + queryPostVotes + `) AS VOTES ON VOTES.PostID = POSTS.ID
+	`,
+	models.SortHot: `
+		SELECT ID, (CASE WHEN Net > 0 THEN 1 WHEN Net < 0 THEN -1 ELSE 0 END) * log10(1.0 * MAX(ABS(Net), 1)) + (julianday(CreatedAt) - 2440587.5) * 86400 / 45000 AS Score
+		FROM (
+			SELECT POSTS.ID, POSTS.CreatedAt, COALESCE(VOTES.Likes, 0) - COALESCE(VOTES.Dislikes, 0) AS Net
+			FROM POSTS LEFT JOIN (` + queryPostVotes + `) AS VOTES ON VOTES.PostID = POSTS.ID
+		)
+	`,
+	models.SortControversial: `
+		SELECT POSTS.ID,
+			CASE WHEN COALESCE(VOTES.Likes, 0) = 0 OR COALESCE(VOTES.Dislikes, 0) = 0 THEN 0
+			ELSE pow(1.0 * (VOTES.Likes + VOTES.Dislikes), 1.0 * MIN(VOTES.Likes, VOTES.Dislikes) / MAX(VOTES.Likes, VOTES.Dislikes))
+			END AS Score
+		FROM POSTS LEFT JOIN (` + queryPostVotes + `) AS VOTES ON VOTES.PostID = POSTS.ID
+	`,
+}
 
-		posts = append(posts, post)
+// listPosts reads one page of the posts matching where, in the order and
+// time window the page asks for.
+func (s *PostSqlite) listPosts(userID int, where string, whereArgs []interface{}, page models.Page) ([]models.Post, error) {
+	query := querySelectPosts
+	keys := []string{`POSTS.ID`}
+	if score, ok := sortScores[page.Sort]; ok {
+		query = `WITH RANKED AS (` + score + `) ` + selectPosts(`RANKED.Score`) + ` INNER JOIN RANKED ON RANKED.ID = POSTS.ID`
+		keys = []string{`RANKED.Score`, `POSTS.ID`}
 	}
 
-	return posts, nil
-}
+	args := append([]interface{}{userID}, whereArgs...)
+	query += ` WHERE ` + where
+	if !page.Since.IsZero() {
+		query += ` AND julianday(POSTS.CreatedAt) >= julianday(?)`
+		args = append(args, page.Since.UTC())
+	}
 
-func (s *PostSqlite) GetAllUserPosts(userID int) ([]models.Post, error) {
-	query := `
-		SELECT POSTS.ID, POSTS.AuthorID, POSTS.Title, POSTS.Content, USERS.Username 
-		FROM POSTS INNER JOIN USERS ON USERS.ID=POSTS.AuthorID AND USERS.ID=?
-		ORDER BY POSTS.ID DESC
-	`
+	keyset, keysetArgs := pageClause(page, keys)
+	posts, err := s.queryPosts(query+keyset, append(args, keysetArgs...)...)
+	return pageOrder(posts, page), err
+}
 
-	rows, err := s.db.Query(query, userID)
+// queryPosts runs a query built on querySelectPosts and loads the categories
+// and images of every returned post with one batched query each.
+func (s *PostSqlite) queryPosts(query string, args ...interface{}) ([]models.Post, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
-
 	defer rows.Close()
 
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.Author); err != nil {
-			return posts, err
-		}
-
-		if err := s.db.QueryRow(queryCountFeedback, &post.ID).Scan(&post.LikeCount, &post.DislikeCount, &post.CommentCount); err != nil {
-			return posts, err
-		}
-
-		categories, err := s.getPostCategories(post.ID)
-		if err != nil {
+		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.Author, &post.CreatedAt, &post.UpdatedAt,
+			&post.LikeCount, &post.DislikeCount, &post.CommentCount, &post.Vote, &post.Score); err != nil {
 			return posts, err
 		}
-		post.Categories = categories
-
-		vote, err := s.getReactionToPost(userID, post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-			vote = 0
-		}
-		post.Vote = vote
+		posts = append(posts, post)
+	}
 
-		images, err := s.getPostImages(post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-		}
-		post.ImagesPath = images
+	if err := rows.Err(); err != nil {
+		return posts, err
+	}
 
-		posts = append(posts, post)
+	if len(posts) == 0 {
+		return posts, nil
 	}
 
-	return posts, nil
-}
+	index := make(map[int]*models.Post, len(posts))
+	ids := make([]interface{}, len(posts))
+	for i := range posts {
+		index[posts[i].ID] = &posts[i]
+		ids[i] = posts[i].ID
+	}
 
-func (s *PostSqlite) GetPostsByCategory(UserID int, Category string) ([]models.Post, error) {
-	query := `
-		SELECT POSTS.ID, POSTS.AuthorID, POSTS.Title, POSTS.Content, USERS.Username 
-		FROM POSTS INNER JOIN USERS ON USERS.ID=POSTS.AuthorID, CATEGORIES
-		WHERE CATEGORIES.Category = $1 AND CATEGORIES.PostID=POSTS.ID
-		ORDER BY POSTS.ID DESC
-	`
-	rows, err := s.db.Query(query, Category)
+	err = s.queryPostDetails(`SELECT PostID, Category FROM CATEGORIES WHERE PostID IN (`+placeholders(len(ids))+`) ORDER BY ID`, ids, index, func(post *models.Post, val string) {
+		post.Categories = append(post.Categories, val)
+	})
 	if err != nil {
-		return nil, err
+		return posts, err
 	}
-	defer rows.Close()
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.Author); err != nil {
-			return posts, err
-		}
-		if err := s.db.QueryRow(queryCountFeedback, &post.ID).Scan(&post.LikeCount, &post.DislikeCount, &post.CommentCount); err != nil {
-			return posts, err
-		}
-		categories, err := s.getPostCategories(post.ID)
-		if err != nil {
-			return posts, err
-		}
-		post.Categories = categories
-		vote, err := s.getReactionToPost(UserID, post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-			vote = 0
-		}
-		post.Vote = vote
 
-		images, err := s.getPostImages(post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-		}
-		post.ImagesPath = images
-
-		posts = append(posts, post)
+	err = s.queryPostDetails(`SELECT PostID, Image FROM IMAGES WHERE PostID IN (`+placeholders(len(ids))+`) ORDER BY ID`, ids, index, func(post *models.Post, val string) {
+		post.ImagesPath = append(post.ImagesPath, template.URL(val))
+	})
+	if err != nil {
+		return posts, err
 	}
+
 	return posts, nil
 }
 
-func (s *PostSqlite) GetLikedPosts(userID int) ([]models.Post, error) {
-	query := `
-		SELECT POSTS.ID, POSTS.AuthorID, POSTS.Title, POSTS.Content, USERS.Username
-		FROM POSTS INNER JOIN USERS ON USERS.ID=POSTS.AuthorID, REACTIONS
-		WHERE REACTIONS.PostID = POSTS.ID AND REACTIONS.VOTE = 1 AND REACTIONS.UserID = $1
-		ORDER BY POSTS.ID DESC
-	`
-	rows, err := s.db.Query(query, userID)
+// queryPostDetails reads (PostID, value) rows and hands every value to the post it belongs to.
+func (s *PostSqlite) queryPostDetails(query string, ids []interface{}, index map[int]*models.Post, add func(post *models.Post, val string)) error {
+	rows, err := s.db.Query(query, ids...)
 	if err != nil {
-		fmt.Println("*")
-		return nil, err
+		return err
 	}
 	defer rows.Close()
-	var posts []models.Post
+
 	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.Author); err != nil {
-			return posts, err
+		var (
+			postID int
+			val    string
+		)
+		if err := rows.Scan(&postID, &val); err != nil {
+			return err
 		}
-		if err := s.db.QueryRow(queryCountFeedback, &post.ID).Scan(&post.LikeCount, &post.DislikeCount, &post.CommentCount); err != nil {
-			return posts, err
+		if post, ok := index[postID]; ok {
+			add(post, val)
 		}
-		categories, err := s.getPostCategories(post.ID)
-		if err != nil {
-			return posts, err
-		}
-		post.Categories = categories
-
-		post.Vote = 1
+	}
 
-		images, err := s.getPostImages(post.ID)
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				return posts, err
-			}
-		}
-		post.ImagesPath = images
+	return rows.Err()
+}
 
-		posts = append(posts, post)
-	}
-	return posts, nil
+// placeholders returns n comma separated query placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
 }
 
-func (s *PostSqlite) getPostCategories(postID int) ([]string, error) {
-	const query = `
-		SELECT Category FROM CATEGORIES WHERE PostID = $1
+// GetPostRevisions returns every saved version of the post, oldest first.
+func (s *PostSqlite) GetPostRevisions(postID int) ([]models.Revision, error) {
+	query := `
+		SELECT POST_REVISIONS.ID, POST_REVISIONS.PostID, POST_REVISIONS.AuthorID, USERS.Username,
+			POST_REVISIONS.Title, POST_REVISIONS.Content, POST_REVISIONS.CreatedAt
+		FROM POST_REVISIONS INNER JOIN USERS ON USERS.ID=POST_REVISIONS.AuthorID
+		WHERE POST_REVISIONS.PostID = $1
+		ORDER BY POST_REVISIONS.ID
 	`
+
 	rows, err := s.db.Query(query, postID)
 	if err != nil {
 		return nil, err
 	}
-
 	defer rows.Close()
 
-	var categories []string
+	var revisions []models.Revision
 	for rows.Next() {
-		var category string
-		if err := rows.Scan(&category); err != nil {
-			return categories, err
+		var revision models.Revision
+		if err := rows.Scan(&revision.ID, &revision.PostID, &revision.AuthorID, &revision.Author, &revision.Title, &revision.Content, &revision.CreatedAt); err != nil {
+			return revisions, err
 		}
-
-		categories = append(categories, category)
+		revisions = append(revisions, revision)
 	}
 
-	return categories, err
+	return revisions, rows.Err()
 }
 
-func (s *PostSqlite) getReactionToPost(userID int, postID int) (int, error) {
-	query := `
-		SELECT VOTE FROM REACTIONS WHERE UserID = $1 AND PostID = $2
-	`
-
-	var vote int
-	if err := s.db.QueryRow(query, userID, postID).Scan(&vote); err != nil {
-		return vote, err
+// pageClause narrows a listing to one page. The rows are ordered by keys,
+// highest first: the post ID alone, or the score and then the post ID.
+// Pages before a cursor are read in ascending order and must be put back
+// in order with pageOrder.
+func pageClause(page models.Page, keys []string) (string, []interface{}) {
+	key := strings.Join(keys, ", ")
+	if len(keys) > 1 {
+		key = "(" + key + ")"
 	}
-
-	return vote, nil
-}
-
-func (s *PostSqlite) getPostImages(postID int) ([]template.URL, error) {
-	const query = `
-		SELECT Image FROM IMAGES WHERE PostID = $1
-	`
-	rows, err := s.db.Query(query, postID)
-	if err != nil {
-		return nil, err
+	order := func(dir string) string {
+		return ` ORDER BY ` + strings.Join(keys, ` `+dir+`, `) + ` ` + dir + ` LIMIT ?`
 	}
-
-	defer rows.Close()
-
-	var images []template.URL
-	for rows.Next() {
-		var image template.URL
-		if err := rows.Scan(&image); err != nil {
-			return images, err
+	// The cursor holds the keys of the post the page starts from, which
+	// may since have been deleted or have changed its score.
+	cursor := func(c models.Cursor) (string, []interface{}) {
+		if len(keys) > 1 {
+			return `(?, ?)`, []interface{}{c.Score, c.ID, page.Limit}
 		}
+		return `?`, []interface{}{c.ID, page.Limit}
+	}
 
-		images = append(images, image)
+	switch {
+	case !page.Before.IsZero():
+		at, args := cursor(page.Before)
+		return ` AND ` + key + ` > ` + at + order("ASC"), args
+	case !page.After.IsZero():
+		at, args := cursor(page.After)
+		return ` AND ` + key + ` < ` + at + order("DESC"), args
+	default:
+		return order("DESC"), []interface{}{page.Limit}
 	}
+}
 
-	return images, err
+// pageOrder puts the posts of a page read backwards in listing order.
+func pageOrder(posts []models.Post, page models.Page) []models.Post {
+	if page.Before.IsZero() {
+		return posts
+	}
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+	return posts
 }
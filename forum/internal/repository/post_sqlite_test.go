@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"html/template"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+const countingDriverName = "sqlite3_forum_counting"
+
+var registerCounting sync.Once
+
+// countingDriver wraps the forum's driver and counts the statements sent to
+// the database, so that tests can check how many round trips a call costs.
+type countingDriver struct {
+	driver.Driver
+	statements int64
+}
+
+var counting = &countingDriver{}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, driver: d}, nil
+}
+
+func (d *countingDriver) count() int64 {
+	return atomic.LoadInt64(&d.statements)
+}
+
+type countingConn struct {
+	driver.Conn
+	driver *countingDriver
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt64(&c.driver.statements, 1)
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	atomic.AddInt64(&c.driver.statements, 1)
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+// openCountingDB opens a migrated in-memory database through countingDriver.
+func openCountingDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	registerCounting.Do(func() {
+		db, err := sql.Open(driverName, ":memory:")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		counting.Driver = db.Driver()
+		db.Close()
+		sql.Register(countingDriverName, counting)
+	})
+
+	db, err := sql.Open(countingDriverName, ":memory:")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own.
+	db.SetMaxOpenConns(1)
+	tb.Cleanup(func() { db.Close() })
+
+	if err := checkFTS5(db); errors.Is(err, ErrNoFTS5) {
+		tb.Skip(err)
+	} else if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := MigrateUp(db); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// seedListing creates a user with posts, each with a category, an image and
+// a reaction, and returns the ID of a post with the given number of comments.
+func seedListing(tb testing.TB, db *sql.DB, posts, comments int) (userID, postID int) {
+	tb.Helper()
+
+	now := time.Now().UTC()
+	userID, err := NewAuthSqlite(db).CreateUser(models.User{Username: "alice", Email: "alice@example.com", Password: "x", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	postRepo := NewPostSqlite(db)
+	reactions := NewReactionSqlite(db)
+	for i := 0; i < posts; i++ {
+		postID, err = postRepo.CreatePost(models.Post{
+			AuthorID:   userID,
+			Title:      fmt.Sprintf("post %d", i),
+			Content:    "content",
+			Categories: []string{"airplane"},
+			ImagesPath: []template.URL{template.URL(fmt.Sprintf("/uploads/%d.png", i))},
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := reactions.CreateReactionPost(models.Reaction{UserID: userID, PostID: postID, Vote: 1}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	commentRepo := NewCommentSqlite(db)
+	for i := 0; i < comments; i++ {
+		_, err := commentRepo.CreateComment(models.Comment{UserID: userID, PostID: postID, Content: "comment", CreatedAt: now, UpdatedAt: now})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return userID, postID
+}
+
+// BenchmarkGetPosts checks that a page of posts costs one query for the
+// posts and one each for their categories and images, however long it is.
+func BenchmarkGetPosts(b *testing.B) {
+	db := openCountingDB(b)
+	userID, _ := seedListing(b, db, 60, 0)
+	repo := NewPostSqlite(db)
+	page := models.Page{Limit: 50, Sort: models.SortNew}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before := counting.count()
+		posts, err := repo.GetPosts(userID, models.PostFilter{}, page)
+		if err != nil {
+			b.Fatal(err)
+		}
+		queries := counting.count() - before
+
+		if len(posts) != 50 {
+			b.Fatalf("got %d posts, want 50", len(posts))
+		}
+		if len(posts[0].Categories) != 1 || len(posts[0].ImagesPath) != 1 || posts[0].LikeCount != 1 {
+			b.Fatalf("post details not loaded: %+v", posts[0])
+		}
+		if queries != 3 {
+			b.Fatalf("a page of 50 posts took %d queries, want 3", queries)
+		}
+		b.ReportMetric(float64(queries), "queries/op")
+	}
+}
+
+// BenchmarkCommentsByPostID checks that the comments of a post are read in
+// a single query.
+func BenchmarkCommentsByPostID(b *testing.B) {
+	db := openCountingDB(b)
+	userID, postID := seedListing(b, db, 1, 50)
+	repo := NewCommentSqlite(db)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before := counting.count()
+		comments, err := repo.CommentsByPostID(postID, userID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		queries := counting.count() - before
+
+		if len(comments) != 50 {
+			b.Fatalf("got %d comments, want 50", len(comments))
+		}
+		if queries != 1 {
+			b.Fatalf("50 comments took %d queries, want 1", queries)
+		}
+		b.ReportMetric(float64(queries), "queries/op")
+	}
+}
+
+// TestCreatePostIsAtomic makes saving the images fail and checks nothing
+// of the post is left behind.
+func TestCreatePostIsAtomic(t *testing.T) {
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 0, 0)
+	if _, err := db.Exec(`DROP TABLE IMAGES`); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	_, err := NewPostSqlite(db).CreatePost(models.Post{
+		AuthorID:   userID,
+		Title:      "title",
+		Content:    "content",
+		Categories: []string{"airplane"},
+		ImagesPath: []template.URL{"/uploads/1.png"},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	if err == nil {
+		t.Fatal("CreatePost succeeded without an IMAGES table")
+	}
+
+	for _, table := range []string{"POSTS", "POST_REVISIONS", "CATEGORIES"} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d rows left in %s", n, table)
+		}
+	}
+}
+
+// TestScoreCursor pages through a listing by votes while its posts change:
+// the cursor keeps its place even once its post is gone.
+func TestScoreCursor(t *testing.T) {
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 5, 0)
+	repo := NewPostSqlite(db)
+
+	page := models.Page{Limit: 2, Sort: models.SortTop}
+	first, err := repo.GetPosts(userID, models.PostFilter{}, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postIDs(first); !reflect.DeepEqual(got, []int{5, 4}) {
+		t.Fatalf("first page = %v, want [5 4]", got)
+	}
+
+	// Post 4 is deleted and post 3 loses its like before the next page.
+	if err := repo.DeletePost(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewReactionSqlite(db).CreateReactionPost(models.Reaction{UserID: userID, PostID: 3, Vote: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	page.After = models.Cursor{ID: first[1].ID, Score: first[1].Score}
+	next, err := repo.GetPosts(userID, models.PostFilter{}, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postIDs(next); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("next page = %v, want [2 1]", got)
+	}
+
+	// The hot scores are fractional; they have to come back from a cursor
+	// exactly for the pages to line up.
+	var ids []int
+	page = models.Page{Limit: 1, Sort: models.SortHot}
+	for len(ids) <= 5 {
+		posts, err := repo.GetPosts(userID, models.PostFilter{}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) == 0 {
+			break
+		}
+		ids = append(ids, posts[0].ID)
+
+		cursor := models.Cursor{ID: posts[0].ID, Score: posts[0].Score}.Format(page.Sort)
+		var ok bool
+		if page.After, ok = models.ParseCursor(cursor, page.Sort); !ok {
+			t.Fatalf("can't parse cursor %q", cursor)
+		}
+	}
+	if !reflect.DeepEqual(ids, []int{5, 3, 2, 1}) {
+		t.Errorf("hot pages = %v, want [5 3 2 1]", ids)
+	}
+}
+
+// TestWindowFiltersEverySort checks the time window leaves out the older
+// posts whatever the order of the listing.
+func TestWindowFiltersEverySort(t *testing.T) {
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 3, 0)
+	repo := NewPostSqlite(db)
+
+	old := time.Now().UTC().AddDate(0, 0, -2)
+	if _, err := db.Exec(`UPDATE POSTS SET CreatedAt = $1 WHERE ID = 1`, old); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sort := range models.Sorts {
+		page := models.Page{Limit: 10, Sort: sort, Since: time.Now().AddDate(0, 0, -1)}
+		posts, err := repo.GetPosts(userID, models.PostFilter{}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := postIDs(posts)
+		for _, id := range got {
+			if id == 1 {
+				t.Errorf("%s listing of the last day = %v, has post 1", sort, got)
+			}
+		}
+		if len(got) != 2 {
+			t.Errorf("%s listing of the last day = %v, want posts 2 and 3", sort, got)
+		}
+	}
+}
+
+func postIDs(posts []models.Post) []int {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	return ids
+}
@@ -23,8 +23,11 @@ func NewReactionSqlite(db *sql.DB) *ReactionSqlite {
 
 func (s *ReactionSqlite) CreateReactionPost(reaction models.Reaction) error {
 	queryInsert := `
-        INSERT INTO REACTIONS (UserID, PostID, VOTE) VALUES ($1, $2, $3);
+        INSERT INTO REACTIONS (UserID, PostID, VOTE, CreatedAt, UpdatedAt) VALUES ($1, $2, $3, $4, $5);
     `
+	queryUpdate := `
+		UPDATE REACTIONS SET VOTE = $1, UpdatedAt = $2 WHERE UserID = $3 AND PostID = $4
+	`
 	querySelect := `
 		SELECT VOTE FROM REACTIONS WHERE UserID = $1 AND PostID = $2
 	`
@@ -33,7 +36,7 @@ func (s *ReactionSqlite) CreateReactionPost(reaction models.Reaction) error {
 		if !errors.Is(err, sql.ErrNoRows) {
 			return err
 		}
-		if _, err := s.db.Exec(queryInsert, reaction.UserID, reaction.PostID, reaction.Vote); err != nil {
+		if _, err := s.db.Exec(queryInsert, reaction.UserID, reaction.PostID, reaction.Vote, reaction.CreatedAt, reaction.UpdatedAt); err != nil {
 			return err
 		}
 	} else {
@@ -42,10 +45,7 @@ func (s *ReactionSqlite) CreateReactionPost(reaction models.Reaction) error {
 				return err
 			}
 		} else {
-			if _, err := s.db.Exec(`DELETE FROM REACTIONS WHERE UserID = $1 AND PostID = $2 AND VOTE = $3`, reaction.UserID, reaction.PostID, vote); err != nil {
-				return err
-			}
-			if _, err := s.db.Exec(queryInsert, reaction.UserID, reaction.PostID, reaction.Vote); err != nil {
+			if _, err := s.db.Exec(queryUpdate, reaction.Vote, reaction.UpdatedAt, reaction.UserID, reaction.PostID); err != nil {
 				return err
 			}
 		}
@@ -56,12 +56,15 @@ func (s *ReactionSqlite) CreateReactionPost(reaction models.Reaction) error {
 
 func (s *ReactionSqlite) CreateReactionComment(reaction models.Reaction) (int, error) {
 	var postID int
-	if err := s.db.QueryRow(`SELECT PostID FROM COMMENTS WHERE ID = $1`, reaction.CommentID).Scan(&postID); err != nil {
+	if err := s.db.QueryRow(`SELECT PostID FROM COMMENTS WHERE ID = $1 AND Deleted = 0`, reaction.CommentID).Scan(&postID); err != nil {
 		return postID, err
 	}
 	queryInsert := `
-        INSERT INTO REACTIONS (UserID, CommentID, VOTE) VALUES ($1, $2, $3);
+        INSERT INTO REACTIONS (UserID, CommentID, VOTE, CreatedAt, UpdatedAt) VALUES ($1, $2, $3, $4, $5);
     `
+	queryUpdate := `
+		UPDATE REACTIONS SET VOTE = $1, UpdatedAt = $2 WHERE UserID = $3 AND CommentID = $4
+	`
 	querySelect := `
 		SELECT VOTE FROM REACTIONS WHERE UserID = $1 AND CommentID = $2
 	`
@@ -70,7 +73,7 @@ func (s *ReactionSqlite) CreateReactionComment(reaction models.Reaction) (int, e
 		if !errors.Is(err, sql.ErrNoRows) {
 			return postID, err
 		}
-		if _, err := s.db.Exec(queryInsert, reaction.UserID, reaction.CommentID, reaction.Vote); err != nil {
+		if _, err := s.db.Exec(queryInsert, reaction.UserID, reaction.CommentID, reaction.Vote, reaction.CreatedAt, reaction.UpdatedAt); err != nil {
 			return postID, err
 		}
 	} else {
@@ -79,10 +82,7 @@ func (s *ReactionSqlite) CreateReactionComment(reaction models.Reaction) (int, e
 				return postID, err
 			}
 		} else {
-			if _, err := s.db.Exec(`DELETE FROM REACTIONS WHERE UserID = $1 AND CommentID = $2 AND VOTE = $3`, reaction.UserID, reaction.CommentID, vote); err != nil {
-				return postID, err
-			}
-			if _, err := s.db.Exec(queryInsert, reaction.UserID, reaction.CommentID, reaction.Vote); err != nil {
+			if _, err := s.db.Exec(queryUpdate, reaction.Vote, reaction.UpdatedAt, reaction.UserID, reaction.CommentID); err != nil {
 				return postID, err
 			}
 		}
@@ -9,6 +9,14 @@ type Repository struct {
 	Post
 	Commentary
 	Reaction
+	Search
+	Category
+	APIToken
+	LoginThrottle
+	PasswordReset
+	TwoFactor
+	Passkey
+	OIDC
 }
 
 func NewRepository(db *sql.DB) *Repository {
@@ -17,5 +25,13 @@ func NewRepository(db *sql.DB) *Repository {
 		Post:          NewPostSqlite(db),
 		Commentary:    NewCommentSqlite(db),
 		Reaction:      NewReactionSqlite(db),
+		Search:        NewSearchSqlite(db),
+		Category:      NewCategorySqlite(db),
+		APIToken:      NewAPITokenSqlite(db),
+		LoginThrottle: NewLoginThrottleSqlite(db),
+		PasswordReset: NewPasswordResetSqlite(db),
+		TwoFactor:     NewTwoFactorSqlite(db),
+		Passkey:       NewPasskeySqlite(db),
+		OIDC:          NewOIDCSqlite(db),
 	}
 }
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"database/sql"
+
+	"forum/internal/models"
+)
+
+type Search interface {
+	Search(query models.SearchQuery, userID int) ([]models.SearchResult, error)
+}
+
+type SearchSqlite struct {
+	db    *sql.DB
+	posts *PostSqlite
+}
+
+func NewSearchSqlite(db *sql.DB) *SearchSqlite {
+	return &SearchSqlite{
+		db:    db,
+		posts: NewPostSqlite(db),
+	}
+}
+
+// Search ranks posts by how well their title, content or comments match the
+// full-text expression. Title hits weigh the most and comment hits the least;
+// every post keeps the snippet of its best match.
+func (s *SearchSqlite) Search(query models.SearchQuery, userID int) ([]models.SearchResult, error) {
+	q := `
+		WITH MATCHES(PostID, Rank, Excerpt) AS (
+			SELECT POSTS_FTS.rowid, bm25(POSTS_FTS, 10.0, 1.0), snippet(POSTS_FTS, -1, ?, ?, '…', 16)
+			FROM POSTS_FTS WHERE POSTS_FTS MATCH ?
+			UNION ALL
+			SELECT COMMENTS.PostID, bm25(COMMENTS_FTS) * 0.5, snippet(COMMENTS_FTS, 0, ?, ?, '…', 16)
+			FROM COMMENTS_FTS INNER JOIN COMMENTS ON COMMENTS.ID = COMMENTS_FTS.rowid
+			WHERE COMMENTS_FTS MATCH ?
+		)
+		SELECT MATCHES.PostID, MIN(MATCHES.Rank), MATCHES.Excerpt
+		FROM MATCHES
+		INNER JOIN POSTS ON POSTS.ID = MATCHES.PostID
+		INNER JOIN USERS ON USERS.ID = POSTS.AuthorID
+		WHERE 1 = 1
+	`
+	args := []interface{}{
+		models.HighlightStart, models.HighlightEnd, query.Match,
+		models.HighlightStart, models.HighlightEnd, query.Match,
+	}
+
+	if query.Category != "" {
+		q += ` AND POSTS.ID IN (SELECT CATEGORIES.PostID FROM CATEGORIES WHERE CATEGORIES.Category = ?)`
+		args = append(args, query.Category)
+	}
+	if query.Author != "" {
+		q += ` AND USERS.Username = ? COLLATE NOCASE`
+		args = append(args, query.Author)
+	}
+
+	q += `
+		GROUP BY MATCHES.PostID
+		ORDER BY MIN(MATCHES.Rank), MATCHES.PostID DESC
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, query.Limit, query.Offset)
+
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		results []models.SearchResult
+		ids     []interface{}
+	)
+	for rows.Next() {
+		var (
+			result models.SearchResult
+			rank   float64
+		)
+		if err := rows.Scan(&result.Post.ID, &rank, &result.Excerpt); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		ids = append(ids, result.Post.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	posts, err := s.posts.queryPosts(querySelectPosts+` WHERE POSTS.ID IN (`+placeholders(len(ids))+`)`, append([]interface{}{userID}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]models.Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	for i := range results {
+		results[i].Post = byID[results[i].Post.ID]
+	}
+
+	return results, nil
+}
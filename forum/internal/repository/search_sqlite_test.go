@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+func TestSearchRanking(t *testing.T) {
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 0, 0)
+	posts := NewPostSqlite(db)
+	comments := NewCommentSqlite(db)
+	now := time.Now().UTC()
+
+	create := func(title, content string) int {
+		t.Helper()
+		id, err := posts.CreatePost(models.Post{AuthorID: userID, Title: title, Content: content, Categories: []string{"airplane"}, CreatedAt: now, UpdatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	inComment := create("Hangar visit", "We toured the hangar today.")
+	inContent := create("Airships", "The <b>zeppelin</b> was the largest airship ever flown & more.")
+	inTitle := create("Zeppelin history", "A short history of rigid airships.")
+	// Terms found in most documents hardly count, so the matches are
+	// kept among many others.
+	for i := 0; i < 10; i++ {
+		create(fmt.Sprintf("Glider %d", i), "Nothing to see here.")
+	}
+	for i := 0; i < 10; i++ {
+		content := fmt.Sprintf("Great photo %d.", i)
+		if i == 5 {
+			content = "Saw a zeppelin there once!"
+		}
+		if _, err := comments.CreateComment(models.Comment{UserID: userID, PostID: inComment, Content: content, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := NewSearchSqlite(db).Search(models.SearchQuery{Match: `"zeppelin"*`, Limit: 10}, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Title hits weigh the most and comment hits the least.
+	var ids []int
+	for _, result := range results {
+		ids = append(ids, result.Post.ID)
+	}
+	if len(ids) != 3 || ids[0] != inTitle || ids[1] != inContent || ids[2] != inComment {
+		t.Fatalf("got posts %v, want %v", ids, []int{inTitle, inContent, inComment})
+	}
+
+	for i, want := range []string{
+		models.HighlightStart + "Zeppelin" + models.HighlightEnd + " history",
+		"The <b>" + models.HighlightStart + "zeppelin" + models.HighlightEnd + "</b> was",
+		"Saw a " + models.HighlightStart + "zeppelin" + models.HighlightEnd + " there",
+	} {
+		if !strings.Contains(results[i].Excerpt, want) {
+			t.Errorf("post %d has the excerpt %q, want it to contain %q", ids[i], results[i].Excerpt, want)
+		}
+	}
+	if results[0].Post.Title != "Zeppelin history" || results[0].Post.Author != "alice" {
+		t.Errorf("post not loaded: %+v", results[0].Post)
+	}
+}
@@ -2,11 +2,49 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrNoFTS5 reports a binary built without the full-text search module the
+// search index needs.
+var ErrNoFTS5 = errors.New("sqlite is built without FTS5, build with -tags sqlite_fts5")
+
+// driverName is the sqlite3 driver extended with the math functions the
+// listing scores need, which the bundled SQLite is built without.
+const driverName = "sqlite3_forum"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("log10", math.Log10, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("pow", math.Pow, true)
+		},
+	})
+}
+
+// OpenSqliteDB connects to the database and applies every pending migration.
 func OpenSqliteDB(dbName string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", fmt.Sprintf("./%s", dbName))
+	db, err := ConnectSqliteDB(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = MigrateUp(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ConnectSqliteDB connects to the database without touching its schema.
+func ConnectSqliteDB(dbName string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, fmt.Sprintf("./%s", dbName))
 	if err != nil {
 		return nil, err
 	}
@@ -15,60 +53,21 @@ func OpenSqliteDB(dbName string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	if err = createTables(db); err != nil {
+	if err = checkFTS5(db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func createTables(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS USERS(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			Username TEXT NOT NULL UNIQUE,
-			Email TEXT NOT NULL UNIQUE,
-			Password TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS SESSIONS(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			UserID INTEGER NOT NULL UNIQUE,
-			Token VARCHAR(32) NOT NULL,
-			ExpDate DATATIME NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS POSTS(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			AuthorID INTEGER NOT NULL,
-			Title TEXT NOT NULL,
-			Content TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS COMMENTS(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			AuthorID INTEGER NOT NULL,
-			PostID INTEGER NOT NULL,
-			Content TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS REACTIONS(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			UserID INTEGER NOT NULL,
-			PostID INTEGER,
-			CommentID INTEGER,
-			VOTE BLOB NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS CATEGORIES(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			PostID INTEGER NOT NULL,
-			Category TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS IMAGES(
-			ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			PostID INTEGER,
-			Image TEXT,
-			FOREIGN KEY(PostID) REFERENCES POSTS(ID)
-		)
-	`
-	if _, err := db.Exec(query); err != nil {
+func checkFTS5(db *sql.DB) error {
+	var fts5 bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
 		return err
 	}
+	if !fts5 {
+		return ErrNoFTS5
+	}
 	return nil
 }
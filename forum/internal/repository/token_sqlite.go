@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+)
+
+type APIToken interface {
+	CreateAPIToken(token models.APIToken) (int, error)
+	GetAPITokens(userID int) ([]models.APIToken, error)
+	// UserByAPIToken returns the token with the given hash and its owner.
+	UserByAPIToken(hash string) (models.User, models.APIToken, error)
+	TouchAPIToken(ID int, usedAt time.Time) error
+	// RevokeAPIToken revokes a token of the user, reporting whether one
+	// was revoked.
+	RevokeAPIToken(ID, userID int, revokedAt time.Time) (bool, error)
+}
+
+type APITokenSqlite struct {
+	db *sql.DB
+}
+
+func NewAPITokenSqlite(db *sql.DB) *APITokenSqlite {
+	return &APITokenSqlite{
+		db: db,
+	}
+}
+
+func (s *APITokenSqlite) CreateAPIToken(token models.APIToken) (int, error) {
+	query := `
+		INSERT INTO API_TOKENS (UserID, Name, Hash, Scopes, CreatedAt) VALUES ($1, $2, $3, $4, $5);
+	`
+
+	res, err := s.db.Exec(query, token.UserID, token.Name, token.Hash, joinScopes(token.Scopes), token.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const querySelectAPITokens = `
+	SELECT API_TOKENS.ID, API_TOKENS.UserID, API_TOKENS.Name, API_TOKENS.Hash, API_TOKENS.Scopes,
+		API_TOKENS.CreatedAt, API_TOKENS.LastUsedAt, API_TOKENS.RevokedAt
+	FROM API_TOKENS
+`
+
+// GetAPITokens returns the tokens of the user, newest first.
+func (s *APITokenSqlite) GetAPITokens(userID int) ([]models.APIToken, error) {
+	rows, err := s.db.Query(querySelectAPITokens+` WHERE API_TOKENS.UserID = ? ORDER BY API_TOKENS.ID DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *APITokenSqlite) UserByAPIToken(hash string) (models.User, models.APIToken, error) {
+	token, err := scanAPIToken(s.db.QueryRow(querySelectAPITokens+` WHERE API_TOKENS.Hash = ?`, hash))
+	if err != nil {
+		return models.User{}, token, err
+	}
+
+	query := `
+		SELECT ID, Username, Email, Password, CreatedAt, UpdatedAt, EmailVerifiedAt IS NOT NULL, Role FROM USERS WHERE ID = ?;
+	`
+	var user models.User
+	if err := s.db.QueryRow(query, token.UserID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerified, &user.Role); err != nil {
+		return user, token, err
+	}
+	return user, token, nil
+}
+
+func (s *APITokenSqlite) TouchAPIToken(ID int, usedAt time.Time) error {
+	query := `
+		UPDATE API_TOKENS SET LastUsedAt = ? WHERE ID = ?;
+	`
+
+	_, err := s.db.Exec(query, usedAt, ID)
+	return err
+}
+
+func (s *APITokenSqlite) RevokeAPIToken(ID, userID int, revokedAt time.Time) (bool, error) {
+	query := `
+		UPDATE API_TOKENS SET RevokedAt = ? WHERE ID = ? AND UserID = ? AND RevokedAt IS NULL;
+	`
+
+	res, err := s.db.Exec(query, revokedAt, ID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func scanAPIToken(row scanner) (models.APIToken, error) {
+	var (
+		token             models.APIToken
+		scopes            string
+		usedAt, revokedAt sql.NullTime
+	)
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Hash, &scopes,
+		&token.CreatedAt, &usedAt, &revokedAt)
+	token.Scopes = splitScopes(scopes)
+	token.LastUsedAt = timePtr(usedAt)
+	token.RevokedAt = timePtr(revokedAt)
+	return token, err
+}
+
+// timePtr is the time of a nullable column, nil for NULL.
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Scopes are stored as one space-separated column.
+func joinScopes(scopes []models.Scope) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
+
+func splitScopes(s string) []models.Scope {
+	var scopes []models.Scope
+	for _, scope := range strings.Fields(s) {
+		scopes = append(scopes, models.Scope(scope))
+	}
+	return scopes
+}
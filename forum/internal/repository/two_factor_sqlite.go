@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"forum/internal/models"
+)
+
+type TwoFactor interface {
+	GetTOTP(userID int) (models.TOTP, error)
+	// SaveTOTPSecret starts over the setup of the authenticator of the
+	// user with a new secret, not enabled yet.
+	SaveTOTPSecret(totp models.TOTP) error
+	// EnableTOTP enables the authenticator of the user, replacing their
+	// recovery codes with the given hashes.
+	EnableTOTP(userID int, step int64, at time.Time, codes []string) error
+	DeleteTOTP(userID int) error
+	// UseTOTPStep records the step of an accepted code, reporting false if
+	// it isn't newer than the last one, which means the code is replayed.
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// UseRecoveryCode uses up the unused recovery code of the user with
+	// the hash, reporting whether there was one.
+	UseRecoveryCode(userID int, hash string, at time.Time) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+
+	CreateLoginChallenge(challenge models.LoginChallenge) (int, error)
+	GetLoginChallenge(hash string) (models.LoginChallenge, error)
+	// AddChallengeAttempt counts a wrong code sent for the challenge.
+	AddChallengeAttempt(ID int) error
+	DeleteLoginChallenge(ID int) error
+	DeleteExpiredChallenges(now time.Time) error
+}
+
+type TwoFactorSqlite struct {
+	db *sql.DB
+}
+
+func NewTwoFactorSqlite(db *sql.DB) *TwoFactorSqlite {
+	return &TwoFactorSqlite{
+		db: db,
+	}
+}
+
+func (s *TwoFactorSqlite) GetTOTP(userID int) (models.TOTP, error) {
+	query := `
+		SELECT UserID, Secret, CreatedAt, EnabledAt, LastStep FROM TOTP WHERE UserID = ?;
+	`
+
+	var (
+		totp      models.TOTP
+		enabledAt sql.NullTime
+	)
+	err := s.db.QueryRow(query, userID).Scan(&totp.UserID, &totp.Secret, &totp.CreatedAt, &enabledAt, &totp.LastStep)
+	totp.EnabledAt = enabledAt.Time
+	return totp, err
+}
+
+func (s *TwoFactorSqlite) SaveTOTPSecret(totp models.TOTP) error {
+	query := `
+		INSERT OR REPLACE INTO TOTP (UserID, Secret, CreatedAt) VALUES ($1, $2, $3);
+	`
+
+	_, err := s.db.Exec(query, totp.UserID, totp.Secret, totp.CreatedAt)
+	return err
+}
+
+func (s *TwoFactorSqlite) EnableTOTP(userID int, step int64, at time.Time, codes []string) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE TOTP SET EnabledAt = $1, LastStep = $2 WHERE UserID = $3;`, at, step, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM RECOVERY_CODES WHERE UserID = ?;`, userID); err != nil {
+			return err
+		}
+		for _, hash := range codes {
+			if _, err := tx.Exec(`INSERT INTO RECOVERY_CODES (UserID, Hash) VALUES ($1, $2);`, userID, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *TwoFactorSqlite) DeleteTOTP(userID int) error {
+	return runInTx(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM RECOVERY_CODES WHERE UserID = ?;`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM LOGIN_CHALLENGES WHERE UserID = ?;`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM TOTP WHERE UserID = ?;`, userID)
+		return err
+	})
+}
+
+func (s *TwoFactorSqlite) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `
+		UPDATE TOTP SET LastStep = $1 WHERE UserID = $2 AND LastStep < $1;
+	`
+
+	return execAffected(s.db, query, step, userID)
+}
+
+func (s *TwoFactorSqlite) UseRecoveryCode(userID int, hash string, at time.Time) (bool, error) {
+	query := `
+		UPDATE RECOVERY_CODES SET UsedAt = $1
+		WHERE ID = (SELECT ID FROM RECOVERY_CODES WHERE UserID = $2 AND Hash = $3 AND UsedAt IS NULL LIMIT 1);
+	`
+
+	return execAffected(s.db, query, at, userID, hash)
+}
+
+func (s *TwoFactorSqlite) CountRecoveryCodes(userID int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM RECOVERY_CODES WHERE UserID = ? AND UsedAt IS NULL;
+	`
+
+	var n int
+	err := s.db.QueryRow(query, userID).Scan(&n)
+	return n, err
+}
+
+func (s *TwoFactorSqlite) CreateLoginChallenge(challenge models.LoginChallenge) (int, error) {
+	query := `
+		INSERT INTO LOGIN_CHALLENGES (UserID, Hash, ExpiresAt, Persistent, UserAgent, IP) VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	res, err := s.db.Exec(query, challenge.UserID, challenge.Hash, challenge.ExpiresAt,
+		challenge.Persistent, challenge.UserAgent, challenge.IP)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *TwoFactorSqlite) GetLoginChallenge(hash string) (models.LoginChallenge, error) {
+	query := `
+		SELECT ID, UserID, Hash, ExpiresAt, Attempts, Persistent, UserAgent, IP FROM LOGIN_CHALLENGES WHERE Hash = ?;
+	`
+
+	var c models.LoginChallenge
+	err := s.db.QueryRow(query, hash).Scan(&c.ID, &c.UserID, &c.Hash, &c.ExpiresAt, &c.Attempts, &c.Persistent, &c.UserAgent, &c.IP)
+	return c, err
+}
+
+func (s *TwoFactorSqlite) AddChallengeAttempt(ID int) error {
+	_, err := s.db.Exec(`UPDATE LOGIN_CHALLENGES SET Attempts = Attempts + 1 WHERE ID = ?;`, ID)
+	return err
+}
+
+func (s *TwoFactorSqlite) DeleteLoginChallenge(ID int) error {
+	_, err := s.db.Exec(`DELETE FROM LOGIN_CHALLENGES WHERE ID = ?;`, ID)
+	return err
+}
+
+func (s *TwoFactorSqlite) DeleteExpiredChallenges(now time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM LOGIN_CHALLENGES WHERE julianday(ExpiresAt) <= julianday(?);`, now)
+	return err
+}
+
+func execAffected(db *sql.DB, query string, args ...interface{}) (bool, error) {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+// enabledTOTP turns on the authenticator of a new user at step 100, with
+// the recovery codes of the given hashes.
+func enabledTOTP(t *testing.T, hashes ...string) (*TwoFactorSqlite, int) {
+	t.Helper()
+	db := openCountingDB(t)
+	userID, _ := seedListing(t, db, 0, 0)
+	now := time.Now().UTC()
+
+	repo := NewTwoFactorSqlite(db)
+	if err := repo.SaveTOTPSecret(models.TOTP{UserID: userID, Secret: "secret", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.EnableTOTP(userID, 100, now, hashes); err != nil {
+		t.Fatal(err)
+	}
+	return repo, userID
+}
+
+func TestUseTOTPStepRefusesReplay(t *testing.T) {
+	repo, userID := enabledTOTP(t)
+
+	steps := []struct {
+		step int64
+		ok   bool
+	}{
+		{100, false}, // the code that turned the authenticator on
+		{101, true},
+		{101, false},
+		{99, false}, // an older code, still within the skew
+		{103, true},
+		{102, false},
+	}
+	for _, tt := range steps {
+		ok, err := repo.UseTOTPStep(userID, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("UseTOTPStep(%d) = %v, want %v", tt.step, ok, tt.ok)
+		}
+	}
+}
+
+func TestUseRecoveryCodeOnce(t *testing.T) {
+	repo, userID := enabledTOTP(t, "first", "second")
+	now := time.Now().UTC()
+
+	if ok, err := repo.UseRecoveryCode(userID+1, "first", now); ok || err != nil {
+		t.Errorf("another user used the code: %v, %v", ok, err)
+	}
+
+	for _, tt := range []struct {
+		hash string
+		ok   bool
+	}{
+		{"first", true},
+		{"first", false},
+		{"unknown", false},
+		{"second", true},
+	} {
+		ok, err := repo.UseRecoveryCode(userID, tt.hash, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("UseRecoveryCode(%s) = %v, want %v", tt.hash, ok, tt.ok)
+		}
+	}
+
+	if n, err := repo.CountRecoveryCodes(userID); err != nil || n != 0 {
+		t.Errorf("CountRecoveryCodes = %d, %v; want 0", n, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"forum/internal/models"
@@ -15,10 +16,36 @@ import (
 )
 
 type Authorization interface {
-	CreateUser(user models.User) error
-	SetSession(username, password string) (models.Session, error)
+	// CreateUser signs the user up from ip and mails them their
+	// confirmation link. Sign ups are throttled like the mails they send.
+	CreateUser(user models.User, ip string) (int, error)
+	// SetSession signs the user in. When they have two-factor
+	// authentication on and req has no code, it returns a
+	// SecondFactorError to be answered with CompleteSignIn.
+	SetSession(req models.SignInRequest) (models.Session, error)
+	CompleteSignIn(challenge, code string) (models.Session, error)
+	// SignInWithPasskey signs in the owner of the passkey the browser
+	// answered with. A passkey stands for both factors, as the device
+	// must have verified the user with a PIN or a biometric.
+	SignInWithPasskey(resp models.PasskeyAssertion, req models.SignInRequest) (models.Session, error)
+	// SignInWithOIDC signs in the user the OpenID provider sent back with
+	// state and code, creating their account on their first sign in. The
+	// provider is trusted with both factors.
+	SignInWithOIDC(state, code string, req models.SignInRequest) (models.Session, error)
 	DeleteSession(token string) error
 	UserByToken(token string) (models.User, error)
+	UserByUsername(username string) (models.User, error)
+	// Sessions lists the sessions of the user, marking the one with the
+	// given token as current.
+	Sessions(userID int, token string) ([]models.Session, error)
+	DeleteSessionByID(ID, userID int) error
+	DeleteOtherSessions(userID int, token string) error
+	// TouchSession records that the session is still in use from ip and
+	// extends it when it is close to expiring, reporting whether it did.
+	TouchSession(token, ip string) (models.Session, bool, error)
+	// PurgeExpiredSessions deletes the expired sessions and returns how
+	// many there were. Forgotten sign in failures go with them.
+	PurgeExpiredSessions() (int, error)
 }
 
 var (
@@ -26,69 +53,255 @@ var (
 	ErrWrongPassword = errors.New("wrong password")
 	ErrUsernameTaken = errors.New("username is already taken")
 	ErrEmailTaken    = errors.New("email address is already taken")
+	ErrNoSession     = errors.New("session is not found")
 )
 
-const sessionTime = time.Hour * 6
+const (
+	sessionTime = time.Hour * 6
+	// rememberTime is the lifetime of the sessions started with
+	// "remember me".
+	rememberTime = time.Hour * 24 * 30
+)
+
+// lastSeenInterval is how stale the last-seen time of a session may get
+// before a request updates it.
+const lastSeenInterval = time.Minute
+
+// maxUserAgent caps the length of the user agent stored with a session.
+const maxUserAgent = 512
 
 type AuthService struct {
-	repo repository.Authorization
+	repo      repository.Authorization
+	guard     *LoginGuardService
+	verifier  *EmailVerificationService
+	twoFactor *TwoFactorService
+	passkeys  *PasskeyService
+	oidc      *OIDCService
 }
 
-func NewAuthService(repo repository.Authorization) *AuthService {
+// NewAuthService creates the service; guard throttles failed sign ins,
+// verifier mails new users their confirmation link, twoFactor checks the
+// second factor of those who turned it on, and passkeys and oidc check
+// the sign ins without a password.
+func NewAuthService(repo repository.Authorization, guard *LoginGuardService, verifier *EmailVerificationService, twoFactor *TwoFactorService, passkeys *PasskeyService, oidc *OIDCService) *AuthService {
 	return &AuthService{
-		repo: repo,
+		repo:      repo,
+		guard:     guard,
+		verifier:  verifier,
+		twoFactor: twoFactor,
+		passkeys:  passkeys,
+		oidc:      oidc,
 	}
 }
 
-func (s *AuthService) CreateUser(user models.User) error {
+func (s *AuthService) CreateUser(user models.User, ip string) (int, error) {
 	if _, err := s.repo.GetUser("", user.Email); err != sql.ErrNoRows {
 		if err == nil {
-			return ErrEmailTaken
+			return 0, ErrEmailTaken
 		}
-		return err
+		return 0, err
 	}
 
 	if _, err := s.repo.GetUser(user.Username, ""); err != sql.ErrNoRows {
 		if err == nil {
-			return ErrUsernameTaken
+			return 0, ErrUsernameTaken
 		}
-		return err
+		return 0, err
 	}
 
 	if err := checkUserInfo(user); err != nil {
-		return err
+		return 0, err
+	}
+
+	// Each sign up mails a link, so nobody may sign up others in a loop.
+	if err := s.guard.LimitVerification(user.Email, ip); err != nil {
+		return 0, err
 	}
 
-	password, err := s.generatePasswordHash(user.Password)
+	password, err := generatePasswordHash(user.Password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	user.Password = password
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+
+	user.ID, err = s.repo.CreateUser(user)
+	if err != nil {
+		return 0, err
+	}
 
-	return s.repo.CreateUser(user)
+	// The account exists either way: the user can ask for another link.
+	if err := s.verifier.SendVerification(user); err != nil {
+		log.Printf("send verification: %s", err)
+	}
+	return user.ID, nil
 }
 
-func (s *AuthService) SetSession(username, password string) (models.Session, error) {
-	user, err := s.checkUser(username, password)
+func (s *AuthService) SetSession(req models.SignInRequest) (models.Session, error) {
+	// Throttled attempts are refused before the password is compared.
+	if err := s.guard.Check(req.Username, req.IP); err != nil {
+		return models.Session{}, err
+	}
+
+	user, err := s.checkUser(req.Username, req.Password)
+	if errors.Is(err, ErrNoUser) || errors.Is(err, ErrWrongPassword) {
+		if err := s.guard.Fail(req.Username, req.IP, user); err != nil {
+			return models.Session{}, fmt.Errorf("set session -> error recording failure: %s", err)
+		}
+		return models.Session{}, err
+	} else if err != nil {
+		return models.Session{}, err
+	}
+
+	twoFactor, err := s.twoFactor.enabled(user.ID)
 	if err != nil {
 		return models.Session{}, err
 	}
+	if twoFactor {
+		// Clients that can't show a second page send the code along.
+		if req.Code == "" {
+			challenge, err := s.twoFactor.challenge(user.ID, req)
+			if err != nil {
+				return models.Session{}, err
+			}
+			return models.Session{}, &SecondFactorError{Challenge: challenge}
+		}
+		if err := s.checkCode(user, req.IP, req.Code); err != nil {
+			return models.Session{}, err
+		}
+	}
+
+	if err := s.guard.Succeed(req.Username); err != nil {
+		return models.Session{}, fmt.Errorf("set session -> error clearing failures: %s", err)
+	}
 
-	s.repo.DeleteSessionByUserId(user.ID)
+	return s.createSession(user.ID, req)
+}
 
-	token, err := s.generateToken()
+func (s *AuthService) CompleteSignIn(challenge, code string) (models.Session, error) {
+	c, err := s.twoFactor.openChallenge(challenge)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	user, err := s.repo.GetUserByID(c.UserID)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	if err := s.guard.Check(user.Username, c.IP); err != nil {
+		return models.Session{}, err
+	}
+
+	if err := s.checkCode(user, c.IP, code); err != nil {
+		if errors.Is(err, ErrWrongCode) {
+			if err := s.twoFactor.failChallenge(c); err != nil {
+				return models.Session{}, err
+			}
+		}
+		return models.Session{}, err
+	}
+
+	if err := s.twoFactor.repo.DeleteLoginChallenge(c.ID); err != nil {
+		return models.Session{}, err
+	}
+	if err := s.guard.Succeed(user.Username); err != nil {
+		return models.Session{}, fmt.Errorf("complete sign in -> error clearing failures: %s", err)
+	}
+
+	return s.createSession(user.ID, models.SignInRequest{
+		UserAgent: c.UserAgent,
+		IP:        c.IP,
+		Remember:  c.Persistent,
+	})
+}
+
+func (s *AuthService) SignInWithPasskey(resp models.PasskeyAssertion, req models.SignInRequest) (models.Session, error) {
+	passkey, err := s.passkeys.verifyAssertion(resp)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return s.createSession(passkey.UserID, req)
+}
+
+func (s *AuthService) SignInWithOIDC(state, code string, req models.SignInRequest) (models.Session, error) {
+	user, created, persistent, err := s.oidc.identify(state, code)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	if created && !user.EmailVerified {
+		if err := s.verifier.SendVerification(user); err != nil {
+			log.Printf("send verification: %s", err)
+		}
+	}
+
+	req.Remember = persistent
+	return s.createSession(user.ID, req)
+}
+
+// confirmPassword checks the password a signed in user entered again before
+// changing how they sign in. A stolen session mustn't be a way to guess
+// the password unthrottled, so wrong ones count as failed sign ins from ip.
+func confirmPassword(users repository.Authorization, guard *LoginGuardService, user models.User, password, ip string) error {
+	if err := guard.Check(user.Username, ip); err != nil {
+		return err
+	}
+
+	stored, err := users.GetUserByID(user.ID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(password)); err != nil {
+		if err := guard.Fail(user.Username, ip, stored); err != nil {
+			return fmt.Errorf("confirm password -> error recording failure: %s", err)
+		}
+		return ErrWrongPassword
+	}
+
+	if err := guard.Succeed(user.Username); err != nil {
+		return fmt.Errorf("confirm password -> error clearing failures: %s", err)
+	}
+	return nil
+}
+
+// checkCode verifies the second factor of a sign in. Wrong codes count as
+// failed attempts, like wrong passwords.
+func (s *AuthService) checkCode(user models.User, ip, code string) error {
+	err := s.twoFactor.verify(user.ID, code)
+	if errors.Is(err, ErrWrongCode) {
+		if err := s.guard.Fail(user.Username, ip, user); err != nil {
+			return fmt.Errorf("check code -> error recording failure: %s", err)
+		}
+	}
+	return err
+}
+
+func (s *AuthService) createSession(userID int, req models.SignInRequest) (models.Session, error) {
+	token, err := randomToken()
 	if err != nil {
 		return models.Session{}, fmt.Errorf("set session -> error generating token: %s", err)
 	}
 
+	if len(req.UserAgent) > maxUserAgent {
+		req.UserAgent = req.UserAgent[:maxUserAgent]
+	}
+
+	now := time.Now()
 	session := models.Session{
-		UserID:         user.ID,
+		UserID:         userID,
 		Token:          token,
-		ExpirationDate: time.Now().Add(sessionTime),
+		ExpirationDate: now.Add(sessionLifetime(req.Remember)),
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		UserAgent:      req.UserAgent,
+		IP:             req.IP,
+		Persistent:     req.Remember,
 	}
 
-	if err = s.repo.CreateSession(session); err != nil {
+	if session.ID, err = s.repo.CreateSession(session); err != nil {
 		return session, fmt.Errorf("set session -> error creating session: %s", err)
 	}
 
@@ -99,12 +312,102 @@ func (s *AuthService) DeleteSession(token string) error {
 	return s.repo.DeleteSession(token)
 }
 
+// UserByToken returns the owner of the session, or no user at all for
+// unknown and expired tokens.
 func (s *AuthService) UserByToken(token string) (models.User, error) {
-	user, err := s.repo.UserByToken(token)
-	if err != nil && err != sql.ErrNoRows {
-		return user, nil
+	user, err := s.repo.UserByToken(token, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, nil
 	}
-	return user, nil
+	return user, err
+}
+
+func (s *AuthService) UserByUsername(username string) (models.User, error) {
+	user, err := s.repo.GetUser(username, "")
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNoUser
+	}
+	return user, err
+}
+
+func (s *AuthService) Sessions(userID int, token string) ([]models.Session, error) {
+	sessions, err := s.repo.GetSessions(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Token == token
+		sessions[i].Token = ""
+	}
+	return sessions, nil
+}
+
+func (s *AuthService) DeleteSessionByID(ID, userID int) error {
+	ok, err := s.repo.DeleteSessionByID(ID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoSession
+	}
+	return nil
+}
+
+func (s *AuthService) DeleteOtherSessions(userID int, token string) error {
+	return s.repo.DeleteOtherSessions(userID, token)
+}
+
+// TouchSession slides the expiry of a session forward once less than half
+// of its lifetime is left, so that sessions in use don't expire.
+func (s *AuthService) TouchSession(token, ip string) (models.Session, bool, error) {
+	session, err := s.repo.GetSession(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, false, ErrNoSession
+	} else if err != nil {
+		return session, false, err
+	}
+
+	now := time.Now()
+	if err := s.repo.TouchSession(token, ip, now, lastSeenInterval); err != nil {
+		return session, false, err
+	}
+
+	lifetime := sessionLifetime(session.Persistent)
+	if session.ExpirationDate.Sub(now) >= lifetime/2 {
+		return session, false, nil
+	}
+
+	session.ExpirationDate = now.Add(lifetime)
+	if err := s.repo.RenewSession(token, session.ExpirationDate); err != nil {
+		return session, false, err
+	}
+	return session, true, nil
+}
+
+func (s *AuthService) PurgeExpiredSessions() (int, error) {
+	now := time.Now()
+	// Sign ins abandoned at the second factor, at a passkey prompt or at
+	// the identity provider go with the sessions.
+	if err := s.twoFactor.repo.DeleteExpiredChallenges(now); err != nil {
+		return 0, err
+	}
+	if err := s.passkeys.repo.DeleteExpiredWebAuthnChallenges(now); err != nil {
+		return 0, err
+	}
+	if err := s.oidc.repo.DeleteExpiredOIDCLogins(now); err != nil {
+		return 0, err
+	}
+	if err := s.guard.ForgetOldFailures(); err != nil {
+		return 0, err
+	}
+	return s.repo.DeleteExpiredSessions(now)
+}
+
+func sessionLifetime(persistent bool) time.Duration {
+	if persistent {
+		return rememberTime
+	}
+	return sessionTime
 }
 
 func (s *AuthService) checkUser(username, password string) (models.User, error) {
@@ -120,7 +423,8 @@ func (s *AuthService) checkUser(username, password string) (models.User, error)
 	return user, nil
 }
 
-func (s *AuthService) generateToken() (string, error) {
+// randomToken returns 32 random bytes, hex encoded.
+func randomToken() (string, error) {
 	const tokenLength = 32
 	b := make([]byte, tokenLength)
 	if _, err := rand.Read(b); err != nil {
@@ -129,7 +433,7 @@ func (s *AuthService) generateToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-func (s *AuthService) generatePasswordHash(password string) (string, error) {
+func generatePasswordHash(password string) (string, error) {
 	pass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
 	return string(pass), err
 }
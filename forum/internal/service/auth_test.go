@@ -0,0 +1,202 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+	"forum/internal/webauthn"
+)
+
+// sessionStore is a user repository holding sessions, by token, and the
+// error its reads of users fail with.
+type sessionStore struct {
+	repository.Authorization
+	sessions map[string]models.Session
+	err      error
+}
+
+func (r *sessionStore) UserByToken(token string, now time.Time) (models.User, error) {
+	if r.err != nil {
+		return models.User{}, r.err
+	}
+	session, ok := r.sessions[token]
+	if !ok || !now.Before(session.ExpirationDate) {
+		return models.User{}, sql.ErrNoRows
+	}
+	return models.User{ID: session.UserID, Username: "alice"}, nil
+}
+
+func (r *sessionStore) GetSession(token string) (models.Session, error) {
+	session, ok := r.sessions[token]
+	if !ok {
+		return session, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (r *sessionStore) TouchSession(token, ip string, seenAt time.Time, interval time.Duration) error {
+	return nil
+}
+
+func (r *sessionStore) RenewSession(token string, expiresAt time.Time) error {
+	session := r.sessions[token]
+	session.ExpirationDate = expiresAt
+	r.sessions[token] = session
+	return nil
+}
+
+func (r *sessionStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	n := 0
+	for token, session := range r.sessions {
+		if !now.Before(session.ExpirationDate) {
+			delete(r.sessions, token)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// The sweeps of the sign ins left halfway, each noting itself in swept.
+type (
+	sweptTwoFactor struct {
+		repository.TwoFactor
+		swept *[]string
+	}
+	sweptPasskeys struct {
+		repository.Passkey
+		swept *[]string
+	}
+	sweptOIDC struct {
+		repository.OIDC
+		swept *[]string
+	}
+)
+
+func (r sweptTwoFactor) DeleteExpiredChallenges(now time.Time) error {
+	*r.swept = append(*r.swept, "login challenges")
+	return nil
+}
+
+func (r sweptPasskeys) DeleteExpiredWebAuthnChallenges(now time.Time) error {
+	*r.swept = append(*r.swept, "webauthn challenges")
+	return nil
+}
+
+func (r sweptOIDC) DeleteExpiredOIDCLogins(now time.Time) error {
+	*r.swept = append(*r.swept, "oidc logins")
+	return nil
+}
+
+func TestUserByToken(t *testing.T) {
+	now := time.Now()
+	repo := &sessionStore{sessions: map[string]models.Session{
+		"live":    {UserID: 1, Token: "live", ExpirationDate: now.Add(time.Hour)},
+		"expired": {UserID: 1, Token: "expired", ExpirationDate: now.Add(-time.Second)},
+	}}
+	s := NewAuthService(repo, nil, nil, nil, nil, nil)
+
+	if user, err := s.UserByToken("live"); err != nil || user.ID != 1 {
+		t.Errorf("live session: %+v, %v; want user 1", user, err)
+	}
+	for _, token := range []string{"expired", "unknown"} {
+		if user, err := s.UserByToken(token); err != nil || user != (models.User{}) {
+			t.Errorf("%s session: %+v, %v; want nobody", token, user, err)
+		}
+	}
+
+	// A broken database mustn't pass for a signed out user.
+	repo.err = errors.New("database is locked")
+	if _, err := s.UserByToken("live"); !errors.Is(err, repo.err) {
+		t.Errorf("failing repository: %v, want %v", err, repo.err)
+	}
+}
+
+func TestTouchSessionRenewsPastHalfLife(t *testing.T) {
+	tests := []struct {
+		name       string
+		persistent bool
+		left       time.Duration
+		renewed    bool
+	}{
+		{"fresh session", false, sessionTime - time.Minute, false},
+		{"session before half life", false, sessionTime/2 + time.Minute, false},
+		{"session past half life", false, sessionTime/2 - time.Minute, true},
+		{"remembered session", true, sessionTime - time.Minute, true},
+		{"fresh remembered session", true, rememberTime - time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expires := time.Now().Add(tt.left)
+			repo := &sessionStore{sessions: map[string]models.Session{
+				"token": {UserID: 1, Token: "token", ExpirationDate: expires, Persistent: tt.persistent},
+			}}
+			s := NewAuthService(repo, nil, nil, nil, nil, nil)
+
+			session, renewed, err := s.TouchSession("token", "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renewed != tt.renewed {
+				t.Fatalf("renewed = %v, want %v", renewed, tt.renewed)
+			}
+
+			want := expires
+			if tt.renewed {
+				want = time.Now().Add(sessionLifetime(tt.persistent))
+			}
+			if d := session.ExpirationDate.Sub(want); d < -time.Second || d > time.Second {
+				t.Errorf("session expires at %s, want %s", session.ExpirationDate, want)
+			}
+			if stored := repo.sessions["token"].ExpirationDate; !stored.Equal(session.ExpirationDate) {
+				t.Errorf("stored expiry %s, returned %s", stored, session.ExpirationDate)
+			}
+		})
+	}
+
+	s := NewAuthService(&sessionStore{}, nil, nil, nil, nil, nil)
+	if _, _, err := s.TouchSession("unknown", "192.0.2.1"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("unknown session: %v, want %v", err, ErrNoSession)
+	}
+}
+
+func TestPurgeExpiredSessions(t *testing.T) {
+	now := time.Now()
+	repo := &sessionStore{sessions: map[string]models.Session{
+		"live":      {UserID: 1, ExpirationDate: now.Add(time.Hour)},
+		"expired":   {UserID: 1, ExpirationDate: now.Add(-time.Second)},
+		"forgotten": {UserID: 2, ExpirationDate: now.Add(-rememberTime)},
+	}}
+	guard, throttles, clock, _ := newTestGuard()
+	for value, lastFailure := range map[string]time.Time{
+		"192.0.2.1": clock.Now().Add(-time.Hour),
+		"192.0.2.2": clock.Now().Add(-failureMemory - time.Minute),
+	} {
+		throttles.SaveLoginThrottle(models.LoginThrottle{Kind: models.ThrottleIP, Value: value, Failures: 1, LastFailureAt: lastFailure})
+	}
+	var swept []string
+	s := NewAuthService(repo, guard, nil,
+		NewTwoFactorService(sweptTwoFactor{swept: &swept}, repo, nil, SystemClock),
+		NewPasskeyService(sweptPasskeys{swept: &swept}, repo, nil, webauthn.RelyingParty{}, SystemClock),
+		NewOIDCService(sweptOIDC{swept: &swept}, repo, nil, "", SystemClock))
+
+	n, err := s.PurgeExpiredSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("purged %d sessions, want 2", n)
+	}
+	if _, ok := repo.sessions["live"]; !ok || len(repo.sessions) != 1 {
+		t.Errorf("sessions left: %v, want the live one", repo.sessions)
+	}
+	if len(swept) != 3 {
+		t.Errorf("swept %v, want the login challenges, webauthn challenges and oidc logins", swept)
+	}
+	if _, err := throttles.GetLoginThrottle(models.ThrottleIP, "192.0.2.1"); err != nil || len(throttles.throttles) != 1 {
+		t.Errorf("throttles left: %v, want the recent one", throttles.throttles)
+	}
+}
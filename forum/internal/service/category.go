@@ -0,0 +1,177 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type Category interface {
+	Categories() ([]models.Category, error)
+	CategoryBySlug(slug string) (models.Category, error)
+	CreateCategory(category models.Category, user models.User) error
+	UpdateCategory(category models.Category, user models.User) error
+}
+
+var (
+	ErrNoCategory       = errors.New("category is not found")
+	ErrCategoryExists   = errors.New("a category with this slug already exists")
+	ErrInvalidCategory  = errors.New("a category needs a name and a slug of lowercase letters, digits and dashes")
+	ErrCategoryParent   = errors.New("a category can only be nested under a top-level category")
+	ErrUnknownCategory  = errors.New("unknown category")
+	ErrNoPostCategories = errors.New("choose at least one category")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+const (
+	maxSlugLength         = 32
+	maxCategoryNameLength = 64
+)
+
+type CategoryService struct {
+	repo repository.Category
+}
+
+func NewCategoryService(repo repository.Category) *CategoryService {
+	return &CategoryService{
+		repo: repo,
+	}
+}
+
+// Categories returns every category, each top-level one followed by its
+// subcategories.
+func (s *CategoryService) Categories() ([]models.Category, error) {
+	categories, err := s.repo.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]models.Category)
+	for _, category := range categories {
+		if category.ParentID != 0 {
+			children[category.ParentID] = append(children[category.ParentID], category)
+		}
+	}
+
+	ordered := make([]models.Category, 0, len(categories))
+	for _, category := range categories {
+		if category.ParentID == 0 {
+			ordered = append(ordered, category)
+			ordered = append(ordered, children[category.ID]...)
+		}
+	}
+	return ordered, nil
+}
+
+// CategoryBySlug returns a category with its subcategories.
+func (s *CategoryService) CategoryBySlug(slug string) (models.Category, error) {
+	category, err := s.repo.GetCategoryBySlug(slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return category, ErrNoCategory
+	} else if err != nil {
+		return category, err
+	}
+
+	categories, err := s.repo.GetCategories()
+	if err != nil {
+		return category, err
+	}
+	for _, child := range categories {
+		if child.ParentID == category.ID {
+			category.Children = append(category.Children, child)
+		}
+	}
+
+	return category, nil
+}
+
+func (s *CategoryService) CreateCategory(category models.Category, user models.User) error {
+	if !CanManageCategories(user) {
+		return ErrForbidden
+	}
+
+	category.Slug = strings.ToLower(strings.TrimSpace(category.Slug))
+	if len(category.Slug) > maxSlugLength || !slugPattern.MatchString(category.Slug) {
+		return ErrInvalidCategory
+	}
+	if err := s.validate(category); err != nil {
+		return err
+	}
+
+	if _, err := s.repo.GetCategoryBySlug(category.Slug); err == nil {
+		return ErrCategoryExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+	return s.repo.CreateCategory(category)
+}
+
+// UpdateCategory renames, moves or archives a category. The slug never
+// changes, so links to the category and its posts keep working.
+func (s *CategoryService) UpdateCategory(category models.Category, user models.User) error {
+	if !CanManageCategories(user) {
+		return ErrForbidden
+	}
+
+	existing, err := s.repo.GetCategoryByID(category.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoCategory
+	} else if err != nil {
+		return err
+	}
+
+	category.Slug = existing.Slug
+	if err := s.validate(category); err != nil {
+		return err
+	}
+
+	if category.ParentID != 0 {
+		categories, err := s.repo.GetCategories()
+		if err != nil {
+			return err
+		}
+		for _, child := range categories {
+			if child.ParentID == category.ID {
+				return ErrCategoryParent
+			}
+		}
+	}
+
+	category.UpdatedAt = time.Now()
+	return s.repo.UpdateCategory(category)
+}
+
+func (s *CategoryService) validate(category models.Category) error {
+	name := strings.TrimSpace(category.Name)
+	if name == "" || len(name) > maxCategoryNameLength {
+		return ErrInvalidCategory
+	}
+
+	if category.ParentID == 0 {
+		return nil
+	}
+	if category.ParentID == category.ID {
+		return ErrCategoryParent
+	}
+
+	parent, err := s.repo.GetCategoryByID(category.ParentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoCategory
+	} else if err != nil {
+		return err
+	}
+	if parent.ParentID != 0 {
+		return ErrCategoryParent
+	}
+
+	return nil
+}
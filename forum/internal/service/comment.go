@@ -1,36 +1,179 @@
 package service
 
 import (
+	"database/sql"
 	"errors"
 	"forum/internal/models"
 	"forum/internal/repository"
 	"strings"
+	"time"
 )
 
 type Commentary interface {
-	CreateComment(comment models.Comment) error
+	// CreateComment adds a comment of the user, who must have confirmed
+	// their email address.
+	CreateComment(comment models.Comment, user models.User) (int, error)
 	CommentsByPostID(ID int, userID int) ([]models.Comment, error)
+	CommentThread(postID, commentID, userID int) (models.Comment, error)
+	CommentByID(commentID int, user models.User) (models.Comment, error)
+	UpdateComment(comment models.Comment, user models.User) (int, error)
+	DeleteComment(commentID int, user models.User) (int, error)
 }
 
-var ErrEmptyComment = errors.New("can't create an empty comment")
+var (
+	ErrEmptyComment = errors.New("can't create an empty comment")
+	ErrNoComment    = errors.New("comment is not found")
+)
 
 type CommentService struct {
-	repo repository.Commentary
+	repo     repository.Commentary
+	maxDepth int
 }
 
-func NewCommentService(repo repository.Commentary) *CommentService {
+// NewCommentService creates the service; maxDepth is how many levels of
+// replies are rendered before a thread is cut off.
+func NewCommentService(repo repository.Commentary, maxDepth int) *CommentService {
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
 	return &CommentService{
-		repo: repo,
+		repo:     repo,
+		maxDepth: maxDepth,
 	}
 }
 
-func (s *CommentService) CreateComment(comment models.Comment) error {
+func (s *CommentService) CreateComment(comment models.Comment, user models.User) (int, error) {
+	if err := CanPost(user); err != nil {
+		return 0, err
+	}
 	if strings.TrimSpace(comment.Content) == "" {
-		return ErrEmptyComment
+		return 0, ErrEmptyComment
+	}
+
+	if comment.ParentID != 0 {
+		parent, err := s.repo.GetCommentByID(comment.ParentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoComment
+		} else if err != nil {
+			return 0, err
+		}
+
+		if parent.PostID != comment.PostID {
+			return 0, ErrNoComment
+		}
 	}
+
+	comment.UserID = user.ID
+	comment.CreatedAt = time.Now()
+	comment.UpdatedAt = comment.CreatedAt
 	return s.repo.CreateComment(comment)
 }
 
+// CommentsByPostID returns the top-level comments of a post with their replies nested under them.
 func (s *CommentService) CommentsByPostID(ID int, userID int) ([]models.Comment, error) {
-	return s.repo.CommentsByPostID(ID, userID)
+	comments, err := s.repo.CommentsByPostID(ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.nest(groupByParent(comments), 0, 0), nil
+}
+
+// CommentThread returns a single comment of a post with its replies nested
+// under it, so that a thread cut off by the maximum depth can be continued.
+func (s *CommentService) CommentThread(postID, commentID, userID int) (models.Comment, error) {
+	comments, err := s.repo.CommentsByPostID(postID, userID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	for _, comment := range comments {
+		if comment.ID == commentID {
+			comment.Replies = s.nest(groupByParent(comments), comment.ID, 1)
+			return comment, nil
+		}
+	}
+
+	return models.Comment{}, ErrNoComment
+}
+
+func (s *CommentService) nest(children map[int][]models.Comment, parentID, depth int) []models.Comment {
+	replies := children[parentID]
+	for i := range replies {
+		replies[i].Depth = depth
+		if depth+1 < s.maxDepth {
+			replies[i].Replies = s.nest(children, replies[i].ID, depth+1)
+		} else {
+			replies[i].HiddenReplies = countReplies(children, replies[i].ID)
+		}
+	}
+	return replies
+}
+
+func groupByParent(comments []models.Comment) map[int][]models.Comment {
+	children := make(map[int][]models.Comment)
+	for _, comment := range comments {
+		children[comment.ParentID] = append(children[comment.ParentID], comment)
+	}
+	return children
+}
+
+func countReplies(children map[int][]models.Comment, parentID int) int {
+	count := 0
+	for _, reply := range children[parentID] {
+		count += 1 + countReplies(children, reply.ID)
+	}
+	return count
+}
+
+// CommentByID returns the comment if the user may edit it.
+func (s *CommentService) CommentByID(commentID int, user models.User) (models.Comment, error) {
+	comment, err := s.comment(commentID)
+	if err != nil {
+		return comment, err
+	}
+
+	if !CanEditComment(user, comment) {
+		return comment, ErrForbidden
+	}
+
+	return comment, nil
+}
+
+func (s *CommentService) comment(commentID int) (models.Comment, error) {
+	comment, err := s.repo.GetCommentByID(commentID)
+	if errors.Is(err, sql.ErrNoRows) || comment.Deleted {
+		return comment, ErrNoComment
+	}
+	return comment, err
+}
+
+// UpdateComment changes the content of a comment the user may edit and returns the ID of its post.
+func (s *CommentService) UpdateComment(comment models.Comment, user models.User) (int, error) {
+	if strings.TrimSpace(comment.Content) == "" {
+		return 0, ErrEmptyComment
+	}
+
+	existing, err := s.CommentByID(comment.ID, user)
+	if err != nil {
+		return 0, err
+	}
+
+	existing.Content = comment.Content
+	existing.UpdatedAt = time.Now()
+	return existing.PostID, s.repo.UpdateComment(existing)
+}
+
+// DeleteComment removes a comment the user may delete and returns the ID of its post.
+func (s *CommentService) DeleteComment(commentID int, user models.User) (int, error) {
+	comment, err := s.comment(commentID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !CanDeleteComment(user, comment) {
+		return 0, ErrForbidden
+	}
+
+	return comment.PostID, s.repo.DeleteComment(commentID)
 }
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"strings"
+
+	"forum/internal/models"
+)
+
+// maxDiffEdits bounds the work of lineDiff: two versions further apart
+// than this many added and removed lines are shown as the whole text
+// replaced.
+const maxDiffEdits = 500
+
+// lineDiff compares two texts line by line and returns the lines needed
+// to turn old into new. The lines the texts start and end with in common
+// are set aside, and the rest is compared with Myers' algorithm
+// (http://www.xmailserver.org/diff2.pdf), whose time and memory grow with
+// the number of changed lines rather than with the length of the texts.
+func lineDiff(old, new string) []models.DiffLine {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := make([]models.DiffLine, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		diff = append(diff, models.DiffLine{Kind: models.DiffUnchanged, Text: line})
+	}
+	diff = appendEdits(diff, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, models.DiffLine{Kind: models.DiffUnchanged, Text: line})
+	}
+
+	return diff
+}
+
+// appendEdits appends the shortest edit turning a into b, or a removed
+// then b added when it takes more than maxDiffEdits lines.
+func appendEdits(diff []models.DiffLine, a, b []string) []models.DiffLine {
+	edits, ok := shortestEdit(a, b)
+	if !ok {
+		for _, line := range a {
+			diff = append(diff, models.DiffLine{Kind: models.DiffRemoved, Text: line})
+		}
+		for _, line := range b {
+			diff = append(diff, models.DiffLine{Kind: models.DiffAdded, Text: line})
+		}
+		return diff
+	}
+	return append(diff, edits...)
+}
+
+// shortestEdit runs Myers' algorithm on a and b, giving up after
+// maxDiffEdits added and removed lines.
+func shortestEdit(a, b []string) ([]models.DiffLine, bool) {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k = x - y; trace
+	// keeps diagonals -d to d of v after each round d to walk back.
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrackEdits(a, b, trace), true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	return nil, false
+}
+
+// backtrackEdits follows the rounds of shortestEdit back from the end of
+// both texts and returns the edit in order.
+func backtrackEdits(a, b []string, trace [][]int) []models.DiffLine {
+	var edits []models.DiffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		// The round added or removed one line, then followed equal ones.
+		midX, midY := prevX+1, prevY
+		if prevK == k+1 {
+			midX, midY = prevX, prevY+1
+		}
+		for x > midX && y > midY {
+			x--
+			y--
+			edits = append(edits, models.DiffLine{Kind: models.DiffUnchanged, Text: a[x]})
+		}
+		if prevK == k+1 {
+			edits = append(edits, models.DiffLine{Kind: models.DiffAdded, Text: b[prevY]})
+		} else {
+			edits = append(edits, models.DiffLine{Kind: models.DiffRemoved, Text: a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, models.DiffLine{Kind: models.DiffUnchanged, Text: a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"forum/internal/models"
+)
+
+// diffString writes a diff the way unified diffs mark their lines.
+func diffString(diff []models.DiffLine) string {
+	var b strings.Builder
+	for _, line := range diff {
+		switch line.Kind {
+		case models.DiffAdded:
+			b.WriteString("+")
+		case models.DiffRemoved:
+			b.WriteString("-")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(line.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{"", "", ""},
+		{"a\nb", "a\nb", " a\n b\n"},
+		{"", "a\nb", "+a\n+b\n"},
+		{"a\nb", "", "-a\n-b\n"},
+		{"a\nc", "a\nb\nc", " a\n+b\n c\n"},
+		{"a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"a\nb\nc", "a\nB\nc", " a\n-b\n+B\n c\n"},
+		{"a\r\nb", "a\nb", " a\n b\n"},
+		{"x\na\nb\nc\ny", "a\nb\nc", "-x\n a\n b\n c\n-y\n"},
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", "-a\n-b\n c\n+b\n a\n b\n-b\n a\n+c\n"},
+	}
+	for _, tt := range tests {
+		if got := diffString(lineDiff(tt.old, tt.new)); got != tt.want {
+			t.Errorf("lineDiff(%q, %q) =\n%s\nwant\n%s", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+// lcsLength is the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkDiff checks that diff turns old into new, keeping the given number
+// of lines.
+func checkDiff(t *testing.T, old, new string, diff []models.DiffLine, unchanged int) {
+	t.Helper()
+
+	var before, after []string
+	kept := 0
+	for _, line := range diff {
+		if line.Kind != models.DiffAdded {
+			before = append(before, line.Text)
+		}
+		if line.Kind != models.DiffRemoved {
+			after = append(after, line.Text)
+		}
+		if line.Kind == models.DiffUnchanged {
+			kept++
+		}
+	}
+	if !reflect.DeepEqual(before, splitLines(old)) || !reflect.DeepEqual(after, splitLines(new)) {
+		t.Fatalf("lineDiff(%q, %q) doesn't turn one into the other:\n%s", old, new, diffString(diff))
+	}
+	if kept != unchanged {
+		t.Fatalf("lineDiff(%q, %q) keeps %d lines, want %d:\n%s", old, new, kept, unchanged, diffString(diff))
+	}
+}
+
+func TestLineDiffIsShortest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	text := func() string {
+		lines := make([]string, rnd.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	for i := 0; i < 2000; i++ {
+		old, new := text(), text()
+		checkDiff(t, old, new, lineDiff(old, new), lcsLength(splitLines(old), splitLines(new)))
+	}
+}
+
+// allocated returns the bytes allocated by f.
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestLineDiffOfLongTexts(t *testing.T) {
+	lines := make([]string, 4000)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i)
+	}
+	old := strings.Join(lines, "\n")
+	lines[1000] = "edited"
+	lines = append(lines[:3000], lines[3010:]...)
+	new := strings.Join(lines, "\n")
+
+	var diff []models.DiffLine
+	bytes := allocated(func() { diff = lineDiff(old, new) })
+	checkDiff(t, old, new, diff, 3989)
+	if bytes > 4<<20 {
+		t.Errorf("a small edit of 4000 lines allocated %d bytes", bytes)
+	}
+}
+
+func TestLineDiffGivesUpOnUnrelatedTexts(t *testing.T) {
+	a := make([]string, 20000)
+	b := make([]string, 20000)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d", i)
+		b[i] = fmt.Sprintf("new %d", i)
+	}
+	b[10000] = a[10000]
+	old, new := strings.Join(a, "\n"), strings.Join(b, "\n")
+
+	var diff []models.DiffLine
+	bytes := allocated(func() { diff = lineDiff(old, new) })
+	checkDiff(t, old, new, diff, 0)
+	if bytes > 32<<20 {
+		t.Errorf("diffing two unrelated texts of 20000 lines allocated %d bytes", bytes)
+	}
+}
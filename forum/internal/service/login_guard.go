@@ -0,0 +1,287 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type LoginGuard interface {
+	// Lockouts lists the accounts and addresses locked out of signing in.
+	Lockouts(user models.User) ([]models.LoginThrottle, error)
+	Unlock(user models.User, kind, value string) error
+}
+
+var (
+	ErrTooManyAttempts = errors.New("too many attempts")
+	ErrNoLockout       = errors.New("lockout is not found")
+)
+
+// ThrottledError refuses a sign in attempt made too soon after failed
+// ones, or a password reset request too soon after others. It matches
+// ErrTooManyAttempts.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottledError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// Clock tells the time; the guard takes one so that its delays can be
+// stepped through without waiting.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the Clock reading the wall time.
+var SystemClock Clock = systemClock{}
+
+// LockoutNotifier tells the owner of an account that it was locked.
+type LockoutNotifier interface {
+	NotifyLockout(user models.User, until time.Time) error
+}
+
+// MailNotifier emails the lockout notice to the owner of the account,
+// pointing them to a password reset in case someone else is guessing.
+type MailNotifier struct {
+	mailer  mail.Mailer
+	baseURL string
+}
+
+func NewMailNotifier(mailer mail.Mailer, baseURL string) *MailNotifier {
+	return &MailNotifier{
+		mailer:  mailer,
+		baseURL: baseURL,
+	}
+}
+
+func (n *MailNotifier) NotifyLockout(user models.User, until time.Time) error {
+	return n.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your account is locked",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"There were too many failed attempts to sign in to your account, so signing in is locked until %s.\n\n"+
+			"If it wasn't you, someone may be guessing your password. Resetting it unlocks the account right away:\n\n"+
+			"%s/forgot-password\n",
+			user.Username, until.UTC().Format("2 Jan 2006 15:04 MST"), n.baseURL),
+	})
+}
+
+const (
+	// freeFailures is how many failed attempts are let through before
+	// each further one has to wait.
+	freeFailures = 3
+	backoffBase  = time.Second
+	maxBackoff   = time.Minute * 15
+	// failureMemory is how long failures are remembered without new ones.
+	failureMemory = time.Hour * 24
+	lockoutTime   = time.Minute * 30
+)
+
+// lockoutAfter is how many failures in a row lock out an account or an
+// address. An address is shared by many people, so it is given more.
+// Reset requests and confirmation mails count as failures: each of them
+// sends a mail.
+var lockoutAfter = map[string]int{
+	models.ThrottleAccount:     10,
+	models.ThrottleIP:          50,
+	models.ThrottleResetEmail:  10,
+	models.ThrottleResetIP:     50,
+	models.ThrottleVerifyEmail: 10,
+	models.ThrottleVerifyIP:    50,
+}
+
+type LoginGuardService struct {
+	repo     repository.LoginThrottle
+	clock    Clock
+	notifier LockoutNotifier
+}
+
+func NewLoginGuardService(repo repository.LoginThrottle, clock Clock, notifier LockoutNotifier) *LoginGuardService {
+	return &LoginGuardService{
+		repo:     repo,
+		clock:    clock,
+		notifier: notifier,
+	}
+}
+
+// Check returns a ThrottledError while the account or the address has to
+// wait before trying again.
+func (s *LoginGuardService) Check(username, ip string) error {
+	return s.check(throttleKeys(username, ip))
+}
+
+// Fail records a failed attempt, locking out the account or the address
+// once they fail too often. user is the zero User when the username is
+// unknown: the failures are counted all the same.
+func (s *LoginGuardService) Fail(username, ip string, user models.User) error {
+	return s.fail(throttleKeys(username, ip), user)
+}
+
+// LimitReset counts a password reset request for the email address from
+// ip. It returns a ThrottledError, without counting it, while either of
+// them has to wait, so that nobody's inbox can be flooded with mail.
+func (s *LoginGuardService) LimitReset(email, ip string) error {
+	return s.limitMail(models.ThrottleResetEmail, models.ThrottleResetIP, email, ip)
+}
+
+// LimitVerification counts an email confirmation mail, sent at sign up or
+// on request, like LimitReset does reset requests.
+func (s *LoginGuardService) LimitVerification(email, ip string) error {
+	return s.limitMail(models.ThrottleVerifyEmail, models.ThrottleVerifyIP, email, ip)
+}
+
+func (s *LoginGuardService) limitMail(emailKind, ipKind, email, ip string) error {
+	keys := [][2]string{{emailKind, strings.ToLower(email)}}
+	if ip != "" {
+		keys = append(keys, [2]string{ipKind, ip})
+	}
+
+	if err := s.check(keys); err != nil {
+		return err
+	}
+	return s.fail(keys, models.User{})
+}
+
+func (s *LoginGuardService) check(keys [][2]string) error {
+	now := s.clock.Now()
+
+	var wait time.Duration
+	for _, key := range keys {
+		throttle, err := s.repo.GetLoginThrottle(key[0], key[1])
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if left := throttle.LockedUntil.Sub(now); left > wait {
+			wait = left
+		}
+		if left := throttle.LastFailureAt.Add(backoff(throttle.Failures)).Sub(now); left > wait {
+			wait = left
+		}
+	}
+
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (s *LoginGuardService) fail(keys [][2]string, user models.User) error {
+	now := s.clock.Now()
+
+	for _, key := range keys {
+		throttle, err := s.repo.GetLoginThrottle(key[0], key[1])
+		if errors.Is(err, sql.ErrNoRows) {
+			throttle = models.LoginThrottle{Kind: key[0], Value: key[1]}
+		} else if err != nil {
+			return err
+		}
+
+		// Start over after a lockout has run out or a quiet period.
+		if (!throttle.LockedUntil.IsZero() && !throttle.Locked(now)) || now.Sub(throttle.LastFailureAt) > failureMemory {
+			throttle.Failures = 0
+			throttle.LockedUntil = time.Time{}
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+
+		locked := throttle.LockedUntil.IsZero() && throttle.Failures >= lockoutAfter[throttle.Kind]
+		if locked {
+			throttle.LockedUntil = now.Add(lockoutTime)
+		}
+
+		if err := s.repo.SaveLoginThrottle(throttle); err != nil {
+			return err
+		}
+
+		if locked && throttle.Kind == models.ThrottleAccount && user.ID != 0 {
+			if err := s.notifier.NotifyLockout(user, throttle.LockedUntil); err != nil {
+				log.Printf("notify lockout: %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Succeed forgets the failures of the account. Those of the address are
+// kept until they are old enough to be forgotten: anyone can sign in to an
+// account of their own, which mustn't let them guess on at others.
+func (s *LoginGuardService) Succeed(username string) error {
+	return s.repo.DeleteLoginThrottle(models.ThrottleAccount, accountKey(username))
+}
+
+// ForgetOldFailures deletes the throttles whose failures are old enough to
+// be forgotten, which the next failure would start over anyway.
+func (s *LoginGuardService) ForgetOldFailures() error {
+	return s.repo.DeleteStaleLoginThrottles(s.clock.Now().Add(-failureMemory))
+}
+
+func (s *LoginGuardService) Lockouts(user models.User) ([]models.LoginThrottle, error) {
+	if !CanManageLockouts(user) {
+		return nil, ErrForbidden
+	}
+	return s.repo.GetLockedThrottles(s.clock.Now())
+}
+
+func (s *LoginGuardService) Unlock(user models.User, kind, value string) error {
+	if !CanManageLockouts(user) {
+		return ErrForbidden
+	}
+
+	if _, err := s.repo.GetLoginThrottle(kind, value); errors.Is(err, sql.ErrNoRows) {
+		return ErrNoLockout
+	} else if err != nil {
+		return err
+	}
+	return s.repo.DeleteLoginThrottle(kind, value)
+}
+
+// backoff is how long to wait after the given number of failures in a
+// row: nothing for the first few, then doubling up to maxBackoff.
+func backoff(failures int) time.Duration {
+	if failures < freeFailures {
+		return 0
+	}
+	wait := backoffBase
+	for i := freeFailures; i < failures; i++ {
+		wait *= 2
+		if wait >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return wait
+}
+
+func throttleKeys(username, ip string) [][2]string {
+	keys := [][2]string{{models.ThrottleAccount, accountKey(username)}}
+	if ip != "" {
+		keys = append(keys, [2]string{models.ThrottleIP, ip})
+	}
+	return keys
+}
+
+// accountKey is the value the throttle of an account is kept under, the
+// same however the username is capitalized, like the email addresses of
+// limitMail.
+func accountKey(username string) string {
+	return strings.ToLower(username)
+}
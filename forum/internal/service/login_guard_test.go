@@ -0,0 +1,387 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+)
+
+// fakeClock is a Clock that only moves when stepped.
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Step(d time.Duration) { c.now = c.now.Add(d) }
+
+// fakeThrottles keeps login throttles in memory.
+type fakeThrottles struct {
+	throttles map[[2]string]models.LoginThrottle
+}
+
+func newFakeThrottles() *fakeThrottles {
+	return &fakeThrottles{throttles: make(map[[2]string]models.LoginThrottle)}
+}
+
+func (r *fakeThrottles) GetLoginThrottle(kind, value string) (models.LoginThrottle, error) {
+	throttle, ok := r.throttles[[2]string{kind, value}]
+	if !ok {
+		return models.LoginThrottle{}, sql.ErrNoRows
+	}
+	return throttle, nil
+}
+
+func (r *fakeThrottles) SaveLoginThrottle(throttle models.LoginThrottle) error {
+	r.throttles[[2]string{throttle.Kind, throttle.Value}] = throttle
+	return nil
+}
+
+func (r *fakeThrottles) DeleteLoginThrottle(kind, value string) error {
+	delete(r.throttles, [2]string{kind, value})
+	return nil
+}
+
+func (r *fakeThrottles) GetLockedThrottles(now time.Time) ([]models.LoginThrottle, error) {
+	var locked []models.LoginThrottle
+	for _, throttle := range r.throttles {
+		if throttle.Locked(now) {
+			locked = append(locked, throttle)
+		}
+	}
+	return locked, nil
+}
+
+func (r *fakeThrottles) DeleteStaleLoginThrottles(before time.Time) error {
+	for key, throttle := range r.throttles {
+		if throttle.LastFailureAt.Before(before) && throttle.LockedUntil.Before(before) {
+			delete(r.throttles, key)
+		}
+	}
+	return nil
+}
+
+// fakeNotifier records the lockout notices it is asked to send.
+type fakeNotifier struct {
+	notices []time.Time
+}
+
+func (n *fakeNotifier) NotifyLockout(user models.User, until time.Time) error {
+	n.notices = append(n.notices, until)
+	return nil
+}
+
+func newTestGuard() (*LoginGuardService, *fakeThrottles, *fakeClock, *fakeNotifier) {
+	repo, clock, notifier := newFakeThrottles(), newFakeClock(), &fakeNotifier{}
+	return NewLoginGuardService(repo, clock, notifier), repo, clock, notifier
+}
+
+// retryAfter returns how long Check makes the next attempt wait.
+func retryAfter(t *testing.T, guard *LoginGuardService, username, ip string) time.Duration {
+	t.Helper()
+	err := guard.Check(username, ip)
+	if err == nil {
+		return 0
+	}
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("Check: %v", err)
+	}
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("ThrottledError doesn't match ErrTooManyAttempts")
+	}
+	return throttled.RetryAfter
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{freeFailures - 1, 0},
+		{freeFailures, time.Second},
+		{freeFailures + 1, 2 * time.Second},
+		{freeFailures + 2, 4 * time.Second},
+		{freeFailures + 9, 512 * time.Second},
+		{freeFailures + 10, maxBackoff},
+		{1000, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	guard, _, clock, _ := newTestGuard()
+
+	for i := 1; i <= 6; i++ {
+		if err := guard.Fail("alice", "", models.User{}); err != nil {
+			t.Fatal(err)
+		}
+		want := backoff(i)
+		if got := retryAfter(t, guard, "alice", ""); got != want {
+			t.Fatalf("after %d failures: retry after %s, want %s", i, got, want)
+		}
+		clock.Step(want)
+		if got := retryAfter(t, guard, "alice", ""); got != 0 {
+			t.Fatalf("after %d failures and %s: retry after %s, want none", i, want, got)
+		}
+	}
+}
+
+func TestLoginGuardLocksAccount(t *testing.T) {
+	guard, repo, clock, _ := newTestGuard()
+	limit := lockoutAfter[models.ThrottleAccount]
+
+	for i := 1; i <= limit; i++ {
+		clock.Step(maxBackoff)
+		if err := guard.Fail("alice", "", models.User{}); err != nil {
+			t.Fatal(err)
+		}
+		throttle, _ := repo.GetLoginThrottle(models.ThrottleAccount, "alice")
+		if locked := throttle.Locked(clock.Now()); locked != (i == limit) {
+			t.Fatalf("after %d failures: locked = %v", i, locked)
+		}
+	}
+
+	clock.Step(maxBackoff)
+	if got, want := retryAfter(t, guard, "alice", ""), lockoutTime-maxBackoff; got != want {
+		t.Errorf("locked account: retry after %s, want %s", got, want)
+	}
+	if got := retryAfter(t, guard, "bob", ""); got != 0 {
+		t.Errorf("other account: retry after %s, want none", got)
+	}
+
+	clock.Step(lockoutTime - maxBackoff)
+	if got := retryAfter(t, guard, "alice", ""); got != 0 {
+		t.Errorf("after the lockout: retry after %s, want none", got)
+	}
+
+	// The count starts over once the lockout has run out.
+	if err := guard.Fail("alice", "", models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	if throttle, _ := repo.GetLoginThrottle(models.ThrottleAccount, "alice"); throttle.Failures != 1 || !throttle.LockedUntil.IsZero() {
+		t.Errorf("after the lockout: %+v, want 1 failure and no lockout", throttle)
+	}
+}
+
+func TestLoginGuardLocksAddress(t *testing.T) {
+	guard, repo, clock, _ := newTestGuard()
+	const ip = "192.0.2.1"
+	limit := lockoutAfter[models.ThrottleIP]
+
+	// Spread over accounts, the failures only add up for the address.
+	for i := 1; i <= limit; i++ {
+		clock.Step(maxBackoff)
+		if err := guard.Fail(fmt.Sprintf("user%d", i), ip, models.User{}); err != nil {
+			t.Fatal(err)
+		}
+		throttle, _ := repo.GetLoginThrottle(models.ThrottleIP, ip)
+		if locked := throttle.Locked(clock.Now()); locked != (i == limit) {
+			t.Fatalf("after %d failures: locked = %v", i, locked)
+		}
+	}
+
+	if got := retryAfter(t, guard, "newcomer", ip); got != lockoutTime {
+		t.Errorf("locked address: retry after %s, want %s", got, lockoutTime)
+	}
+	if got := retryAfter(t, guard, "newcomer", "192.0.2.2"); got != 0 {
+		t.Errorf("other address: retry after %s, want none", got)
+	}
+}
+
+func TestLoginGuardForgetsOldFailures(t *testing.T) {
+	guard, repo, clock, _ := newTestGuard()
+
+	for i := 0; i < 5; i++ {
+		if err := guard.Fail("alice", "", models.User{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock.Step(failureMemory)
+	if err := guard.Fail("alice", "", models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	if throttle, _ := repo.GetLoginThrottle(models.ThrottleAccount, "alice"); throttle.Failures != 6 {
+		t.Fatalf("within failureMemory: %d failures, want 6", throttle.Failures)
+	}
+
+	clock.Step(failureMemory + time.Second)
+	if err := guard.Fail("alice", "", models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	if throttle, _ := repo.GetLoginThrottle(models.ThrottleAccount, "alice"); throttle.Failures != 1 {
+		t.Errorf("after failureMemory: %d failures, want 1", throttle.Failures)
+	}
+}
+
+func TestLoginGuardSucceedClearsTheAccount(t *testing.T) {
+	guard, repo, _, _ := newTestGuard()
+	const ip = "192.0.2.1"
+
+	for i := 0; i < freeFailures+2; i++ {
+		if err := guard.Fail("alice", ip, models.User{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := retryAfter(t, guard, "alice", ""); got == 0 {
+		t.Fatal("failures didn't throttle")
+	}
+
+	if err := guard.Succeed("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetLoginThrottle(models.ThrottleAccount, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("account throttle left after Succeed: %v", err)
+	}
+	if got := retryAfter(t, guard, "alice", ""); got != 0 {
+		t.Errorf("after Succeed: retry after %s, want none", got)
+	}
+	if throttle, err := repo.GetLoginThrottle(models.ThrottleIP, ip); err != nil || throttle.Failures != freeFailures+2 {
+		t.Errorf("address throttle after Succeed: %+v, %v; want it kept", throttle, err)
+	}
+}
+
+// TestLoginGuardIgnoresUsernameCase fails and succeeds with the username
+// capitalized differently each time: it is the same account throttle.
+func TestLoginGuardIgnoresUsernameCase(t *testing.T) {
+	guard, repo, _, _ := newTestGuard()
+
+	for _, username := range []string{"alice", "Alice", "ALICE"} {
+		if err := guard.Fail(username, "", models.User{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if throttle, err := repo.GetLoginThrottle(models.ThrottleAccount, "alice"); err != nil || throttle.Failures != 3 {
+		t.Errorf("account throttle = %+v, %v; want 3 failures", throttle, err)
+	}
+
+	if err := guard.Succeed("aLiCe"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetLoginThrottle(models.ThrottleAccount, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("account throttle left after Succeed: %v", err)
+	}
+}
+
+// TestLoginGuardSprayWithOwnAccount guesses at other accounts from one
+// address, signing in to an account of the attacker's own in between.
+func TestLoginGuardSprayWithOwnAccount(t *testing.T) {
+	guard, repo, clock, _ := newTestGuard()
+	const ip = "192.0.2.1"
+	limit := lockoutAfter[models.ThrottleIP]
+
+	for i := 1; i <= limit; i++ {
+		clock.Step(maxBackoff)
+		if err := guard.Fail(fmt.Sprintf("user%d", i), ip, models.User{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.Succeed("mallory"); err != nil {
+			t.Fatal(err)
+		}
+		if i == freeFailures+1 {
+			if got := retryAfter(t, guard, "user0", ip); got != backoff(i) {
+				t.Fatalf("after %d guesses: retry after %s, want %s", i, got, backoff(i))
+			}
+		}
+	}
+
+	if throttle, _ := repo.GetLoginThrottle(models.ThrottleIP, ip); !throttle.Locked(clock.Now()) {
+		t.Fatalf("address isn't locked after %d guesses: %+v", limit, throttle)
+	}
+	if got := retryAfter(t, guard, "mallory", ip); got != lockoutTime {
+		t.Errorf("locked address: retry after %s, want %s", got, lockoutTime)
+	}
+}
+
+func TestLoginGuardNotifiesOncePerLockout(t *testing.T) {
+	guard, _, clock, notifier := newTestGuard()
+	user := models.User{ID: 1, Username: "alice", Email: "alice@example.com"}
+	limit := lockoutAfter[models.ThrottleAccount]
+
+	// Failures while locked out don't send the notice again.
+	for i := 0; i < limit+5; i++ {
+		if err := guard.Fail(user.Username, "", user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.notices) != 1 {
+		t.Fatalf("%d notices for one lockout, want 1", len(notifier.notices))
+	}
+	if want := clock.Now().Add(lockoutTime); !notifier.notices[0].Equal(want) {
+		t.Errorf("notice says locked until %s, want %s", notifier.notices[0], want)
+	}
+
+	clock.Step(lockoutTime)
+	for i := 0; i < limit; i++ {
+		if err := guard.Fail(user.Username, "", user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.notices) != 2 {
+		t.Errorf("%d notices for two lockouts, want 2", len(notifier.notices))
+	}
+
+	// Unknown usernames are locked out without anyone to tell.
+	for i := 0; i < limit; i++ {
+		if err := guard.Fail("nobody", "", models.User{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.notices) != 2 {
+		t.Errorf("an unknown account was notified")
+	}
+}
+
+func TestLoginGuardLimitsResets(t *testing.T) {
+	guard, repo, clock, _ := newTestGuard()
+	const ip = "192.0.2.1"
+
+	// A few requests go through, then each has to wait longer.
+	for i := 1; i <= freeFailures; i++ {
+		if err := guard.LimitReset("alice@example.com", ip); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	err := guard.LimitReset("Alice@example.com", "192.0.2.2")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter != backoff(freeFailures) {
+		t.Fatalf("request %d: %v, want to wait %s", freeFailures+1, err, backoff(freeFailures))
+	}
+
+	// Refused requests aren't counted.
+	if throttle, _ := repo.GetLoginThrottle(models.ThrottleResetEmail, "alice@example.com"); throttle.Failures != freeFailures {
+		t.Errorf("%d requests counted, want %d", throttle.Failures, freeFailures)
+	}
+	clock.Step(backoff(freeFailures))
+	if err := guard.LimitReset("alice@example.com", "192.0.2.2"); err != nil {
+		t.Errorf("after waiting: %v", err)
+	}
+
+	// Resets are counted apart from sign ins.
+	if got := retryAfter(t, guard, "alice", ip); got != 0 {
+		t.Errorf("sign in after reset requests: retry after %s, want none", got)
+	}
+
+	// Requests for other email addresses add up for the client.
+	if err := guard.LimitReset("bob@example.com", ip); err != nil {
+		t.Fatalf("request for bob: %v", err)
+	}
+	if err := guard.LimitReset("carol@example.com", ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("request from a busy address: %v, want %v", err, ErrTooManyAttempts)
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/oidc"
+	"forum/internal/repository"
+)
+
+type OIDC interface {
+	// OIDCProvider names the provider users can sign in with, or is empty
+	// when single sign-on is off.
+	OIDCProvider() string
+	// BeginOIDCSignIn starts a sign in at the provider. It returns the
+	// state that names it and the address to send the browser to; the
+	// provider sends it back to Authorization.SignInWithOIDC.
+	BeginOIDCSignIn(remember bool) (state, authURL string, err error)
+}
+
+var (
+	ErrOIDCDisabled     = errors.New("single sign-on is not set up")
+	ErrInvalidOIDCLogin = errors.New("the sign in expired or was refused, try again")
+	ErrOIDCUnavailable  = errors.New("the identity provider can't be reached, try again later")
+	ErrOIDCNoEmail      = errors.New("the identity provider didn't share your email address")
+	ErrOIDCEmailTaken   = errors.New("an account already uses this email address, sign in with its password")
+)
+
+const (
+	// oidcLoginTime is how long the user has to sign in at the provider.
+	oidcLoginTime = time.Minute * 10
+	maxUsername   = 32
+)
+
+type OIDCService struct {
+	repo     repository.OIDC
+	users    repository.Authorization
+	provider *oidc.Provider
+	name     string
+	clock    Clock
+}
+
+// NewOIDCService creates the service; with a nil provider single sign-on
+// is off. name is shown on the sign in button.
+func NewOIDCService(repo repository.OIDC, users repository.Authorization, provider *oidc.Provider, name string, clock Clock) *OIDCService {
+	return &OIDCService{
+		repo:     repo,
+		users:    users,
+		provider: provider,
+		name:     name,
+		clock:    clock,
+	}
+}
+
+func (s *OIDCService) OIDCProvider() string {
+	if s.provider == nil {
+		return ""
+	}
+	return s.name
+}
+
+func (s *OIDCService) BeginOIDCSignIn(remember bool) (string, string, error) {
+	if s.provider == nil {
+		return "", "", ErrOIDCDisabled
+	}
+
+	login := models.OIDCLogin{
+		Persistent: remember,
+		ExpiresAt:  s.clock.Now().Add(oidcLoginTime),
+	}
+	for _, v := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		var err error
+		if *v, err = oidc.RandomString(); err != nil {
+			return "", "", fmt.Errorf("oidc -> error generating state: %s", err)
+		}
+	}
+
+	authURL, err := s.provider.AuthCodeURL(login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		log.Printf("oidc sign in: %s", err)
+		return "", "", ErrOIDCUnavailable
+	}
+
+	if err := s.repo.CreateOIDCLogin(login); err != nil {
+		return "", "", err
+	}
+	return login.State, authURL, nil
+}
+
+// identify finishes a sign in at the provider and returns the user it
+// stands for, linked by their verified email address or created on their
+// first sign in. It reports whether the user was just created and whether
+// the session should be remembered.
+func (s *OIDCService) identify(state, code string) (models.User, bool, bool, error) {
+	if s.provider == nil {
+		return models.User{}, false, false, ErrOIDCDisabled
+	}
+
+	login, err := s.repo.TakeOIDCLogin(state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, false, false, ErrInvalidOIDCLogin
+	} else if err != nil {
+		return models.User{}, false, false, err
+	}
+	if !s.clock.Now().Before(login.ExpiresAt) {
+		return models.User{}, false, false, ErrInvalidOIDCLogin
+	}
+
+	claims, err := s.provider.Exchange(code, login.Verifier, login.Nonce)
+	if errors.Is(err, oidc.ErrUnavailable) {
+		log.Printf("oidc sign in: %s", err)
+		return models.User{}, false, false, ErrOIDCUnavailable
+	} else if err != nil {
+		log.Printf("oidc sign in: %s", err)
+		return models.User{}, false, false, ErrInvalidOIDCLogin
+	}
+
+	user, created, err := s.findUser(claims)
+	return user, created, login.Persistent, err
+}
+
+func (s *OIDCService) findUser(claims oidc.Claims) (models.User, bool, error) {
+	identity, err := s.repo.GetOIDCIdentity(claims.Issuer, claims.Subject)
+	if err == nil {
+		user, err := s.users.GetUserByID(identity.UserID)
+		return user, false, err
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, false, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return models.User{}, false, ErrOIDCNoEmail
+	}
+
+	now := s.clock.Now()
+	identity = models.OIDCIdentity{
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		CreatedAt: now,
+	}
+
+	user, err := s.users.GetUser("", email)
+	if err == nil {
+		// Only an address both sides verified proves that the account
+		// and the identity belong to the same person.
+		if !bool(claims.EmailVerified) || !user.EmailVerified {
+			return models.User{}, false, ErrOIDCEmailTaken
+		}
+		identity.UserID = user.ID
+		return user, false, s.repo.CreateOIDCIdentity(identity)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, false, err
+	}
+
+	user, err = s.newUser(claims, email)
+	if err != nil {
+		return models.User{}, false, err
+	}
+	if user.ID, err = s.repo.CreateOIDCUser(user, identity); err != nil {
+		return models.User{}, false, err
+	}
+	return user, true, nil
+}
+
+// newUser fills in a user for an identity signing in for the first time.
+// Their password is random: they can set one by resetting it.
+func (s *OIDCService) newUser(claims oidc.Claims, email string) (models.User, error) {
+	username, err := s.freeUsername(claims, email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	password, err := generatePasswordHash(token)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	now := s.clock.Now()
+	return models.User{
+		Username:      username,
+		Email:         email,
+		Password:      password,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		EmailVerified: bool(claims.EmailVerified),
+	}, nil
+}
+
+// freeUsername picks a username from the claims, numbered when it's
+// taken.
+func (s *OIDCService) freeUsername(claims oidc.Claims, email string) (string, error) {
+	base := cleanUsername(claims.PreferredUsername)
+	if base == "" {
+		base = cleanUsername(email[:strings.IndexByte(email+"@", '@')])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			suffix := strconv.Itoa(i)
+			if len(username)+len(suffix) > maxUsername {
+				username = username[:maxUsername-len(suffix)]
+			}
+			username += suffix
+		}
+
+		_, err := s.users.GetUser(username, "")
+		if errors.Is(err, sql.ErrNoRows) {
+			return username, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return "", ErrUsernameTaken
+}
+
+// cleanUsername keeps the characters of name a username may have.
+func cleanUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case r == ' ':
+			b.WriteByte('_')
+		case r > 32 && r < 127:
+			b.WriteRune(r)
+		}
+		if b.Len() == maxUsername {
+			break
+		}
+	}
+	return b.String()
+}
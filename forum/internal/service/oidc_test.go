@@ -0,0 +1,552 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/oidc"
+	"forum/internal/repository"
+)
+
+// fakeUsers keeps users and sessions in memory. It has the methods the
+// tests reach; the others panic.
+type fakeUsers struct {
+	repository.Authorization
+	users    map[int]models.User
+	sessions []models.Session
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{users: make(map[int]models.User)}
+}
+
+func (r *fakeUsers) add(user models.User) models.User {
+	user.ID = len(r.users) + 1
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	r.users[user.ID] = user
+	return user
+}
+
+func (r *fakeUsers) CreateUser(user models.User) (int, error) {
+	user.EmailVerified = false
+	return r.add(user).ID, nil
+}
+
+func (r *fakeUsers) GetUser(username, email string) (models.User, error) {
+	for _, user := range r.users {
+		if user.Username == username || user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (r *fakeUsers) GetUserByID(ID int) (models.User, error) {
+	user, ok := r.users[ID]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r *fakeUsers) CreateSession(session models.Session) (int, error) {
+	r.sessions = append(r.sessions, session)
+	return len(r.sessions), nil
+}
+
+// fakeOIDC keeps sign ins and identities in memory, creating users in
+// users.
+type fakeOIDC struct {
+	users      *fakeUsers
+	logins     map[string]models.OIDCLogin
+	identities []models.OIDCIdentity
+}
+
+func (r *fakeOIDC) CreateOIDCLogin(login models.OIDCLogin) error {
+	r.logins[login.State] = login
+	return nil
+}
+
+func (r *fakeOIDC) TakeOIDCLogin(state string) (models.OIDCLogin, error) {
+	login, ok := r.logins[state]
+	if !ok {
+		return models.OIDCLogin{}, sql.ErrNoRows
+	}
+	delete(r.logins, state)
+	return login, nil
+}
+
+func (r *fakeOIDC) DeleteExpiredOIDCLogins(now time.Time) error {
+	return nil
+}
+
+func (r *fakeOIDC) GetOIDCIdentity(issuer, subject string) (models.OIDCIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return models.OIDCIdentity{}, sql.ErrNoRows
+}
+
+func (r *fakeOIDC) CreateOIDCIdentity(identity models.OIDCIdentity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeOIDC) CreateOIDCUser(user models.User, identity models.OIDCIdentity) (int, error) {
+	user = r.users.add(user)
+	identity.UserID = user.ID
+	return user.ID, r.CreateOIDCIdentity(identity)
+}
+
+// fakeMailer records the messages it is asked to send.
+type fakeMailer struct {
+	sent []mail.Message
+}
+
+func (m *fakeMailer) Send(msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+const (
+	stubClientID     = "forum"
+	stubClientSecret = "s3cret"
+	stubRedirectURL  = "http://forum.test/sign-in/oidc/callback"
+)
+
+// stubProvider is an OpenID provider serving discovery, its key set and
+// a token endpoint. The sign in page is skipped: authorize hands out a
+// code for the ID token the test describes.
+type stubProvider struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]stubGrant
+}
+
+// stubGrant is what the provider issues for a code.
+type stubGrant struct {
+	// challenge is the PKCE code challenge the code was asked with.
+	challenge string
+	claims    map[string]interface{}
+	alg       string
+	// key signs the ID token; it defaults to the published key for alg.
+	key crypto.Signer
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &stubProvider{rsaKey: rsaKey, ecKey: ecKey, grants: make(map[string]stubGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(rsaKey.E)).Bytes()
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(e)},
+			{"kty": "EC", "kid": "ec", "use": "sig", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize plays the provider's sign in page for the address
+// BeginOIDCSignIn returned, and returns the code it sends back. edit may
+// change the grant before it is issued.
+func (p *stubProvider) authorize(t *testing.T, authURL string, edit func(g *stubGrant)) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(authURL, p.URL+"/authorize?") || q.Get("client_id") != stubClientID || q.Get("redirect_uri") != stubRedirectURL ||
+		q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		t.Fatalf("bad authorization request %s", authURL)
+	}
+
+	now := time.Now()
+	grant := stubGrant{
+		challenge: q.Get("code_challenge"),
+		alg:       "RS256",
+		claims: map[string]interface{}{
+			"iss":                p.URL,
+			"aud":                stubClientID,
+			"sub":                "subject-1",
+			"nonce":              q.Get("nonce"),
+			"email":              "alice@example.com",
+			"email_verified":     true,
+			"preferred_username": "alice",
+			"iat":                now.Unix(),
+			"exp":                now.Add(5 * time.Minute).Unix(),
+		},
+	}
+	if edit != nil {
+		edit(&grant)
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.grants[code] = grant
+	p.mu.Unlock()
+	return code
+}
+
+func (p *stubProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if r.Method != http.MethodPost || id != stubClientID || secret != stubClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	grant, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != stubRedirectURL ||
+		b64(challenge[:]) != grant.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]string{"id_token": p.sign(grant), "token_type": "Bearer"})
+}
+
+// sign makes the ID token of a grant.
+func (p *stubProvider) sign(grant stubGrant) string {
+	kid, key := "rsa", grant.key
+	if grant.alg == "ES256" {
+		kid = "ec"
+		if key == nil {
+			key = p.ecKey
+		}
+	} else if key == nil {
+		key = p.rsaKey
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": grant.alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(grant.claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(signature)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type oidcTest struct {
+	auth     *AuthService
+	sso      *OIDCService
+	users    *fakeUsers
+	repo     *fakeOIDC
+	provider *stubProvider
+	clock    *fakeClock
+	mailer   *fakeMailer
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	tt := &oidcTest{
+		users:    newFakeUsers(),
+		provider: newStubProvider(t),
+		clock:    newFakeClock(),
+		mailer:   &fakeMailer{},
+	}
+	tt.repo = &fakeOIDC{users: tt.users, logins: make(map[string]models.OIDCLogin)}
+	provider := oidc.NewProvider(tt.provider.URL, stubClientID, stubClientSecret, stubRedirectURL)
+	tt.sso = NewOIDCService(tt.repo, tt.users, provider, "Stub", tt.clock)
+	verifier := NewEmailVerificationService(tt.users, nil, tt.mailer, []byte("secret"), "http://forum.test")
+	tt.auth = NewAuthService(tt.users, nil, verifier, nil, nil, tt.sso)
+	return tt
+}
+
+// signIn runs a whole sign in at the provider. edit may change what the
+// provider issues.
+func (tt *oidcTest) signIn(t *testing.T, remember bool, edit func(g *stubGrant)) (models.Session, error) {
+	t.Helper()
+
+	state, authURL, err := tt.sso.BeginOIDCSignIn(remember)
+	if err != nil {
+		t.Fatalf("BeginOIDCSignIn: %v", err)
+	}
+	code := tt.provider.authorize(t, authURL, edit)
+	return tt.auth.SignInWithOIDC(state, code, models.SignInRequest{UserAgent: "test", IP: "192.0.2.1"})
+}
+
+func TestOIDCSignInCreatesUser(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	session, err := tt.signIn(t, true, nil)
+	if err != nil {
+		t.Fatalf("SignInWithOIDC: %v", err)
+	}
+	user, err := tt.users.GetUserByID(session.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || !user.EmailVerified {
+		t.Errorf("created user %+v", user)
+	}
+	if !session.Persistent || session.Token == "" {
+		t.Errorf("session %+v, want a persistent one", session)
+	}
+	if len(tt.mailer.sent) != 0 {
+		t.Errorf("mailed a confirmation link for a verified address")
+	}
+
+	// The identity finds the user again, whatever the email now is.
+	again, err := tt.signIn(t, false, func(g *stubGrant) {
+		g.claims["email"] = "new@example.com"
+	})
+	if err != nil {
+		t.Fatalf("second SignInWithOIDC: %v", err)
+	}
+	if again.UserID != user.ID || again.Persistent {
+		t.Errorf("second sign in: session %+v, want a session of user %d", again, user.ID)
+	}
+	if len(tt.users.users) != 1 {
+		t.Errorf("%d users, want 1", len(tt.users.users))
+	}
+}
+
+// TestOIDCSignInStringVerified signs in with a provider sending
+// email_verified as a string.
+func TestOIDCSignInStringVerified(t *testing.T) {
+	for _, verified := range []string{"true", "false"} {
+		t.Run(verified, func(t *testing.T) {
+			tt := newOIDCTest(t)
+			session, err := tt.signIn(t, false, func(g *stubGrant) {
+				g.claims["email_verified"] = verified
+			})
+			if err != nil {
+				t.Fatalf("SignInWithOIDC: %v", err)
+			}
+			user, _ := tt.users.GetUserByID(session.UserID)
+			if want := verified == "true"; user.EmailVerified != want {
+				t.Errorf("created user %+v, want EmailVerified %t", user, want)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInWithECKey(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	if _, err := tt.signIn(t, false, func(g *stubGrant) { g.alg = "ES256" }); err != nil {
+		t.Fatalf("SignInWithOIDC: %v", err)
+	}
+}
+
+func TestOIDCSignInNewUnverifiedUser(t *testing.T) {
+	tt := newOIDCTest(t)
+	tt.users.add(models.User{Username: "alice", Email: "other@example.com"})
+
+	session, err := tt.signIn(t, false, func(g *stubGrant) {
+		g.claims["email"] = "Alice@Example.com"
+		g.claims["email_verified"] = false
+	})
+	if err != nil {
+		t.Fatalf("SignInWithOIDC: %v", err)
+	}
+	user, _ := tt.users.GetUserByID(session.UserID)
+	if user.Username != "alice2" || user.Email != "alice@example.com" || user.EmailVerified {
+		t.Errorf("created user %+v, want unverified alice2", user)
+	}
+	if len(tt.mailer.sent) != 1 || tt.mailer.sent[0].To != user.Email {
+		t.Errorf("sent %+v, want a confirmation link to %s", tt.mailer.sent, user.Email)
+	}
+}
+
+func TestOIDCSignInLinksVerifiedEmail(t *testing.T) {
+	tt := newOIDCTest(t)
+	existing := tt.users.add(models.User{Username: "alice_local", Email: "alice@example.com", EmailVerified: true})
+
+	session, err := tt.signIn(t, false, nil)
+	if err != nil {
+		t.Fatalf("SignInWithOIDC: %v", err)
+	}
+	if session.UserID != existing.ID {
+		t.Errorf("signed in user %d, want the existing user %d", session.UserID, existing.ID)
+	}
+	if len(tt.repo.identities) != 1 || tt.repo.identities[0].UserID != existing.ID || tt.repo.identities[0].Subject != "subject-1" {
+		t.Errorf("identities %+v, want one linked to user %d", tt.repo.identities, existing.ID)
+	}
+}
+
+func TestOIDCSignInRefusesUnverifiedEmail(t *testing.T) {
+	tests := map[string]struct {
+		localVerified    bool
+		providerVerified bool
+	}{
+		"unverified at the provider": {localVerified: true, providerVerified: false},
+		"unverified on the forum":    {localVerified: false, providerVerified: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt := newOIDCTest(t)
+			tt.users.add(models.User{Username: "alice_local", Email: "alice@example.com", EmailVerified: test.localVerified})
+
+			_, err := tt.signIn(t, false, func(g *stubGrant) {
+				g.claims["email_verified"] = test.providerVerified
+			})
+			if !errors.Is(err, ErrOIDCEmailTaken) {
+				t.Errorf("SignInWithOIDC: %v, want %v", err, ErrOIDCEmailTaken)
+			}
+			if len(tt.repo.identities) != 0 || len(tt.users.sessions) != 0 {
+				t.Errorf("refused sign in left identities %+v and sessions %+v", tt.repo.identities, tt.users.sessions)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInRejects(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]func(tt *oidcTest, g *stubGrant){
+		"bad signature": func(tt *oidcTest, g *stubGrant) {
+			g.key = otherKey
+		},
+		"RSA key used for ES256": func(tt *oidcTest, g *stubGrant) {
+			g.alg, g.key = "ES256", tt.provider.rsaKey
+		},
+		"wrong audience": func(tt *oidcTest, g *stubGrant) {
+			g.claims["aud"] = "someone-else"
+		},
+		"wrong authorized party": func(tt *oidcTest, g *stubGrant) {
+			g.claims["aud"] = []string{stubClientID, "someone-else"}
+			g.claims["azp"] = "someone-else"
+		},
+		"wrong issuer": func(tt *oidcTest, g *stubGrant) {
+			g.claims["iss"] = "https://evil.example.com"
+		},
+		"expired token": func(tt *oidcTest, g *stubGrant) {
+			g.claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+		},
+		"nonce mismatch": func(tt *oidcTest, g *stubGrant) {
+			g.claims["nonce"] = "replayed-nonce"
+		},
+		"PKCE verifier mismatch": func(tt *oidcTest, g *stubGrant) {
+			g.challenge = b64(make([]byte, 32))
+		},
+		"expired sign in": func(tt *oidcTest, g *stubGrant) {
+			tt.clock.Step(oidcLoginTime)
+		},
+	}
+	for name, edit := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt := newOIDCTest(t)
+
+			_, err := tt.signIn(t, false, func(g *stubGrant) { edit(tt, g) })
+			if !errors.Is(err, ErrInvalidOIDCLogin) {
+				t.Errorf("SignInWithOIDC: %v, want %v", err, ErrInvalidOIDCLogin)
+			}
+			if len(tt.users.users) != 0 || len(tt.users.sessions) != 0 {
+				t.Errorf("rejected sign in created users %+v and sessions %+v", tt.users.users, tt.users.sessions)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInStateIsUsedOnce(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	state, authURL, err := tt.sso.BeginOIDCSignIn(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := tt.provider.authorize(t, authURL, nil)
+	if _, err := tt.auth.SignInWithOIDC(state, code, models.SignInRequest{}); err != nil {
+		t.Fatalf("SignInWithOIDC: %v", err)
+	}
+	if _, err := tt.auth.SignInWithOIDC(state, code, models.SignInRequest{}); !errors.Is(err, ErrInvalidOIDCLogin) {
+		t.Errorf("replayed callback: %v, want %v", err, ErrInvalidOIDCLogin)
+	}
+	if _, err := tt.auth.SignInWithOIDC("unknown", code, models.SignInRequest{}); !errors.Is(err, ErrInvalidOIDCLogin) {
+		t.Errorf("unknown state: %v, want %v", err, ErrInvalidOIDCLogin)
+	}
+}
+
+func TestOIDCProviderDown(t *testing.T) {
+	tt := newOIDCTest(t)
+	tt.provider.Close()
+
+	if _, _, err := tt.sso.BeginOIDCSignIn(false); !errors.Is(err, ErrOIDCUnavailable) {
+		t.Errorf("BeginOIDCSignIn: %v, want %v", err, ErrOIDCUnavailable)
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	sso := NewOIDCService(&fakeOIDC{}, newFakeUsers(), nil, "", newFakeClock())
+
+	if name := sso.OIDCProvider(); name != "" {
+		t.Errorf("OIDCProvider() = %q, want none", name)
+	}
+	if _, _, err := sso.BeginOIDCSignIn(false); !errors.Is(err, ErrOIDCDisabled) {
+		t.Errorf("BeginOIDCSignIn: %v, want %v", err, ErrOIDCDisabled)
+	}
+}
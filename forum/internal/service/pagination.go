@@ -0,0 +1,69 @@
+package service
+
+import (
+	"time"
+
+	"forum/internal/models"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// paginate loads one page of posts through fetch, asking for an extra post
+// to learn whether there is another page beyond it.
+func paginate(page models.Page, fetch func(page models.Page) ([]models.Post, error)) ([]models.Post, models.Pagination, error) {
+	if page.Limit <= 0 {
+		page.Limit = defaultPageSize
+	} else if page.Limit > maxPageSize {
+		page.Limit = maxPageSize
+	}
+
+	page.Since = page.Window.Start(time.Now())
+
+	size := page.Limit
+	page.Limit++
+
+	posts, err := fetch(page)
+	if err != nil {
+		return nil, models.Pagination{}, err
+	}
+
+	more := len(posts) > size
+	if more {
+		if !page.Before.IsZero() {
+			posts = posts[1:]
+		} else {
+			posts = posts[:size]
+		}
+	}
+
+	var pagination models.Pagination
+	if len(posts) == 0 {
+		return posts, pagination, nil
+	}
+
+	cursor := func(post models.Post) string {
+		return models.Cursor{ID: post.ID, Score: post.Score}.Format(page.Sort)
+	}
+	first, last := cursor(posts[0]), cursor(posts[len(posts)-1])
+	switch {
+	case !page.Before.IsZero():
+		pagination.Next = last
+		if more {
+			pagination.Prev = first
+		}
+	case !page.After.IsZero():
+		pagination.Prev = first
+		if more {
+			pagination.Next = last
+		}
+	default:
+		if more {
+			pagination.Next = last
+		}
+	}
+
+	return posts, pagination, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+	"forum/internal/webauthn"
+)
+
+type Passkey interface {
+	Passkeys(userID int) ([]models.Passkey, error)
+	// BeginPasskeyRegistration returns the options the browser creates a
+	// passkey for the user with, once they entered their password again.
+	// Wrong passwords count as failed sign ins of the account from ip.
+	BeginPasskeyRegistration(user models.User, password, ip string) (map[string]interface{}, error)
+	FinishPasskeyRegistration(user models.User, name string, resp models.PasskeyAttestation) (models.Passkey, error)
+	DeletePasskey(ID, userID int) error
+	// BeginPasskeySignIn returns the options the browser signs in with a
+	// passkey with, answered by Authorization.SignInWithPasskey.
+	BeginPasskeySignIn() (map[string]interface{}, error)
+}
+
+var (
+	ErrNoPasskey          = errors.New("passkey is not found")
+	ErrInvalidPasskey     = errors.New("the passkey couldn't be verified, try again")
+	ErrInvalidPasskeyName = errors.New("passkey name must be at most 64 characters long")
+)
+
+const (
+	maxPasskeyName = 64
+	// ceremonyTime is how long the browser has to answer a challenge.
+	ceremonyTime = time.Minute * 5
+)
+
+type PasskeyService struct {
+	repo  repository.Passkey
+	users repository.Authorization
+	guard *LoginGuardService
+	rp    webauthn.RelyingParty
+	clock Clock
+}
+
+func NewPasskeyService(repo repository.Passkey, users repository.Authorization, guard *LoginGuardService, rp webauthn.RelyingParty, clock Clock) *PasskeyService {
+	return &PasskeyService{
+		repo:  repo,
+		users: users,
+		guard: guard,
+		rp:    rp,
+		clock: clock,
+	}
+}
+
+func (s *PasskeyService) Passkeys(userID int) ([]models.Passkey, error) {
+	return s.repo.GetPasskeys(userID)
+}
+
+func (s *PasskeyService) BeginPasskeyRegistration(user models.User, password, ip string) (map[string]interface{}, error) {
+	// A passkey signs in without the password, so only the one who knows
+	// it may add one, not whoever got hold of the session.
+	if err := confirmPassword(s.users, s.guard, user, password, ip); err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.newChallenge(user.ID, models.CeremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.repo.GetPasskeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Listing the passkeys of the user keeps an authenticator from
+	// registering twice.
+	var exclude [][]byte
+	for _, passkey := range passkeys {
+		if id, err := webauthn.Encoding.DecodeString(passkey.CredentialID); err == nil {
+			exclude = append(exclude, id)
+		}
+	}
+
+	return s.rp.CreationOptions(challenge, userHandle(user.ID), user.Username, exclude), nil
+}
+
+func (s *PasskeyService) FinishPasskeyRegistration(user models.User, name string, resp models.PasskeyAttestation) (models.Passkey, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxPasskeyName {
+		return models.Passkey{}, ErrInvalidPasskeyName
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+
+	clientDataJSON, err1 := webauthn.Encoding.DecodeString(resp.ClientDataJSON)
+	attestationObject, err2 := webauthn.Encoding.DecodeString(resp.AttestationObject)
+	if err1 != nil || err2 != nil {
+		return models.Passkey{}, ErrInvalidPasskey
+	}
+
+	challenge, err := s.takeChallenge(clientDataJSON, user.ID, models.CeremonyRegister)
+	if err != nil {
+		return models.Passkey{}, err
+	}
+
+	cred, err := s.rp.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		log.Printf("passkey registration of user %d: %v", user.ID, err)
+		return models.Passkey{}, ErrInvalidPasskey
+	}
+
+	passkey := models.Passkey{
+		UserID:       user.ID,
+		CredentialID: webauthn.Encoding.EncodeToString(cred.ID),
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		Name:         name,
+		CreatedAt:    s.clock.Now(),
+	}
+	if passkey.ID, err = s.repo.CreatePasskey(passkey); err != nil {
+		return models.Passkey{}, err
+	}
+	return passkey, nil
+}
+
+func (s *PasskeyService) DeletePasskey(ID, userID int) error {
+	ok, err := s.repo.DeletePasskey(ID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoPasskey
+	}
+	return nil
+}
+
+func (s *PasskeyService) BeginPasskeySignIn() (map[string]interface{}, error) {
+	challenge, err := s.newChallenge(0, models.CeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+	return s.rp.RequestOptions(challenge), nil
+}
+
+// verifyAssertion checks a passkey sign in and returns the passkey used.
+func (s *PasskeyService) verifyAssertion(resp models.PasskeyAssertion) (models.Passkey, error) {
+	clientDataJSON, err1 := webauthn.Encoding.DecodeString(resp.ClientDataJSON)
+	authData, err2 := webauthn.Encoding.DecodeString(resp.AuthenticatorData)
+	signature, err3 := webauthn.Encoding.DecodeString(resp.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return models.Passkey{}, ErrInvalidPasskey
+	}
+
+	challenge, err := s.takeChallenge(clientDataJSON, 0, models.CeremonyLogin)
+	if err != nil {
+		return models.Passkey{}, err
+	}
+
+	passkey, err := s.repo.GetPasskeyByCredentialID(resp.CredentialID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return passkey, ErrInvalidPasskey
+	} else if err != nil {
+		return passkey, err
+	}
+
+	id, _ := webauthn.Encoding.DecodeString(passkey.CredentialID)
+	cred := webauthn.Credential{ID: id, PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	count, err := s.rp.VerifyAssertion(challenge, cred, clientDataJSON, authData, signature)
+	if err != nil {
+		log.Printf("passkey %d assertion: %v", passkey.ID, err)
+		return passkey, ErrInvalidPasskey
+	}
+
+	if err := s.repo.UsePasskey(passkey.ID, count, s.clock.Now()); err != nil {
+		return passkey, err
+	}
+	return passkey, nil
+}
+
+func (s *PasskeyService) newChallenge(userID int, kind string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", fmt.Errorf("passkey -> error generating challenge: %s", err)
+	}
+
+	err = s.repo.CreateWebAuthnChallenge(models.WebAuthnChallenge{
+		Challenge: challenge,
+		UserID:    userID,
+		Kind:      kind,
+		ExpiresAt: s.clock.Now().Add(ceremonyTime),
+	})
+	return challenge, err
+}
+
+// takeChallenge uses up the challenge the client data answers, provided
+// it was issued for this ceremony and user and hasn't expired.
+func (s *PasskeyService) takeChallenge(clientDataJSON []byte, userID int, kind string) (string, error) {
+	challenge, err := webauthn.ClientChallenge(clientDataJSON)
+	if err != nil {
+		return "", ErrInvalidPasskey
+	}
+
+	c, err := s.repo.TakeWebAuthnChallenge(challenge)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidPasskey
+	} else if err != nil {
+		return "", err
+	}
+	if c.Kind != kind || c.UserID != userID || !s.clock.Now().Before(c.ExpiresAt) {
+		return "", ErrInvalidPasskey
+	}
+	return c.Challenge, nil
+}
+
+// userHandle identifies the user to authenticators.
+func userHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+	"forum/internal/webauthn"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// challengeRecorder is a passkey repository without passkeys that keeps
+// the challenges it is given.
+type challengeRecorder struct {
+	repository.Passkey
+	challenges []models.WebAuthnChallenge
+}
+
+func (r *challengeRecorder) GetPasskeys(userID int) ([]models.Passkey, error) {
+	return nil, nil
+}
+
+func (r *challengeRecorder) CreateWebAuthnChallenge(challenge models.WebAuthnChallenge) error {
+	r.challenges = append(r.challenges, challenge)
+	return nil
+}
+
+func TestBeginPasskeyRegistrationNeedsPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: 1, Username: "alice", Password: string(hash)}
+	repo := &challengeRecorder{}
+	guard, _, clock, _ := newTestGuard()
+	rp := webauthn.RelyingParty{ID: "forum.example.com", Name: "Forum", Origin: "https://forum.example.com"}
+	s := NewPasskeyService(repo, &oneUser{user: user}, guard, rp, clock)
+	const ip = "192.0.2.1"
+
+	for i := 0; i < freeFailures; i++ {
+		if _, err := s.BeginPasskeyRegistration(user, "guess", ip); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("guess %d: %v, want %v", i+1, err, ErrWrongPassword)
+		}
+	}
+	if _, err := s.BeginPasskeyRegistration(user, "Passw0rd!", ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("after %d guesses: %v, want %v", freeFailures, err, ErrTooManyAttempts)
+	}
+	if len(repo.challenges) != 0 {
+		t.Fatalf("%d registrations begun without the password", len(repo.challenges))
+	}
+
+	clock.Step(backoff(freeFailures))
+	if _, err := s.BeginPasskeyRegistration(user, "Passw0rd!", ip); err != nil {
+		t.Fatalf("right password after waiting: %v", err)
+	}
+	if len(repo.challenges) != 1 || repo.challenges[0].UserID != user.ID || repo.challenges[0].Kind != models.CeremonyRegister {
+		t.Errorf("challenges = %+v, want one registration of user %d", repo.challenges, user.ID)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type PasswordReset interface {
+	// RequestPasswordReset mails a reset link to the account with the
+	// email address. It succeeds whether or not there is one, so that it
+	// can't be used to find out which addresses have accounts, but
+	// requests for an address or from ip too often are throttled.
+	RequestPasswordReset(email, ip string) error
+	// CheckPasswordReset tells whether the token of a link is still usable.
+	CheckPasswordReset(token string) error
+	// ResetPassword sets a new password with the token of a link, signs
+	// the user out everywhere and revokes their API tokens.
+	ResetPassword(token, password, confirm string) error
+}
+
+var (
+	ErrInvalidResetLink = errors.New("password reset link is invalid or has expired")
+	ErrPasswordMismatch = errors.New("passwords don't match")
+)
+
+// resetTime is how long a password reset link can be used.
+const resetTime = time.Hour
+
+type PasswordResetService struct {
+	repo    repository.PasswordReset
+	users   repository.Authorization
+	guard   *LoginGuardService
+	mailer  mail.Mailer
+	baseURL string
+}
+
+func NewPasswordResetService(repo repository.PasswordReset, users repository.Authorization, guard *LoginGuardService, mailer mail.Mailer, baseURL string) *PasswordResetService {
+	return &PasswordResetService{
+		repo:    repo,
+		users:   users,
+		guard:   guard,
+		mailer:  mailer,
+		baseURL: baseURL,
+	}
+}
+
+func (s *PasswordResetService) RequestPasswordReset(email, ip string) error {
+	if email == "" {
+		return ErrInvalidEmail
+	}
+
+	if err := s.guard.LimitReset(email, ip); err != nil {
+		return err
+	}
+
+	// The account is looked up and mailed off the request, which answers
+	// the same and as fast whether or not there is one.
+	go func() {
+		if err := s.mailReset(email); err != nil {
+			log.Printf("request password reset: %s", err)
+		}
+	}()
+	return nil
+}
+
+// mailReset mails a reset link to the account with the email address, if
+// there is one.
+func (s *PasswordResetService) mailReset(email string) error {
+	user, err := s.users.GetUser("", email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("error generating token: %s", err)
+	}
+
+	now := time.Now()
+	reset := models.PasswordReset{
+		UserID:    user.ID,
+		Hash:      hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(resetTime),
+	}
+	if _, err := s.repo.CreatePasswordReset(reset); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your account. To choose a new one, open this link within an hour:\n\n"+
+			"%s/reset-password?token=%s\n\n"+
+			"If it wasn't you, ignore this email: your password stays the same.\n",
+			user.Username, s.baseURL, token),
+	})
+}
+
+func (s *PasswordResetService) CheckPasswordReset(token string) error {
+	_, err := s.usableReset(token)
+	return err
+}
+
+func (s *PasswordResetService) ResetPassword(token, password, confirm string) error {
+	reset, err := s.usableReset(token)
+	if err != nil {
+		return err
+	}
+
+	if !checkPassword(password) {
+		return ErrInvalidPassword
+	}
+	if password != confirm {
+		return ErrPasswordMismatch
+	}
+
+	hash, err := generatePasswordHash(password)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.repo.ResetPassword(reset.ID, hash, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidResetLink
+	}
+
+	// Whoever reset the password owns the account: lift its lockout.
+	return s.guard.Succeed(reset.Username)
+}
+
+func (s *PasswordResetService) usableReset(token string) (models.PasswordReset, error) {
+	if token == "" {
+		return models.PasswordReset{}, ErrInvalidResetLink
+	}
+
+	reset, err := s.repo.GetPasswordReset(hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return reset, ErrInvalidResetLink
+	} else if err != nil {
+		return reset, err
+	}
+	if !reset.Usable(time.Now()) {
+		return reset, ErrInvalidResetLink
+	}
+	return reset, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+// fakeResets keeps the password resets it is asked to create.
+type fakeResets struct {
+	repository.PasswordReset
+	created chan models.PasswordReset
+}
+
+func (r *fakeResets) CreatePasswordReset(reset models.PasswordReset) (int, error) {
+	r.created <- reset
+	return 1, nil
+}
+
+// stuckMailer fails to send its messages, but only once released.
+type stuckMailer struct {
+	release chan struct{}
+}
+
+func (m *stuckMailer) Send(msg mail.Message) error {
+	<-m.release
+	return errors.New("mail server is down")
+}
+
+// TestRequestPasswordResetHidesAccounts checks a reset request answers the
+// same, without waiting for the mail, whether or not the address has an
+// account.
+func TestRequestPasswordResetHidesAccounts(t *testing.T) {
+	users := newFakeUsers()
+	alice := users.add(models.User{Username: "alice", Email: "alice@example.com"})
+	resets := &fakeResets{created: make(chan models.PasswordReset, 1)}
+	mailer := &stuckMailer{release: make(chan struct{})}
+	guard, _, _, _ := newTestGuard()
+	s := NewPasswordResetService(resets, users, guard, mailer, "http://forum.test")
+
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		if err := s.RequestPasswordReset(email, "192.0.2.1"); err != nil {
+			t.Errorf("RequestPasswordReset(%s) = %v, want nil", email, err)
+		}
+	}
+	close(mailer.release)
+
+	select {
+	case reset := <-resets.created:
+		if reset.UserID != alice.ID {
+			t.Errorf("reset created for user %d, want %d", reset.UserID, alice.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no reset created for alice")
+	}
+}
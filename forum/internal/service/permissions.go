@@ -0,0 +1,47 @@
+package service
+
+import "forum/internal/models"
+
+// The checks below decide what each role allows. Services enforce them
+// and handlers and templates ask them what to offer, so that the rules
+// live in one place.
+
+// CanEditPost reports whether user may change the post: only its author
+// can put words in their mouth.
+func CanEditPost(user models.User, post models.Post) bool {
+	return user.ID != 0 && user.ID == post.AuthorID
+}
+
+// CanDeletePost reports whether user may delete the post, theirs or, for
+// moderators, anyone's.
+func CanDeletePost(user models.User, post models.Post) bool {
+	return CanEditPost(user, post) || isModerator(user)
+}
+
+// CanEditComment and CanDeleteComment leave the deleted comments alone:
+// nothing is left of them but their place in the thread.
+func CanEditComment(user models.User, comment models.Comment) bool {
+	return !comment.Deleted && user.ID != 0 && user.ID == comment.UserID
+}
+
+func CanDeleteComment(user models.User, comment models.Comment) bool {
+	return !comment.Deleted && (CanEditComment(user, comment) || isModerator(user))
+}
+
+func CanManageCategories(user models.User) bool {
+	return user.Role == models.RoleAdmin
+}
+
+// CanManageLockouts reports whether user may list and lift the sign in
+// lockouts.
+func CanManageLockouts(user models.User) bool {
+	return user.Role == models.RoleAdmin
+}
+
+func CanManageRoles(user models.User) bool {
+	return user.Role == models.RoleAdmin
+}
+
+func isModerator(user models.User) bool {
+	return user.Role == models.RoleModerator || user.Role == models.RoleAdmin
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"forum/internal/models"
+)
+
+func TestPermissions(t *testing.T) {
+	const authorID = 1
+	post := models.Post{ID: 1, AuthorID: authorID}
+	comment := models.Comment{ID: 1, UserID: authorID}
+
+	tests := []struct {
+		name string
+		user models.User
+		// What the user may do to the post and comment of author 1:
+		// edit, delete, and manage categories, lockouts and roles.
+		edit, delete, manage bool
+	}{
+		{name: "anonymous"},
+		{name: "author", user: models.User{ID: authorID, Role: models.RoleUser}, edit: true, delete: true},
+		{name: "other user", user: models.User{ID: 2, Role: models.RoleUser}},
+		{name: "moderator author", user: models.User{ID: authorID, Role: models.RoleModerator}, edit: true, delete: true},
+		{name: "other moderator", user: models.User{ID: 2, Role: models.RoleModerator}, delete: true},
+		{name: "admin author", user: models.User{ID: authorID, Role: models.RoleAdmin}, edit: true, delete: true, manage: true},
+		{name: "other admin", user: models.User{ID: 2, Role: models.RoleAdmin}, delete: true, manage: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, check := range []struct {
+				name string
+				got  bool
+				want bool
+			}{
+				{"CanEditPost", CanEditPost(tt.user, post), tt.edit},
+				{"CanEditComment", CanEditComment(tt.user, comment), tt.edit},
+				{"CanDeletePost", CanDeletePost(tt.user, post), tt.delete},
+				{"CanDeleteComment", CanDeleteComment(tt.user, comment), tt.delete},
+				{"CanManageCategories", CanManageCategories(tt.user), tt.manage},
+				{"CanManageLockouts", CanManageLockouts(tt.user), tt.manage},
+				{"CanManageRoles", CanManageRoles(tt.user), tt.manage},
+			} {
+				if check.got != check.want {
+					t.Errorf("%s = %t, want %t", check.name, check.got, check.want)
+				}
+			}
+		})
+	}
+
+	// A visitor has no ID, which must not make them the author of the
+	// posts and comments of deleted users.
+	if CanEditPost(models.User{}, models.Post{}) || CanEditComment(models.User{}, models.Comment{}) {
+		t.Error("visitors may edit posts and comments without an author")
+	}
+
+	// Nothing is left to edit or delete of a deleted comment.
+	deleted := models.Comment{ID: 1, Deleted: true}
+	if admin := (models.User{ID: 2, Role: models.RoleAdmin}); CanEditComment(admin, deleted) || CanDeleteComment(admin, deleted) {
+		t.Error("admins may edit or delete a deleted comment")
+	}
+}
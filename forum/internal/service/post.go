@@ -4,44 +4,139 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
 
 	"forum/internal/models"
 	"forum/internal/repository"
 )
 
 type Post interface {
-	CreatePost(post models.Post) error
+	// CreatePost publishes a post of the user, who must have confirmed
+	// their email address.
+	CreatePost(post models.Post, user models.User) (int, error)
+	// CheckPost reports why CreatePost would refuse the post, so that its
+	// images aren't saved for nothing.
+	CheckPost(post models.Post, user models.User) error
 	PostById(postID, UserID int) (models.Post, error)
-	AllPosts(userID int) ([]models.Post, error)
-	UsersPosts(userID int) ([]models.Post, error)
-	PostsByCategory(userID int, category string) ([]models.Post, error)
-	LikedPosts(userID int) ([]models.Post, error)
+	Posts(userID int, filter models.PostFilter, page models.Page) ([]models.Post, models.Pagination, error)
+	UpdatePost(post models.Post, user models.User) error
+	DeletePost(postID int, user models.User) error
+	PostHistory(postID int) ([]models.Revision, error)
 }
 
 var (
 	ErrEmptyPost = errors.New("can't create an empty post")
 	ErrNoPost    = errors.New("post is not found")
+	ErrBadFilter = errors.New("invalid post filter")
 )
 
 type PostService struct {
-	repo repository.Post
+	repo       repository.Post
+	categories repository.Category
 }
 
-func NewPostService(repo repository.Post) *PostService {
+func NewPostService(repo repository.Post, categories repository.Category) *PostService {
 	return &PostService{
-		repo: repo,
+		repo:       repo,
+		categories: categories,
 	}
 }
 
-func (s *PostService) CreatePost(post models.Post) error {
+func (s *PostService) CreatePost(post models.Post, user models.User) (int, error) {
+	if err := s.CheckPost(post, user); err != nil {
+		return 0, err
+	}
+	post.AuthorID = user.ID
+	post.CreatedAt = time.Now()
+	post.UpdatedAt = post.CreatedAt
+	return s.repo.CreatePost(post)
+}
+
+func (s *PostService) CheckPost(post models.Post, user models.User) error {
+	if err := CanPost(user); err != nil {
+		return err
+	}
 	if strings.TrimSpace(post.Content) == "" {
 		return ErrEmptyPost
 	}
-	return s.repo.CreatePost(post)
+	return s.checkCategories(post.Categories, nil)
+}
+
+// UpdatePost replaces the title, content and categories of a post the user may edit.
+func (s *PostService) UpdatePost(post models.Post, user models.User) error {
+	if strings.TrimSpace(post.Content) == "" {
+		return ErrEmptyPost
+	}
+
+	existing, err := s.PostById(post.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if !CanEditPost(user, existing) {
+		return ErrForbidden
+	}
+
+	if err := s.checkCategories(post.Categories, existing.Categories); err != nil {
+		return err
+	}
+
+	post.UpdatedAt = time.Now()
+	return s.repo.UpdatePost(post, user.ID)
+}
+
+// DeletePost removes a post the user may delete along with everything attached to it.
+func (s *PostService) DeletePost(postID int, user models.User) error {
+	post, err := s.PostById(postID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if !CanDeletePost(user, post) {
+		return ErrForbidden
+	}
+
+	return s.repo.DeletePost(postID)
+}
+
+// Posts returns one page of the posts matching the filter.
+func (s *PostService) Posts(userID int, filter models.PostFilter, page models.Page) ([]models.Post, models.Pagination, error) {
+	filter, err := normalizeFilter(filter)
+	if err != nil {
+		return nil, models.Pagination{}, err
+	}
+
+	return paginate(page, func(page models.Page) ([]models.Post, error) {
+		return s.repo.GetPosts(userID, filter, page)
+	})
+}
+
+// normalizeFilter drops empty and repeated categories and checks the date range.
+func normalizeFilter(filter models.PostFilter) (models.PostFilter, error) {
+	var categories []string
+	for _, category := range filter.Categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if category != "" && !containsString(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	filter.Categories = categories
+	filter.Author = strings.TrimSpace(filter.Author)
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, ErrBadFilter
+	}
+
+	return filter, nil
 }
 
-func (s *PostService) AllPosts(userID int) ([]models.Post, error) {
-	return s.repo.GetAllPosts(userID)
+func containsString(list []string, val string) bool {
+	for _, v := range list {
+		if v == val {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *PostService) PostById(postID, UserID int) (models.Post, error) {
@@ -55,14 +150,50 @@ func (s *PostService) PostById(postID, UserID int) (models.Post, error) {
 	return posts, nil
 }
 
-func (s *PostService) UsersPosts(userID int) ([]models.Post, error) {
-	return s.repo.GetAllUserPosts(userID)
-}
+// PostHistory returns the revisions of a post, newest first, each one
+// carrying a line diff against the version it replaced.
+func (s *PostService) PostHistory(postID int) ([]models.Revision, error) {
+	revisions, err := s.repo.GetPostRevisions(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrNoPost
+	}
+
+	history := make([]models.Revision, len(revisions))
+	var prev models.Revision
+	for i, revision := range revisions {
+		revision.PrevTitle = prev.Title
+		revision.Diff = lineDiff(prev.Content, revision.Content)
+		history[len(revisions)-1-i] = revision
+		prev = revision
+	}
 
-func (s *PostService) PostsByCategory(userID int, category string) ([]models.Post, error) {
-	return s.repo.GetPostsByCategory(userID, category)
+	return history, nil
 }
 
-func (s *PostService) LikedPosts(userID int) ([]models.Post, error) {
-	return s.repo.GetLikedPosts(userID)
+// checkCategories makes sure a post is filed under at least one category and
+// only under categories that take new posts; archived ones are accepted if
+// they are in kept, the categories the post already had.
+func (s *PostService) checkCategories(slugs, kept []string) error {
+	if len(slugs) == 0 {
+		return ErrNoPostCategories
+	}
+
+	for _, slug := range slugs {
+		category, err := s.categories.GetCategoryBySlug(slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUnknownCategory
+		} else if err != nil {
+			return err
+		}
+
+		if category.Archived && !containsString(kept, slug) {
+			return ErrUnknownCategory
+		}
+	}
+
+	return nil
 }
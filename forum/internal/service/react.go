@@ -1,7 +1,10 @@
 package service
 
 import (
+	"database/sql"
+	"errors"
 	"strconv"
+	"time"
 
 	"forum/internal/models"
 	"forum/internal/repository"
@@ -12,6 +15,8 @@ type Reaction interface {
 	ReactToComment(commentID int, userID int, react string) (int, error)
 }
 
+var ErrInvalidVote = errors.New("vote must be 1 or -1")
+
 type ReactionService struct {
 	repo repository.Reaction
 }
@@ -23,29 +28,47 @@ func NewReactionService(repo repository.Reaction) *ReactionService {
 }
 
 func (s *ReactionService) ReactToPost(postID, userID int, react string) error {
-	vote, err := strconv.Atoi(react)
+	vote, err := parseVote(react)
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
 	reaction := models.Reaction{
-		PostID: postID,
-		UserID: userID,
-		Vote:   vote,
+		PostID:    postID,
+		UserID:    userID,
+		Vote:      vote,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 	return s.repo.CreateReactionPost(reaction)
 }
 
 func (s *ReactionService) ReactToComment(commentID int, userID int, react string) (int, error) {
-	vote, err := strconv.Atoi(react)
+	vote, err := parseVote(react)
 	if err != nil {
 		return 0, err
 	}
 
+	now := time.Now()
 	reaction := models.Reaction{
 		CommentID: commentID,
 		UserID:    userID,
 		Vote:      vote,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	postID, err := s.repo.CreateReactionComment(reaction)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoComment
+	}
+	return postID, err
+}
+
+func parseVote(react string) (int, error) {
+	vote, err := strconv.Atoi(react)
+	if err != nil || (vote != 1 && vote != -1) {
+		return 0, ErrInvalidVote
 	}
-	return s.repo.CreateReactionComment(reaction)
+	return vote, nil
 }
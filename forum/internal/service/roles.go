@@ -0,0 +1,65 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type Roles interface {
+	// Staff lists the moderators and admins.
+	Staff(user models.User) ([]models.User, error)
+	// SetRole gives the user named username the role and returns them.
+	SetRole(user models.User, username string, role models.Role) (models.User, error)
+}
+
+var (
+	ErrInvalidRole = errors.New("role must be user, moderator or admin")
+	ErrLastAdmin   = errors.New("the forum needs at least one admin")
+	ErrNoUsername  = errors.New("no user has that username")
+)
+
+type RoleService struct {
+	repo repository.Authorization
+}
+
+func NewRoleService(repo repository.Authorization) *RoleService {
+	return &RoleService{
+		repo: repo,
+	}
+}
+
+func (s *RoleService) Staff(user models.User) ([]models.User, error) {
+	if !CanManageRoles(user) {
+		return nil, ErrForbidden
+	}
+	return s.repo.GetStaff()
+}
+
+func (s *RoleService) SetRole(user models.User, username string, role models.Role) (models.User, error) {
+	if !CanManageRoles(user) {
+		return models.User{}, ErrForbidden
+	}
+	if !role.Valid() {
+		return models.User{}, ErrInvalidRole
+	}
+
+	target, err := s.repo.GetUser(username, "")
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrNoUsername
+	} else if err != nil {
+		return models.User{}, err
+	}
+
+	ok, err := s.repo.SetRole(target.ID, role)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !ok {
+		return models.User{}, ErrLastAdmin
+	}
+	target.Role = role
+	return target, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"html"
+	"html/template"
+	"strings"
+	"unicode"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type Search interface {
+	Search(query models.SearchQuery, page, userID int) ([]models.SearchResult, bool, error)
+}
+
+var ErrEmptySearch = errors.New("search query is empty")
+
+const searchPageSize = 20
+
+type SearchService struct {
+	repo repository.Search
+}
+
+func NewSearchService(repo repository.Search) *SearchService {
+	return &SearchService{
+		repo: repo,
+	}
+}
+
+// Search returns one page (starting at 1) of posts matching the query, best
+// matches first, and whether there are more results after it.
+func (s *SearchService) Search(query models.SearchQuery, page, userID int) ([]models.SearchResult, bool, error) {
+	query.Match = matchExpression(query.Text)
+	if query.Match == "" {
+		return nil, false, ErrEmptySearch
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	query.Limit = searchPageSize + 1
+	query.Offset = (page - 1) * searchPageSize
+
+	results, err := s.repo.Search(query, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	more := len(results) > searchPageSize
+	if more {
+		results = results[:searchPageSize]
+	}
+
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Excerpt)
+	}
+
+	return results, more, nil
+}
+
+// matchExpression turns free text into a full-text expression that requires
+// every word, each matched as a prefix. Only letters and digits are kept so
+// user input can never break the query syntax.
+func matchExpression(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlight escapes a snippet and wraps its matched terms in <mark> tags.
+func highlight(excerpt string) template.HTML {
+	escaped := html.EscapeString(excerpt)
+	escaped = strings.ReplaceAll(escaped, models.HighlightStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, models.HighlightEnd, "</mark>")
+	return template.HTML(escaped)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"html/template"
+	"testing"
+
+	"forum/internal/models"
+)
+
+// excerpts is a search repository finding a post for each of its excerpts.
+type excerpts []string
+
+func (e excerpts) Search(query models.SearchQuery, userID int) ([]models.SearchResult, error) {
+	results := make([]models.SearchResult, len(e))
+	for i, excerpt := range e {
+		results[i] = models.SearchResult{Post: models.Post{ID: i + 1}, Excerpt: excerpt}
+	}
+	return results, nil
+}
+
+func TestSearchHighlightsEscapedSnippets(t *testing.T) {
+	s := NewSearchService(excerpts{
+		"The <b>" + models.HighlightStart + "zeppelin" + models.HighlightEnd + "</b> was flown & more",
+		models.HighlightStart + "<script>" + models.HighlightEnd + `alert("zeppelin")`,
+	})
+
+	results, more, err := s.Search(models.SearchQuery{Text: "zeppelin"}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more {
+		t.Error("more results reported after the only page")
+	}
+	for i, want := range []template.HTML{
+		"The &lt;b&gt;<mark>zeppelin</mark>&lt;/b&gt; was flown &amp; more",
+		"<mark>&lt;script&gt;</mark>alert(&#34;zeppelin&#34;)",
+	} {
+		if results[i].Snippet != want {
+			t.Errorf("snippet %d = %q, want %q", i, results[i].Snippet, want)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		text  string
+		match string
+	}{
+		{"zeppelin", `"zeppelin"*`},
+		{"  Zeppelin   history ", `"Zeppelin"* "history"*`},
+		{`zep"pelin OR NOT* <script>`, `"zep"* "pelin"* "OR"* "NOT"* "script"*`},
+		{"dirigeable été", `"dirigeable"* "été"*`},
+		{`"*()-:^`, ``},
+	}
+	for _, tt := range tests {
+		if match := matchExpression(tt.text); match != tt.match {
+			t.Errorf("matchExpression(%q) = %q, want %q", tt.text, match, tt.match)
+		}
+	}
+
+	if _, _, err := NewSearchService(excerpts{}).Search(models.SearchQuery{Text: "()"}, 1, 0); !errors.Is(err, ErrEmptySearch) {
+		t.Errorf("searching for punctuation: %v, want %v", err, ErrEmptySearch)
+	}
+}
@@ -1,21 +1,65 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+
+	"forum/internal/config"
+	"forum/internal/mail"
+	"forum/internal/oidc"
 	"forum/internal/repository"
+	"forum/internal/webauthn"
 )
 
+var ErrForbidden = errors.New("you are not allowed to do that")
+
 type Service struct {
 	Authorization
 	Post
 	Commentary
 	Reaction
+	Search
+	Category
+	APIToken
+	LoginGuard
+	PasswordReset
+	EmailVerification
+	TwoFactor
+	Passkey
+	OIDC
+	Roles
 }
 
-func NewService(repo *repository.Repository) *Service {
-	return &Service{
-		Authorization: NewAuthService(repo.Authorization),
-		Post:          NewPostService(repo.Post),
-		Commentary:    NewCommentService(repo.Commentary),
-		Reaction:      NewReactionService(repo.Reaction),
+// NewService builds the services of the forum. It fails if FORUM_BASE_URL
+// can't serve as the relying party of the passkeys.
+func NewService(repo *repository.Repository, cfg config.Config, mailer mail.Mailer) (*Service, error) {
+	guard := NewLoginGuardService(repo.LoginThrottle, SystemClock, NewMailNotifier(mailer, cfg.BaseURL))
+	verifier := NewEmailVerificationService(repo.Authorization, guard, mailer, cfg.Secret, cfg.BaseURL)
+	twoFactor := NewTwoFactorService(repo.TwoFactor, repo.Authorization, guard, SystemClock)
+	rp, err := webauthn.NewRelyingParty("Forum", cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("passkeys: FORUM_BASE_URL=%q: %s", cfg.BaseURL, err)
 	}
+	passkeys := NewPasskeyService(repo.Passkey, repo.Authorization, guard, rp, SystemClock)
+	var provider *oidc.Provider
+	if cfg.OIDCIssuer != "" {
+		provider = oidc.NewProvider(cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.BaseURL+"/sign-in/oidc/callback")
+	}
+	sso := NewOIDCService(repo.OIDC, repo.Authorization, provider, cfg.OIDCName, SystemClock)
+	return &Service{
+		Authorization:     NewAuthService(repo.Authorization, guard, verifier, twoFactor, passkeys, sso),
+		Post:              NewPostService(repo.Post, repo.Category),
+		Commentary:        NewCommentService(repo.Commentary, cfg.CommentMaxDepth),
+		Reaction:          NewReactionService(repo.Reaction),
+		Search:            NewSearchService(repo.Search),
+		Category:          NewCategoryService(repo.Category),
+		APIToken:          NewAPITokenService(repo.APIToken),
+		LoginGuard:        guard,
+		PasswordReset:     NewPasswordResetService(repo.PasswordReset, repo.Authorization, guard, mailer, cfg.BaseURL),
+		EmailVerification: verifier,
+		TwoFactor:         twoFactor,
+		Passkey:           passkeys,
+		OIDC:              sso,
+		Roles:             NewRoleService(repo.Authorization),
+	}, nil
 }
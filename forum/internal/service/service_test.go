@@ -0,0 +1,21 @@
+package service
+
+import (
+	"testing"
+
+	"forum/internal/config"
+	"forum/internal/mail"
+	"forum/internal/repository"
+)
+
+func TestNewServiceRejectsBadBaseURL(t *testing.T) {
+	repo := repository.NewRepository(nil)
+	mailer := mail.NewMailer(config.Config{Mail: "log"})
+
+	if _, err := NewService(repo, config.Config{BaseURL: "http://forum.test"}, mailer); err != nil {
+		t.Errorf("NewService(http://forum.test) = %v", err)
+	}
+	if _, err := NewService(repo, config.Config{BaseURL: "forum.test"}, mailer); err == nil {
+		t.Error("NewService accepted a base URL without a host")
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SweepSessions purges the expired sessions every interval until ctx is
+// done. Expired sessions are already refused when used; sweeping keeps
+// them from piling up.
+func SweepSessions(ctx context.Context, auth Authorization, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := auth.PurgeExpiredSessions()
+		if err != nil {
+			log.Printf("session sweeper: %s", err)
+		} else if n > 0 {
+			log.Printf("session sweeper: purged %d expired session(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
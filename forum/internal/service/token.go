@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type APIToken interface {
+	// CreateToken mints a token for the user and returns it with its
+	// plaintext, which is not stored and can't be shown again.
+	CreateToken(userID int, name string, scopes []models.Scope) (models.APIToken, string, error)
+	Tokens(userID int) ([]models.APIToken, error)
+	RevokeToken(ID, userID int) error
+	// UserByAPIToken resolves the owner of a token presented by a client.
+	UserByAPIToken(token string) (models.User, models.APIToken, error)
+}
+
+var (
+	ErrNoToken          = errors.New("api token is not found")
+	ErrInvalidToken     = errors.New("api token is invalid or revoked")
+	ErrInvalidTokenName = errors.New("token name must be 1 to 64 characters long")
+	ErrInvalidScope     = errors.New("token needs one or more known scopes")
+)
+
+const maxTokenName = 64
+
+type APITokenService struct {
+	repo repository.APIToken
+}
+
+func NewAPITokenService(repo repository.APIToken) *APITokenService {
+	return &APITokenService{
+		repo: repo,
+	}
+}
+
+func (s *APITokenService) CreateToken(userID int, name string, scopes []models.Scope) (models.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTokenName {
+		return models.APIToken{}, "", ErrInvalidTokenName
+	}
+
+	scopes, err := checkScopes(scopes)
+	if err != nil {
+		return models.APIToken{}, "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return models.APIToken{}, "", fmt.Errorf("create token -> error generating token: %s", err)
+	}
+	plaintext := models.APITokenPrefix + hex.EncodeToString(b)
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Hash:      hashToken(plaintext),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	token.ID, err = s.repo.CreateAPIToken(token)
+	if err != nil {
+		return models.APIToken{}, "", err
+	}
+	return token, plaintext, nil
+}
+
+func (s *APITokenService) Tokens(userID int) ([]models.APIToken, error) {
+	return s.repo.GetAPITokens(userID)
+}
+
+func (s *APITokenService) RevokeToken(ID, userID int) error {
+	ok, err := s.repo.RevokeAPIToken(ID, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoToken
+	}
+	return nil
+}
+
+func (s *APITokenService) UserByAPIToken(plaintext string) (models.User, models.APIToken, error) {
+	user, token, err := s.repo.UserByAPIToken(hashToken(plaintext))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, models.APIToken{}, ErrInvalidToken
+	} else if err != nil {
+		return models.User{}, models.APIToken{}, err
+	}
+	if token.Revoked() {
+		return models.User{}, models.APIToken{}, ErrInvalidToken
+	}
+
+	now := time.Now()
+	token.LastUsedAt = &now
+	if err := s.repo.TouchAPIToken(token.ID, now); err != nil {
+		return models.User{}, models.APIToken{}, err
+	}
+
+	return user, token, nil
+}
+
+// checkScopes rejects unknown scopes and returns the known ones in their
+// canonical order without duplicates.
+func checkScopes(scopes []models.Scope) ([]models.Scope, error) {
+	requested := make(map[models.Scope]bool, len(scopes))
+	for _, scope := range scopes {
+		requested[scope] = true
+	}
+
+	var checked []models.Scope
+	for _, scope := range models.Scopes {
+		if requested[scope] {
+			checked = append(checked, scope)
+			delete(requested, scope)
+		}
+	}
+	if len(checked) == 0 || len(requested) != 0 {
+		return nil, ErrInvalidScope
+	}
+	return checked, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+	"forum/internal/totp"
+
+	"github.com/skip2/go-qrcode"
+)
+
+type TwoFactor interface {
+	TwoFactorStatus(userID int) (models.TwoFactorStatus, error)
+	// SetupTwoFactor returns a secret for the user to add to their
+	// authenticator app. It only guards sign ins once EnableTwoFactor
+	// confirmed it.
+	SetupTwoFactor(user models.User) (models.TwoFactorSetup, error)
+	// EnableTwoFactor checks a first code of the authenticator and returns
+	// the recovery codes, which are only stored hashed.
+	EnableTwoFactor(user models.User, code string) ([]string, error)
+	// DisableTwoFactor turns two-factor authentication off once the user
+	// entered their password again. Wrong passwords count as failed sign
+	// ins of the account from ip.
+	DisableTwoFactor(user models.User, password, ip string) error
+}
+
+var (
+	ErrSecondFactorRequired = errors.New("enter the code of your authenticator app")
+	ErrWrongCode            = errors.New("wrong two-factor code")
+	ErrLoginExpired         = errors.New("the sign in has expired, enter your password again")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already on")
+	ErrTwoFactorDisabled    = errors.New("two-factor authentication is off")
+)
+
+// SecondFactorError asks for the second factor of a sign in whose password
+// was right. It matches ErrSecondFactorRequired.
+type SecondFactorError struct {
+	// Challenge identifies the sign in when the code is sent.
+	Challenge string
+}
+
+func (e *SecondFactorError) Error() string {
+	return ErrSecondFactorRequired.Error()
+}
+
+func (e *SecondFactorError) Is(target error) bool {
+	return target == ErrSecondFactorRequired
+}
+
+const (
+	totpIssuer = "Forum"
+	// totpSkew is how many steps a code may be off by.
+	totpSkew = 1
+	// setupTime is how long a secret waits for its first code before a
+	// setup starts over with a new one.
+	setupTime = time.Hour
+	// qrCodeSize is the width and height of the QR code image in pixels.
+	qrCodeSize = 256
+
+	recoveryCodes = 10
+
+	challengeTime = time.Minute * 5
+	// maxChallengeAttempts is how many wrong codes a sign in can take
+	// before the password has to be entered again.
+	maxChallengeAttempts = 5
+)
+
+type TwoFactorService struct {
+	repo  repository.TwoFactor
+	users repository.Authorization
+	guard *LoginGuardService
+	clock Clock
+}
+
+func NewTwoFactorService(repo repository.TwoFactor, users repository.Authorization, guard *LoginGuardService, clock Clock) *TwoFactorService {
+	return &TwoFactorService{
+		repo:  repo,
+		users: users,
+		guard: guard,
+		clock: clock,
+	}
+}
+
+func (s *TwoFactorService) TwoFactorStatus(userID int) (models.TwoFactorStatus, error) {
+	enabled, err := s.enabled(userID)
+	if err != nil || !enabled {
+		return models.TwoFactorStatus{}, err
+	}
+
+	n, err := s.repo.CountRecoveryCodes(userID)
+	if err != nil {
+		return models.TwoFactorStatus{}, err
+	}
+	return models.TwoFactorStatus{Enabled: true, RecoveryCodes: n}, nil
+}
+
+func (s *TwoFactorService) SetupTwoFactor(user models.User) (models.TwoFactorSetup, error) {
+	now := s.clock.Now()
+
+	t, err := s.repo.GetTOTP(user.ID)
+	switch {
+	case err == nil && t.Enabled():
+		return models.TwoFactorSetup{}, ErrTwoFactorEnabled
+	case err == nil && now.Sub(t.CreatedAt) < setupTime:
+		// Reloading the page shouldn't invalidate a secret the user may
+		// have scanned already.
+	case err == nil || errors.Is(err, sql.ErrNoRows):
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return models.TwoFactorSetup{}, fmt.Errorf("setup two factor -> error generating secret: %s", err)
+		}
+		t = models.TOTP{UserID: user.ID, Secret: secret, CreatedAt: now}
+		if err := s.repo.SaveTOTPSecret(t); err != nil {
+			return models.TwoFactorSetup{}, err
+		}
+	default:
+		return models.TwoFactorSetup{}, err
+	}
+
+	uri := totp.URI(totpIssuer, user.Username, t.Secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return models.TwoFactorSetup{}, fmt.Errorf("setup two factor -> error encoding qr code: %s", err)
+	}
+
+	return models.TwoFactorSetup{
+		Secret: t.Secret,
+		URI:    template.URL(uri),
+		QRCode: template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+	}, nil
+}
+
+func (s *TwoFactorService) EnableTwoFactor(user models.User, code string) ([]string, error) {
+	t, err := s.repo.GetTOTP(user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTwoFactorDisabled
+	} else if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	now := s.clock.Now()
+	step, ok := totp.Validate(t.Secret, code, now, totpSkew)
+	if !ok {
+		return nil, ErrWrongCode
+	}
+
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		if codes[i], err = generateRecoveryCode(); err != nil {
+			return nil, fmt.Errorf("enable two factor -> error generating recovery code: %s", err)
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := s.repo.EnableTOTP(user.ID, step, now, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) DisableTwoFactor(user models.User, password, ip string) error {
+	enabled, err := s.enabled(user.ID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorDisabled
+	}
+
+	if err := confirmPassword(s.users, s.guard, user, password, ip); err != nil {
+		return err
+	}
+	return s.repo.DeleteTOTP(user.ID)
+}
+
+func (s *TwoFactorService) enabled(userID int) (bool, error) {
+	t, err := s.repo.GetTOTP(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return t.Enabled(), nil
+}
+
+// challenge records a sign in waiting for its second factor and returns
+// the token identifying it.
+func (s *TwoFactorService) challenge(userID int, req models.SignInRequest) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("challenge -> error generating token: %s", err)
+	}
+
+	_, err = s.repo.CreateLoginChallenge(models.LoginChallenge{
+		UserID:     userID,
+		Hash:       hashToken(token),
+		ExpiresAt:  s.clock.Now().Add(challengeTime),
+		Persistent: req.Remember,
+		UserAgent:  req.UserAgent,
+		IP:         req.IP,
+	})
+	return token, err
+}
+
+// openChallenge returns the unexpired challenge with the token.
+func (s *TwoFactorService) openChallenge(token string) (models.LoginChallenge, error) {
+	c, err := s.repo.GetLoginChallenge(hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, ErrLoginExpired
+	} else if err != nil {
+		return c, err
+	}
+	if !s.clock.Now().Before(c.ExpiresAt) || c.Attempts >= maxChallengeAttempts {
+		s.repo.DeleteLoginChallenge(c.ID)
+		return c, ErrLoginExpired
+	}
+	return c, nil
+}
+
+// failChallenge counts a wrong code, giving up on the sign in after too
+// many.
+func (s *TwoFactorService) failChallenge(c models.LoginChallenge) error {
+	if c.Attempts+1 >= maxChallengeAttempts {
+		return s.repo.DeleteLoginChallenge(c.ID)
+	}
+	return s.repo.AddChallengeAttempt(c.ID)
+}
+
+// verify checks a code of the authenticator, which can't be used twice,
+// or else one of the recovery codes of the user.
+func (s *TwoFactorService) verify(userID int, code string) error {
+	t, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := totp.Validate(t.Secret, code, s.clock.Now(), totpSkew); ok {
+		ok, err := s.repo.UseTOTPStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrWrongCode
+		}
+		return nil
+	}
+
+	ok, err := s.repo.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)), s.clock.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongCode
+	}
+	return nil
+}
+
+// recoveryAlphabet is that of base32, in lower case.
+const recoveryAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// generateRecoveryCode returns a code like "k7m2p-x4qrt": 50 random bits.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryAlphabet[b[i]&31]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
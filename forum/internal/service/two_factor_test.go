@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"forum/internal/models"
+	"forum/internal/repository"
+	"forum/internal/totp"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oneUser is a user repository holding a single user.
+type oneUser struct {
+	repository.Authorization
+	user models.User
+}
+
+func (r *oneUser) GetUserByID(ID int) (models.User, error) {
+	if ID != r.user.ID {
+		return models.User{}, errors.New("no such user")
+	}
+	return r.user, nil
+}
+
+// enabledTOTP is a two-factor repository where the authenticator of every
+// user is on until deleted.
+type enabledTOTP struct {
+	repository.TwoFactor
+	deleted bool
+}
+
+func (r *enabledTOTP) GetTOTP(userID int) (models.TOTP, error) {
+	return models.TOTP{UserID: userID, Secret: "secret", EnabledAt: time.Unix(1, 0)}, nil
+}
+
+func (r *enabledTOTP) DeleteTOTP(userID int) error {
+	r.deleted = true
+	return nil
+}
+
+func TestDisableTwoFactorIsThrottled(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: 1, Username: "alice", Password: string(hash)}
+	totps := &enabledTOTP{}
+	guard, _, clock, _ := newTestGuard()
+	s := NewTwoFactorService(totps, &oneUser{user: user}, guard, clock)
+	const ip = "192.0.2.1"
+
+	for i := 0; i < freeFailures; i++ {
+		if err := s.DisableTwoFactor(user, "guess", ip); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("guess %d: %v, want %v", i+1, err, ErrWrongPassword)
+		}
+	}
+	// Throttled attempts are refused before the password is compared.
+	if err := s.DisableTwoFactor(user, "Passw0rd!", ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("after %d guesses: %v, want %v", freeFailures, err, ErrTooManyAttempts)
+	}
+	if got := retryAfter(t, guard, user.Username, ""); got == 0 {
+		t.Error("guesses here don't throttle signing in to the account")
+	}
+	if totps.deleted {
+		t.Fatal("two-factor authentication turned off while throttled")
+	}
+
+	clock.Step(backoff(freeFailures))
+	if err := s.DisableTwoFactor(user, "Passw0rd!", ip); err != nil {
+		t.Fatalf("right password after waiting: %v", err)
+	}
+	if !totps.deleted {
+		t.Error("two-factor authentication is still on")
+	}
+}
+
+// codesTOTP is a two-factor repository holding the authenticator and the
+// recovery codes of one user, by hash.
+type codesTOTP struct {
+	repository.TwoFactor
+	lastStep int64
+	unused   map[string]bool
+}
+
+func (r *codesTOTP) GetTOTP(userID int) (models.TOTP, error) {
+	return models.TOTP{UserID: userID, Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", EnabledAt: time.Unix(1, 0), LastStep: r.lastStep}, nil
+}
+
+func (r *codesTOTP) UseTOTPStep(userID int, step int64) (bool, error) {
+	if step <= r.lastStep {
+		return false, nil
+	}
+	r.lastStep = step
+	return true, nil
+}
+
+func (r *codesTOTP) UseRecoveryCode(userID int, hash string, at time.Time) (bool, error) {
+	if !r.unused[hash] {
+		return false, nil
+	}
+	delete(r.unused, hash)
+	return true, nil
+}
+
+func TestVerifyRefusesReusedCodes(t *testing.T) {
+	repo := &codesTOTP{unused: map[string]bool{hashToken("k7m2px4qrt"): true}}
+	clock := newFakeClock()
+	s := NewTwoFactorService(repo, nil, nil, clock)
+
+	code, err := totp.Code("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", totp.Step(clock.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verify(1, code); err != nil {
+		t.Fatalf("authenticator code: %v", err)
+	}
+	if err := s.verify(1, code); !errors.Is(err, ErrWrongCode) {
+		t.Errorf("authenticator code used again: %v, want %v", err, ErrWrongCode)
+	}
+
+	// Recovery codes are shown as "k7m2p-x4qrt", but people retype them.
+	if err := s.verify(1, " K7M2P X4QRT "); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	for _, code := range []string{"k7m2p-x4qrt", "K7M2PX4QRT"} {
+		if err := s.verify(1, code); !errors.Is(err, ErrWrongCode) {
+			t.Errorf("recovery code used again as %q: %v, want %v", code, err, ErrWrongCode)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type EmailVerification interface {
+	// SendVerification mails a confirmation link to the user.
+	SendVerification(user models.User) error
+	VerifyEmail(token string) error
+	// ResendVerification mails a new link to the unverified account with
+	// the email address, if there is one. Requests are throttled per
+	// address and per ip, whether or not there is such an account.
+	ResendVerification(email, ip string) error
+}
+
+var (
+	ErrInvalidVerifyLink = errors.New("email confirmation link is invalid or has expired")
+	ErrEmailNotVerified  = errors.New("confirm your email address before posting")
+)
+
+// verifyTime is how long an email confirmation link can be used.
+const verifyTime = time.Hour * 48
+
+// EmailVerificationService confirms email addresses with signed links:
+// nothing is stored until the link is opened. A link names the user, its
+// expiry and an HMAC binding both to the address it was sent to.
+type EmailVerificationService struct {
+	repo    repository.Authorization
+	guard   *LoginGuardService
+	mailer  mail.Mailer
+	secret  []byte
+	baseURL string
+}
+
+func NewEmailVerificationService(repo repository.Authorization, guard *LoginGuardService, mailer mail.Mailer, secret []byte, baseURL string) *EmailVerificationService {
+	return &EmailVerificationService{
+		repo:    repo,
+		guard:   guard,
+		mailer:  mailer,
+		secret:  secret,
+		baseURL: baseURL,
+	}
+}
+
+func (s *EmailVerificationService) SendVerification(user models.User) error {
+	expires := time.Now().Add(verifyTime).Unix()
+	token := fmt.Sprintf("%d.%d.%s", user.ID, expires, s.sign(user.ID, user.Email, expires))
+
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Welcome to the forum! Open this link within two days to confirm your email address and start posting:\n\n"+
+			"%s/verify-email?token=%s\n\n"+
+			"If you didn't sign up, ignore this email.\n",
+			user.Username, s.baseURL, token),
+	})
+}
+
+func (s *EmailVerificationService) VerifyEmail(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidVerifyLink
+	}
+	userID, err1 := strconv.Atoi(parts[0])
+	expires, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || time.Now().Unix() > expires {
+		return ErrInvalidVerifyLink
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidVerifyLink
+	} else if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(user.ID, user.Email, expires))) {
+		return ErrInvalidVerifyLink
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.repo.VerifyEmail(user.ID, user.Email, time.Now())
+}
+
+func (s *EmailVerificationService) ResendVerification(email, ip string) error {
+	if email == "" {
+		return ErrInvalidEmail
+	}
+
+	if err := s.guard.LimitVerification(email, ip); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUser("", email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.SendVerification(user)
+}
+
+func (s *EmailVerificationService) sign(userID int, email string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "verify-email:%d:%s:%d", userID, email, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CanPost returns ErrEmailNotVerified for users who haven't confirmed
+// their email address yet.
+func CanPost(user models.User) error {
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
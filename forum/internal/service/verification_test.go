@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"forum/internal/models"
+)
+
+func TestPostingNeedsVerifiedEmail(t *testing.T) {
+	// The check comes first, so the repositories are never reached.
+	user := models.User{ID: 1, Username: "alice"}
+
+	if _, err := NewPostService(nil, nil).CreatePost(models.Post{Title: "Hi", Content: "Hello"}, user); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("CreatePost by an unverified user: %v, want %v", err, ErrEmailNotVerified)
+	}
+	if _, err := NewCommentService(nil, 5).CreateComment(models.Comment{PostID: 1, Content: "Hello"}, user); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("CreateComment by an unverified user: %v, want %v", err, ErrEmailNotVerified)
+	}
+}
+
+func TestResendVerificationIsThrottled(t *testing.T) {
+	users := newFakeUsers()
+	alice := users.add(models.User{Username: "alice", Email: "alice@example.com"})
+	mailer := &fakeMailer{}
+	guard, _, clock, _ := newTestGuard()
+	s := NewEmailVerificationService(users, guard, mailer, []byte("secret"), "http://forum.test")
+	const ip = "192.0.2.1"
+
+	for i := 1; i <= freeFailures; i++ {
+		if err := s.ResendVerification(alice.Email, ip); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := s.ResendVerification("Alice@example.com", "192.0.2.2"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("request %d: %v, want %v", freeFailures+1, err, ErrTooManyAttempts)
+	}
+	if len(mailer.sent) != freeFailures {
+		t.Errorf("%d mails sent, want %d", len(mailer.sent), freeFailures)
+	}
+
+	// Unknown addresses count too, or the limit would tell them apart.
+	clock.Step(backoff(freeFailures))
+	if err := s.ResendVerification("nobody@example.com", ip); err != nil {
+		t.Fatalf("request for nobody after waiting: %v", err)
+	}
+	if err := s.ResendVerification("carol@example.com", ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("request from a busy address: %v, want %v", err, ErrTooManyAttempts)
+	}
+
+	// The mails are counted apart from sign ins and reset requests.
+	if got := retryAfter(t, guard, "alice", ip); got != 0 {
+		t.Errorf("sign in after confirmation mails: retry after %s, want none", got)
+	}
+	if err := guard.LimitReset(alice.Email, "192.0.2.3"); err != nil {
+		t.Errorf("reset request after confirmation mails: %v", err)
+	}
+}
+
+func TestSignUpIsThrottled(t *testing.T) {
+	users := newFakeUsers()
+	mailer := &fakeMailer{}
+	guard, _, _, _ := newTestGuard()
+	verifier := NewEmailVerificationService(users, guard, mailer, []byte("secret"), "http://forum.test")
+	s := NewAuthService(users, guard, verifier, nil, nil, nil)
+	const ip = "192.0.2.1"
+
+	signUp := func(i int) error {
+		_, err := s.CreateUser(models.User{
+			Username:        fmt.Sprintf("user%d", i),
+			Email:           fmt.Sprintf("user%d@example.com", i),
+			Password:        "Passw0rd!",
+			ConfirmPassword: "Passw0rd!",
+		}, ip)
+		return err
+	}
+	for i := 1; i <= freeFailures; i++ {
+		if err := signUp(i); err != nil {
+			t.Fatalf("sign up %d: %v", i, err)
+		}
+	}
+	if err := signUp(freeFailures + 1); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("sign up %d: %v, want %v", freeFailures+1, err, ErrTooManyAttempts)
+	}
+	if len(users.users) != freeFailures || len(mailer.sent) != freeFailures {
+		t.Errorf("%d users and %d mails, want %d of each", len(users.users), len(mailer.sent), freeFailures)
+	}
+}
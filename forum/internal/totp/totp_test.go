@@ -0,0 +1,80 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors of RFC 6238, Appendix B:
+// the ASCII string "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA-1 vectors of RFC 6238, Appendix B, cut to the
+// last six of their eight digits.
+var rfcVectors = []struct {
+	unix int64
+	step int64
+	code string
+}{
+	{59, 0x1, "287082"},
+	{1111111109, 0x23523EC, "081804"},
+	{1111111111, 0x23523ED, "050471"},
+	{1234567890, 0x273EF07, "005924"},
+	{2000000000, 0x3F940AA, "279037"},
+	{20000000000, 0x27BC86AA, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		if step := Step(time.Unix(tt.unix, 0)); step != tt.step {
+			t.Errorf("Step(%d) = %#x, want %#x", tt.unix, step, tt.step)
+		}
+		code, err := Code(rfcSecret, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range rfcVectors {
+		at := time.Unix(tt.unix, 0)
+		if step, ok := Validate(rfcSecret, tt.code, at, 0); !ok || step != tt.step {
+			t.Errorf("Validate(%s) at %d = %#x, %v; want %#x", tt.code, tt.unix, step, ok, tt.step)
+		}
+	}
+
+	// The code of 59s, in step 1, typed with a space in steps 0 to 3.
+	const code = "287 082"
+	tests := []struct {
+		unix int64
+		skew int
+		ok   bool
+	}{
+		{59, 0, true},
+		{89, 0, false},
+		{89, 1, true},
+		{29, 1, true},
+		{119, 1, false},
+		{119, 2, true},
+	}
+	for _, tt := range tests {
+		step, ok := Validate(rfcSecret, code, time.Unix(tt.unix, 0), tt.skew)
+		if ok != tt.ok || (ok && step != 1) {
+			t.Errorf("Validate at %d with skew %d = %d, %v; want step 1, %v", tt.unix, tt.skew, step, ok, tt.ok)
+		}
+	}
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, time.Unix(59, 0), 1); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cborMap is a map for encodeCBOR that keeps its keys in order, as
+// authenticators do.
+type cborMap [][2]interface{}
+
+// encodeCBOR encodes what decodeCBOR decodes, for building test input.
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		case n <= 0xffffffff:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborMap:
+		out := head(5, uint64(len(v)))
+		for _, kv := range v {
+			out = append(out, encodeCBOR(kv[0])...)
+			out = append(out, encodeCBOR(kv[1])...)
+		}
+		return out
+	}
+	panic("encodeCBOR: unsupported value")
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{0, int64(0)},
+		{23, int64(23)},
+		{24, int64(24)},
+		{1 << 40, int64(1 << 40)},
+		{-1, int64(-1)},
+		{-257, int64(-257)},
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"fmt", "fmt"},
+		{strings.Repeat("x", 300), strings.Repeat("x", 300)},
+		{true, true},
+		{nil, nil},
+		{[]interface{}{1, "a", []interface{}{}}, []interface{}{int64(1), "a", []interface{}{}}},
+		{cborMap{{"fmt", "none"}, {-2, []byte{9}}}, map[interface{}]interface{}{"fmt": "none", int64(-2): []byte{9}}},
+	}
+	for _, tt := range tests {
+		data := encodeCBOR(tt.in)
+		got, rest, err := decodeCBOR(append(data, 0xff))
+		if err != nil {
+			t.Errorf("decodeCBOR(%x): %v", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%x) = %#v, want %#v", data, got, tt.want)
+		}
+		if !bytes.Equal(rest, []byte{0xff}) {
+			t.Errorf("decodeCBOR(%x) left %x, want ff", data, rest)
+		}
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":                     {},
+		"truncated argument":        {0x19, 0x01},
+		"truncated byte string":     {0x45, 1, 2},
+		"byte string past the end":  {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"array longer than data":    {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"map longer than data":      {0xba, 0xff, 0xff, 0xff, 0xff, 0},
+		"truncated array":           {0x83, 1, 2},
+		"map without value":         {0xa1, 1},
+		"byte string map key":       {0xa1, 0x41, 0, 1},
+		"integer overflow":          {0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"negative integer overflow": {0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"tag":                       {0xc0, 0},
+		"indefinite length":         {0x5f, 0x41, 0, 0xff},
+		"float":                     {0xf9, 0x3c, 0},
+		"reserved additional info":  {0x1c},
+		"nested too deep":           append(bytes.Repeat([]byte{0x81}, maxCBORDepth+1), 0),
+	}
+	for name, data := range tests {
+		if v, rest, err := decodeCBOR(data); !errors.Is(err, errCBOR) {
+			t.Errorf("%s: decodeCBOR(%x) = %#v, %x, %v; want errCBOR", name, data, v, rest, err)
+		}
+	}
+
+	if _, _, err := decodeCBOR(append(bytes.Repeat([]byte{0x81}, maxCBORDepth), 0)); err != nil {
+		t.Errorf("nesting at the limit: %v", err)
+	}
+}
+
+func FuzzDecodeCBOR(f *testing.F) {
+	f.Add(encodeCBOR(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", bytes.Repeat([]byte{1}, 37)}}))
+	f.Add(encodeCBOR(cborMap{{1, 2}, {3, -7}, {-1, 1}, {-2, make([]byte, 32)}, {-3, make([]byte, 32)}}))
+	f.Add([]byte{0x9f, 0xff})
+	f.Add([]byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, rest, err := decodeCBOR(data)
+		if err != nil {
+			return
+		}
+		if len(rest) >= len(data) || !bytes.Equal(rest, data[len(data)-len(rest):]) {
+			t.Fatalf("decodeCBOR(%x) left %x, not a proper suffix", data, rest)
+		}
+	})
+}
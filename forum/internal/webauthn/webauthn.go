@@ -0,0 +1,333 @@
+// Package webauthn verifies the registration and assertion ceremonies of
+// WebAuthn (https://www.w3.org/TR/webauthn-2/) for passkey sign ins. It
+// supports the "none" attestation only, which is what passkeys send by
+// default, and ES256 and RS256 keys.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+)
+
+// RelyingParty identifies the forum to authenticators.
+type RelyingParty struct {
+	// ID is the domain the passkeys are bound to.
+	ID   string
+	Name string
+	// Origin is the scheme, host and port the forum is served from.
+	Origin string
+}
+
+// NewRelyingParty derives the relying party from the base URL of the
+// forum.
+func NewRelyingParty(name, baseURL string) (RelyingParty, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return RelyingParty{}, errors.New("webauthn: invalid base url")
+	}
+	return RelyingParty{
+		ID:     u.Hostname(),
+		Name:   name,
+		Origin: u.Scheme + "://" + u.Host,
+	}, nil
+}
+
+// COSE algorithm identifiers.
+const (
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+var (
+	ErrInvalidResponse = errors.New("webauthn: invalid authenticator response")
+	ErrUnsupportedKey  = errors.New("webauthn: unsupported public key")
+	ErrBadSignature    = errors.New("webauthn: signature doesn't verify")
+	// ErrCounter reports a sign counter that went backwards, a sign that
+	// the authenticator was cloned.
+	ErrCounter = errors.New("webauthn: sign counter didn't increase")
+)
+
+// Encoding is how binary values are sent to and from the browser.
+var Encoding = base64.RawURLEncoding
+
+// NewChallenge returns a random challenge for a ceremony.
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return Encoding.EncodeToString(b), nil
+}
+
+// Credential is a registered public key credential.
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE encoded key.
+	PublicKey []byte
+	SignCount uint32
+}
+
+// CreationOptions are the options of navigator.credentials.create, with
+// binary values base64url encoded for the script to decode.
+func (rp RelyingParty) CreationOptions(challenge string, userHandle []byte, username string, exclude [][]byte) map[string]interface{} {
+	excluded := make([]map[string]string, 0, len(exclude))
+	for _, id := range exclude {
+		excluded = append(excluded, map[string]string{"type": "public-key", "id": Encoding.EncodeToString(id)})
+	}
+	return map[string]interface{}{
+		"challenge": challenge,
+		"rp":        map[string]string{"id": rp.ID, "name": rp.Name},
+		"user": map[string]string{
+			"id":          Encoding.EncodeToString(userHandle),
+			"name":        username,
+			"displayName": username,
+		},
+		"pubKeyCredParams": []map[string]interface{}{
+			{"type": "public-key", "alg": AlgES256},
+			{"type": "public-key", "alg": AlgRS256},
+		},
+		"timeout":            300000,
+		"attestation":        "none",
+		"excludeCredentials": excluded,
+		"authenticatorSelection": map[string]string{
+			"residentKey":      "required",
+			"userVerification": "required",
+		},
+	}
+}
+
+// RequestOptions are the options of navigator.credentials.get. No
+// credentials are listed: the passkeys found on the device tell who signs
+// in.
+func (rp RelyingParty) RequestOptions(challenge string) map[string]interface{} {
+	return map[string]interface{}{
+		"challenge":        challenge,
+		"rpId":             rp.ID,
+		"timeout":          300000,
+		"userVerification": "required",
+	}
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ClientChallenge reads the challenge out of the client data of a
+// response, to find the ceremony it answers.
+func ClientChallenge(clientDataJSON []byte) (string, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return "", ErrInvalidResponse
+	}
+	return cd.Challenge, nil
+}
+
+func (rp RelyingParty) checkClientData(clientDataJSON []byte, typ, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return ErrInvalidResponse
+	}
+	if cd.Type != typ || cd.Challenge != challenge || cd.Origin != rp.Origin {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// Flags of the authenticator data.
+const (
+	flagUserPresent = 0x01
+	// flagUserVerified is set when the authenticator checked a PIN or a
+	// biometric, which is what lets a passkey stand for both factors.
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, ErrInvalidResponse
+	}
+	ad := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	// The AAGUID of the authenticator model comes first; it isn't used.
+	if len(rest) < 18 {
+		return ad, ErrInvalidResponse
+	}
+	n := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if n == 0 || len(rest) < n {
+		return ad, ErrInvalidResponse
+	}
+	ad.credentialID = rest[:n]
+
+	_, after, err := decodeCBOR(rest[n:])
+	if err != nil {
+		return ad, ErrInvalidResponse
+	}
+	ad.publicKey = rest[n : len(rest)-len(after)]
+	return ad, nil
+}
+
+func (rp RelyingParty) checkAuthenticatorData(ad authenticatorData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) || ad.flags&flagUserPresent == 0 || ad.flags&flagUserVerified == 0 {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create
+// for the challenge and returns the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, ErrInvalidResponse
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+	raw, ok := m["authData"].([]byte)
+	if !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	ad, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return Credential{}, err
+	}
+	if ad.credentialID == nil {
+		return Credential{}, ErrInvalidResponse
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        append([]byte(nil), ad.credentialID...),
+		PublicKey: append([]byte(nil), ad.publicKey...),
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get for
+// the challenge, signed with the credential, and returns the new sign
+// counter of the credential.
+func (rp RelyingParty) VerifyAssertion(challenge string, cred Credential, clientDataJSON, authData, signature []byte) (uint32, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	if !key.verify(append(append([]byte(nil), authData...), clientHash[:]...), signature) {
+		return 0, ErrBadSignature
+	}
+
+	// Authenticators that don't count, as synced passkeys, always send 0.
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrCounter
+	}
+	return ad.signCount, nil
+}
+
+type publicKey struct {
+	alg int64
+	ec  *ecdsa.PublicKey
+	rsa *rsa.PublicKey
+}
+
+// parsePublicKey reads a COSE key (RFC 8152, section 13).
+func parsePublicKey(data []byte) (publicKey, error) {
+	obj, _, err := decodeCBOR(data)
+	if err != nil {
+		return publicKey{}, ErrUnsupportedKey
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return publicKey{}, ErrUnsupportedKey
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, ec: key}, nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		exp := new(big.Int).SetBytes(e)
+		return publicKey{alg: alg, rsa: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return publicKey{}, ErrUnsupportedKey
+}
+
+func (k publicKey) verify(message, signature []byte) bool {
+	digest := sha256.Sum256(message)
+	switch k.alg {
+	case AlgES256:
+		return ecdsa.VerifyASN1(k.ec, digest[:], signature)
+	case AlgRS256:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
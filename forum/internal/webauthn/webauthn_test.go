@@ -0,0 +1,294 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// softAuthenticator is an ES256 authenticator in software, answering the
+// ceremonies of a relying party the way a browser and a passkey would.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+
+	// origin and rpID are what the browser and the authenticator think
+	// they talk to.
+	origin string
+	rpID   string
+	flags  byte
+}
+
+func newSoftAuthenticator(t *testing.T, rp RelyingParty) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		key:    key,
+		id:     []byte("credential-1"),
+		origin: rp.Origin,
+		rpID:   rp.ID,
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// coseKey is the public key in COSE form.
+func (a *softAuthenticator) coseKey() []byte {
+	return encodeCBOR(cborMap{
+		{1, 2},
+		{3, AlgES256},
+		{-1, 1},
+		{-2, a.key.X.FillBytes(make([]byte, 32))},
+		{-3, a.key.Y.FillBytes(make([]byte, 32))},
+	})
+}
+
+// register answers navigator.credentials.create, returning the
+// clientDataJSON and the attestationObject.
+func (a *softAuthenticator) register(challenge string) ([]byte, []byte) {
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, a.coseKey()...)
+
+	attestation := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", a.authData(a.flags|flagAttested, attested)},
+	})
+	return a.clientData("webauthn.create", challenge), attestation
+}
+
+// assert answers navigator.credentials.get, returning the clientDataJSON,
+// the authenticatorData and the signature.
+func (a *softAuthenticator) assert(challenge string) ([]byte, []byte, []byte) {
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(a.flags, nil)
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientData, authData, signature
+}
+
+func newTestRelyingParty(t *testing.T) RelyingParty {
+	t.Helper()
+	rp, err := NewRelyingParty("Forum", "https://forum.example.com:8443/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.ID != "forum.example.com" || rp.Origin != "https://forum.example.com:8443" {
+		t.Fatalf("NewRelyingParty = %+v", rp)
+	}
+	return rp
+}
+
+func challenge(t *testing.T) string {
+	t.Helper()
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// registered returns an authenticator with a credential registered at rp.
+func registered(t *testing.T, rp RelyingParty) (*softAuthenticator, Credential) {
+	t.Helper()
+	a := newSoftAuthenticator(t, rp)
+	c := challenge(t)
+	clientData, attestation := a.register(c)
+	cred, err := rp.VerifyRegistration(c, clientData, attestation)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return a, cred
+}
+
+func TestRegisterAndSignIn(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a, cred := registered(t, rp)
+
+	if string(cred.ID) != string(a.id) || cred.SignCount != 0 {
+		t.Errorf("credential %+v", cred)
+	}
+
+	for want := uint32(1); want <= 3; want++ {
+		a.signCount = want
+		c := challenge(t)
+		clientData, authData, signature := a.assert(c)
+
+		got, err := ClientChallenge(clientData)
+		if err != nil || got != c {
+			t.Fatalf("ClientChallenge = %q, %v; want %q", got, err, c)
+		}
+		count, err := rp.VerifyAssertion(c, cred, clientData, authData, signature)
+		if err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+		if count != want {
+			t.Fatalf("sign count %d, want %d", count, want)
+		}
+		cred.SignCount = count
+	}
+}
+
+func TestSignInWithoutCounter(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a, cred := registered(t, rp)
+
+	// Synced passkeys don't count: 0 every time is fine.
+	for i := 0; i < 2; i++ {
+		c := challenge(t)
+		clientData, authData, signature := a.assert(c)
+		if _, err := rp.VerifyAssertion(c, cred, clientData, authData, signature); err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := map[string]func(a *softAuthenticator){
+		"wrong origin":        func(a *softAuthenticator) { a.origin = "https://evil.example.com" },
+		"http origin":         func(a *softAuthenticator) { a.origin = "http://forum.example.com:8443" },
+		"wrong rpIdHash":      func(a *softAuthenticator) { a.rpID = "evil.example.com" },
+		"missing UP flag":     func(a *softAuthenticator) { a.flags = flagUserVerified },
+		"missing UV flag":     func(a *softAuthenticator) { a.flags = flagUserPresent },
+		"missing credentials": func(a *softAuthenticator) { a.id = nil },
+	}
+	for name, edit := range tests {
+		t.Run(name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			a := newSoftAuthenticator(t, rp)
+			edit(a)
+
+			c := challenge(t)
+			clientData, attestation := a.register(c)
+			if _, err := rp.VerifyRegistration(c, clientData, attestation); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("VerifyRegistration: %v, want %v", err, ErrInvalidResponse)
+			}
+		})
+	}
+
+	t.Run("challenge replay", func(t *testing.T) {
+		rp := newTestRelyingParty(t)
+		a := newSoftAuthenticator(t, rp)
+		clientData, attestation := a.register(challenge(t))
+		if _, err := rp.VerifyRegistration(challenge(t), clientData, attestation); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("VerifyRegistration: %v, want %v", err, ErrInvalidResponse)
+		}
+	})
+
+	t.Run("assertion instead of attestation", func(t *testing.T) {
+		rp := newTestRelyingParty(t)
+		a := newSoftAuthenticator(t, rp)
+		c := challenge(t)
+		clientData, authData, _ := a.assert(c)
+		if _, err := rp.VerifyRegistration(c, clientData, authData); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("VerifyRegistration: %v, want %v", err, ErrInvalidResponse)
+		}
+	})
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	tests := map[string]struct {
+		edit func(a *softAuthenticator)
+		want error
+	}{
+		"wrong origin":    {func(a *softAuthenticator) { a.origin = "https://evil.example.com" }, ErrInvalidResponse},
+		"wrong rpIdHash":  {func(a *softAuthenticator) { a.rpID = "evil.example.com" }, ErrInvalidResponse},
+		"missing UP flag": {func(a *softAuthenticator) { a.flags = flagUserVerified }, ErrInvalidResponse},
+		"missing UV flag": {func(a *softAuthenticator) { a.flags = flagUserPresent }, ErrInvalidResponse},
+		"counter went backwards": {func(a *softAuthenticator) {
+			a.signCount = 4
+		}, ErrCounter},
+		"counter stood still": {func(a *softAuthenticator) {
+			a.signCount = 5
+		}, ErrCounter},
+		"counter reset to zero": {func(a *softAuthenticator) {
+			a.signCount = 0
+		}, ErrCounter},
+		"other key": {func(a *softAuthenticator) {
+			a.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			a.signCount = 6
+		}, ErrBadSignature},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			a, cred := registered(t, rp)
+			cred.SignCount = 5
+			a.signCount = 6
+			tt.edit(a)
+
+			c := challenge(t)
+			clientData, authData, signature := a.assert(c)
+			if _, err := rp.VerifyAssertion(c, cred, clientData, authData, signature); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyAssertion: %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("challenge replay", func(t *testing.T) {
+		rp := newTestRelyingParty(t)
+		a, cred := registered(t, rp)
+		a.signCount = 1
+
+		clientData, authData, signature := a.assert(challenge(t))
+		if _, err := rp.VerifyAssertion(challenge(t), cred, clientData, authData, signature); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("VerifyAssertion: %v, want %v", err, ErrInvalidResponse)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		rp := newTestRelyingParty(t)
+		a, cred := registered(t, rp)
+		a.signCount = 1
+
+		c := challenge(t)
+		clientData, authData, signature := a.assert(c)
+		authData[36]++
+		if _, err := rp.VerifyAssertion(c, cred, clientData, authData, signature); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("VerifyAssertion: %v, want %v", err, ErrBadSignature)
+		}
+	})
+
+	t.Run("truncated authenticator data", func(t *testing.T) {
+		rp := newTestRelyingParty(t)
+		a, cred := registered(t, rp)
+
+		c := challenge(t)
+		clientData, authData, signature := a.assert(c)
+		if _, err := rp.VerifyAssertion(c, cred, clientData, authData[:36], signature); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("VerifyAssertion: %v, want %v", err, ErrInvalidResponse)
+		}
+	})
+}
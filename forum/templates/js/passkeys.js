@@ -0,0 +1,88 @@
+// Runs the WebAuthn ceremonies of the sign in page and of the passkeys
+// settings. The server sends and takes binary values base64url encoded.
+(function () {
+    "use strict";
+
+    if (!window.PublicKeyCredential) {
+        return;
+    }
+
+    function decode(value) {
+        const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+        const binary = atob(base64 + "===".slice((base64.length + 3) % 4));
+        return Uint8Array.from(binary, (c) => c.charCodeAt(0));
+    }
+
+    function encode(buffer) {
+        const binary = String.fromCharCode(...new Uint8Array(buffer));
+        return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+    }
+
+    async function post(url, csrf, body) {
+        const response = await fetch(url, {
+            method: "POST",
+            credentials: "same-origin",
+            headers: { "Content-Type": "application/json", "X-CSRF-Token": csrf },
+            body: JSON.stringify(body || {}),
+        });
+        const data = await response.json().catch(() => null);
+        if (!response.ok) {
+            throw new Error(data && data.error ? data.error.message : response.statusText);
+        }
+        return data;
+    }
+
+    function showError(container, err) {
+        const box = container.querySelector(".passkey-error");
+        box.textContent = err.name === "NotAllowedError" ? "The passkey prompt was closed." : err.message;
+        box.hidden = false;
+    }
+
+    const signIn = document.getElementById("passkey-sign-in");
+    if (signIn) {
+        const container = signIn.parentElement;
+        container.hidden = false;
+        signIn.addEventListener("click", async () => {
+            try {
+                const options = await post("/passkeys/sign-in/begin", signIn.dataset.csrf);
+                options.challenge = decode(options.challenge);
+                const credential = await navigator.credentials.get({ publicKey: options });
+                const remember = document.getElementById("remember");
+                await post("/passkeys/sign-in/finish", signIn.dataset.csrf, {
+                    credential_id: encode(credential.rawId),
+                    client_data_json: encode(credential.response.clientDataJSON),
+                    authenticator_data: encode(credential.response.authenticatorData),
+                    signature: encode(credential.response.signature),
+                    remember: remember ? remember.checked : false,
+                });
+                window.location.assign("/");
+            } catch (err) {
+                showError(container, err);
+            }
+        });
+    }
+
+    const register = document.getElementById("passkey-register");
+    if (register) {
+        register.addEventListener("submit", async (event) => {
+            event.preventDefault();
+            try {
+                const options = await post("/passkeys/register/begin", register.dataset.csrf, {
+                    password: register.elements.password.value,
+                });
+                options.challenge = decode(options.challenge);
+                options.user.id = decode(options.user.id);
+                options.excludeCredentials = options.excludeCredentials.map((c) => ({ ...c, id: decode(c.id) }));
+                const credential = await navigator.credentials.create({ publicKey: options });
+                await post("/passkeys/register/finish", register.dataset.csrf, {
+                    name: register.elements.name.value,
+                    client_data_json: encode(credential.response.clientDataJSON),
+                    attestation_object: encode(credential.response.attestationObject),
+                });
+                window.location.reload();
+            } catch (err) {
+                showError(register, err);
+            }
+        });
+    }
+})();
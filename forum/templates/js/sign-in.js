@@ -0,0 +1,15 @@
+// Carries "Remember me" over to the single sign-on link, which can't be a
+// form as the identity provider is on another site.
+(function () {
+    "use strict";
+
+    const link = document.getElementById("oidc-sign-in");
+    const remember = document.getElementById("remember");
+    if (!link || !remember) {
+        return;
+    }
+
+    remember.addEventListener("change", () => {
+        link.href = remember.checked ? "/sign-in/oidc?remember=1" : "/sign-in/oidc";
+    });
+})();